@@ -0,0 +1,10 @@
+// Package api содержит контракт сервера: спецификацию OpenAPI 3
+// всех маршрутов, которую сервер отдаёт по адресу /openapi.json.
+package api
+
+import _ "embed"
+
+// OpenAPI — спецификация API сервера в формате OpenAPI 3 (JSON).
+//
+//go:embed openapi.json
+var OpenAPI []byte
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -14,6 +16,16 @@ import (
 	"github.com/Mihklz/metrixcollector/internal/logger"
 )
 
+// agentRuntime объединяет компоненты, с которыми работает основной цикл агента
+type agentRuntime struct {
+	cfg      *config.AgentConfig
+	sender   *agent.MetricsSender
+	statsd   *agent.StatsDListener // nil, если StatsD выключен
+	spool    *agent.Spool          // nil, если очередь на диске выключена
+	agg      *agent.Aggregator     // nil, если агрегация не настроена
+	counters *agent.CounterTracker
+}
+
 func main() {
 	// Инициализируем логгер
 	if err := logger.Initialize(); err != nil {
@@ -24,7 +36,8 @@ func main() {
 	cfg := config.LoadAgentConfig()
 
 	log.Println("Agent started")
-	log.Printf("Poll interval: %v, Report interval: %v, Server: %s", cfg.PollInterval, cfg.ReportInterval, cfg.ServerAddr)
+	log.Printf("Poll interval: %v, Report interval: %v, Servers: %s (%s)",
+		cfg.PollInterval, cfg.ReportInterval, strings.Join(cfg.ServerAddrs, ", "), cfg.ServerMode)
 
 	// Создаем контекст с отменой для graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -34,13 +47,53 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Создаем sender для отправки метрик
-	sender := agent.NewMetricsSender(cfg.ServerAddr, cfg.Key)
+	sender, err := agent.NewMetricsSender(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create metrics sender: %v", err)
+	}
+
+	rt := &agentRuntime{
+		cfg:      cfg,
+		sender:   sender,
+		counters: agent.NewCounterTracker(),
+	}
+
+	// Поднимаем приёмник StatsD, если он включён
+	if cfg.StatsDAddr != "" {
+		rt.statsd = agent.NewStatsDListener(cfg.StatsDAddr)
+		if err := rt.statsd.Listen(); err != nil {
+			log.Fatalf("Failed to start StatsD listener: %v", err)
+		}
+		log.Printf("StatsD listener started on %s", rt.statsd.Addr())
+	}
+
+	// Настраиваем агрегацию gauge-метрик за окно отчёта
+	if cfg.Aggregations != "" {
+		rules, err := agent.ParseAggregationRules(cfg.Aggregations)
+		if err != nil {
+			log.Fatalf("Invalid aggregation rules: %v", err)
+		}
+		rt.agg = agent.NewAggregator(rules)
+	}
+
+	// Открываем очередь неотправленных отчётов, если она включена
+	if cfg.SpoolDir != "" {
+		spool, err := agent.OpenSpool(agent.SpoolConfig{
+			Dir:      cfg.SpoolDir,
+			MaxBytes: cfg.SpoolMaxBytes,
+			MaxAge:   cfg.SpoolMaxAge,
+		})
+		if err != nil {
+			log.Fatalf("Failed to open spool: %v", err)
+		}
+		rt.spool = spool
+		log.Printf("Spool opened in %s, pending reports: %d", cfg.SpoolDir, spool.Len())
+	}
 
 	// Запускаем основной цикл в горутине
 	var wg sync.WaitGroup
 	wg.Add(1)
-	go runAgent(ctx, &wg, cfg, sender)
+	go runAgent(ctx, &wg, rt)
 
 	// Ждем сигнала завершения
 	<-sigChan
@@ -50,9 +103,32 @@ func main() {
 	log.Println("Agent stopped")
 }
 
-func runAgent(ctx context.Context, wg *sync.WaitGroup, cfg *config.AgentConfig, sender *agent.MetricsSender) {
+func runAgent(ctx context.Context, wg *sync.WaitGroup, rt *agentRuntime) {
 	defer wg.Done()
 
+	cfg := rt.cfg
+
+	// Приём StatsD-пакетов идёт в отдельной горутине до отмены контекста
+	if rt.statsd != nil {
+		go rt.statsd.Serve(ctx)
+	}
+
+	// Повторная отправка отчётов из очереди, когда сервер снова доступен
+	if rt.spool != nil {
+		go func() {
+			ticker := time.NewTicker(cfg.PollInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					rt.replaySpool(ctx)
+				}
+			}
+		}()
+	}
+
 	// Канал для передачи метрик от сборщика к пулу отправителей
 	metricsCh := make(chan agent.MetricsSet, cfg.RateLimit*2)
 
@@ -72,14 +148,23 @@ func runAgent(ctx context.Context, wg *sync.WaitGroup, cfg *config.AgentConfig,
 					if !ok {
 						return
 					}
-					if err := sender.SendMetrics(ctx, ms); err != nil {
-						log.Printf("failed to send metrics: %v", err)
-					}
+					rt.deliver(ctx, ms)
 				}
 			}
 		}()
 	}
 
+	// Завершение: дожидаемся воркеров и сохраняем то, что не успели отправить
+	shutdown := func() {
+		close(metricsCh)
+		workersWg.Wait()
+		for ms := range metricsCh {
+			if !rt.enqueue(ms) {
+				rt.counters.Rollback(ms.Counters)
+			}
+		}
+	}
+
 	// Сборщик метрик: отдельно runtime и системные метрики
 	tickerPoll := time.NewTicker(cfg.PollInterval)
 	tickerReport := time.NewTicker(cfg.ReportInterval)
@@ -111,16 +196,18 @@ func runAgent(ctx context.Context, wg *sync.WaitGroup, cfg *config.AgentConfig,
 		}
 	}()
 
+	// Потери очереди, уже учтённые в счётчиках
+	var reportedDrops agent.SpoolStats
+
 	for {
 		select {
 		case <-ctx.Done():
-			// Завершаем: закрываем канал, ждём воркеров
-			close(metricsCh)
-			workersWg.Wait()
+			shutdown()
 			return
 		case <-tickerPoll.C:
 			// Сбор runtime метрик
 			current = agent.Collect()
+			rt.counters.AddAll(current.Counters)
 			// Добавим системные метрики
 			sysMu.Lock()
 			for k, v := range latestSys {
@@ -130,22 +217,130 @@ func runAgent(ctx context.Context, wg *sync.WaitGroup, cfg *config.AgentConfig,
 				current.Gauges[k] = v
 			}
 			sysMu.Unlock()
+			// Каждый опрос попадает в агрегаты окна
+			if rt.agg != nil {
+				rt.agg.Observe(current.Gauges)
+			}
 		case <-tickerReport.C:
 			// Отправляем снимок через канал в пул воркеров
 			snapshot := agent.MetricsSet{
-				Gauges:    make(map[string]float64, len(current.Gauges)),
-				PollCount: current.PollCount,
+				ID:     agent.NewReportID(),
+				Gauges: make(map[string]float64, len(current.Gauges)),
 			}
 			for k, v := range current.Gauges {
 				snapshot.Gauges[k] = v
 			}
+			// Добавляем производные метрики окна (например, HeapAlloc.max)
+			if rt.agg != nil {
+				for k, v := range rt.agg.Flush() {
+					snapshot.Gauges[k] = v
+				}
+			}
+			// Добавляем агрегированные за окно метрики StatsD
+			if rt.statsd != nil {
+				fromStatsD := rt.statsd.Flush()
+				for k, v := range fromStatsD.Gauges {
+					snapshot.Gauges[k] = v
+				}
+				rt.counters.AddAll(fromStatsD.Counters)
+			}
+			// Сообщаем серверу о потерях в очереди
+			if rt.spool != nil {
+				stats := rt.spool.Stats()
+				rt.counters.Add("SpoolDroppedBatches", stats.DroppedBatches-reportedDrops.DroppedBatches)
+				rt.counters.Add("SpoolDroppedMetrics", stats.DroppedMetrics-reportedDrops.DroppedMetrics)
+				reportedDrops = stats
+			}
+			snapshot.Counters = rt.counters.Snapshot()
 			select {
 			case metricsCh <- snapshot:
 			case <-ctx.Done():
-				close(metricsCh)
-				workersWg.Wait()
+				rt.counters.Rollback(snapshot.Counters)
+				shutdown()
 				return
+			default:
+				// Все воркеры заняты — не блокируем сборщик, откладываем отчёт в очередь
+				if !rt.enqueue(snapshot) {
+					rt.counters.Rollback(snapshot.Counters)
+					log.Println("send queue is full, report skipped")
+				}
 			}
 		}
 	}
 }
+
+// deliver отправляет отчёт на сервер, а при недоступности сервера сохраняет его в очередь
+func (rt *agentRuntime) deliver(ctx context.Context, ms agent.MetricsSet) {
+	// Пока в очереди есть старые отчёты, новые встают за ними, чтобы сохранить порядок
+	if rt.spool != nil && rt.spool.Len() > 0 {
+		if !rt.enqueue(ms) {
+			rt.counters.Rollback(ms.Counters)
+		}
+		return
+	}
+
+	err := rt.sender.SendMetrics(ctx, ms)
+	if err == nil {
+		rt.counters.Ack(ms.Counters)
+		return
+	}
+	log.Printf("failed to send metrics: %v", err)
+
+	// Сервер ответил, но отверг данные — очередь не поможет.
+	// Неподтверждённые приращения вернутся в следующий отчёт.
+	var unsentErr *agent.UnsentCountersError
+	if errors.As(err, &unsentErr) || agent.IsPermanentStatus(err) {
+		rt.counters.Settle(ms.Counters, err)
+		return
+	}
+
+	if !rt.enqueue(ms) {
+		rt.counters.Settle(ms.Counters, err)
+	}
+}
+
+// enqueue сохраняет отчёт в очередь на диске. Счётчики отчёта после этого
+// считаются переданными очереди и списываются из трекера.
+func (rt *agentRuntime) enqueue(ms agent.MetricsSet) bool {
+	if rt.spool == nil {
+		return false
+	}
+	if err := rt.spool.Push(ms); err != nil {
+		log.Printf("failed to spool report: %v", err)
+		return false
+	}
+	rt.counters.Ack(ms.Counters)
+	return true
+}
+
+// replaySpool отправляет отчёты из очереди по порядку, пока сервер их принимает
+func (rt *agentRuntime) replaySpool(ctx context.Context) {
+	for ctx.Err() == nil {
+		seq, ms, ok, err := rt.spool.Peek()
+		if err != nil || !ok {
+			return
+		}
+
+		err = rt.sender.SendMetricsBatch(ctx, ms)
+		var partialErr *agent.PartialBatchError
+		switch {
+		case err == nil:
+			if err := rt.spool.Pop(seq); err != nil {
+				log.Printf("failed to remove replayed report: %v", err)
+				return
+			}
+		case agent.IsPermanentStatus(err):
+			// Сервер никогда не примет этот отчёт — не блокируем им очередь
+			log.Printf("spooled report rejected by server, dropping: %v", err)
+			rt.spool.Drop(seq)
+		case errors.As(err, &partialErr):
+			// Оставляем в очереди только непринятые сервером метрики
+			if err := rt.spool.Replace(seq, partialErr.Failed); err != nil {
+				log.Printf("failed to update partially replayed report: %v", err)
+			}
+			return
+		default:
+			return
+		}
+	}
+}
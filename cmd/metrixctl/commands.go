@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Mihklz/metrixcollector/internal/audit"
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/pkg/client"
+)
+
+// defaultImportBatch — метрик в одном запросе импорта
+const defaultImportBatch = 1000
+
+// newFlagSet создаёт набор флагов команды; ошибки разбора печатаются в stderr
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// listFlags добавляет фильтры списка метрик
+func listFlags(fs *flag.FlagSet) *client.ListOptions {
+	opts := &client.ListOptions{}
+	fs.StringVar(&opts.Type, "type", "", "metric type: gauge or counter")
+	fs.StringVar(&opts.Prefix, "prefix", "", "metric name prefix")
+	fs.StringVar(&opts.Regex, "regex", "", "regular expression for metric names")
+	return opts
+}
+
+// parseFlags разбирает флаги команды и проверяет число позиционных аргументов
+func parseFlags(fs *flag.FlagSet, args []string, positional int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	if fs.NArg() != positional {
+		return nil, errUsage
+	}
+	return fs.Args(), nil
+}
+
+// formatValue возвращает значение метрики в текстовом виде, как в /value/
+func formatValue(m client.Metric) string {
+	switch {
+	case m.Delta != nil:
+		return strconv.FormatInt(*m.Delta, 10)
+	case m.Value != nil:
+		return strconv.FormatFloat(*m.Value, 'f', -1, 64)
+	}
+	return ""
+}
+
+// parseMetric разбирает значение метрики из командной строки
+func parseMetric(metricType, name, value string) (client.Metric, error) {
+	switch metricType {
+	case client.Gauge:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return client.Metric{}, fmt.Errorf("invalid gauge value %q", value)
+		}
+		return client.NewGauge(name, v), nil
+	case client.Counter:
+		d, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return client.Metric{}, fmt.Errorf("invalid counter delta %q", value)
+		}
+		return client.NewCounter(name, d), nil
+	}
+	return client.Metric{}, fmt.Errorf("unknown metric type %q", metricType)
+}
+
+func runGet(ctx context.Context, e *env, args []string) error {
+	args, err := parseFlags(newFlagSet("get"), args, 2)
+	if err != nil {
+		return err
+	}
+	metric, err := e.client.Get(ctx, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.out, formatValue(metric))
+	return nil
+}
+
+func runSet(ctx context.Context, e *env, args []string) error {
+	args, err := parseFlags(newFlagSet("set"), args, 3)
+	if err != nil {
+		return err
+	}
+	metric, err := parseMetric(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	stored, err := e.client.Set(ctx, metric)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.out, formatValue(stored))
+	return nil
+}
+
+func runDelete(ctx context.Context, e *env, args []string) error {
+	args, err := parseFlags(newFlagSet("delete"), args, 2)
+	if err != nil {
+		return err
+	}
+	return e.client.Delete(ctx, args[0], args[1])
+}
+
+func runList(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("list")
+	opts := listFlags(fs)
+	asJSON := fs.Bool("json", false, "print metrics as JSON")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	metrics, err := e.client.ListAll(ctx, *opts)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSON(e.out, metrics)
+	}
+
+	tw := tabwriter.NewWriter(e.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tNAME\tVALUE")
+	for _, m := range metrics {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", m.Type, m.ID, formatValue(m))
+	}
+	return tw.Flush()
+}
+
+// runTail печатает обновления метрик из потока /api/v1/stream
+func runTail(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("tail")
+	opts := client.StreamOptions{}
+	fs.StringVar(&opts.Type, "type", "", "metric type: gauge or counter")
+	fs.StringVar(&opts.Name, "name", "", "exact metric name")
+	fs.StringVar(&opts.Prefix, "prefix", "", "metric name prefix")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	err := e.client.Stream(ctx, opts, func(msg client.StreamMessage) error {
+		ts := msg.Time.Local().Format(time.RFC3339)
+		switch msg.Event {
+		case client.EventMetric:
+			fmt.Fprintf(e.out, "%s\t%s\t%s\t%s\n", ts, msg.Metric.Type, msg.Metric.ID, formatValue(*msg.Metric))
+		case client.EventDropped:
+			fmt.Fprintf(os.Stderr, "%s\t%d updates dropped: reading too slowly\n", ts, msg.Dropped)
+		}
+		return nil
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func runExport(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("export")
+	opts := listFlags(fs)
+	output := fs.String("o", "", "output file (default stdout)")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	metrics, err := e.client.ListAll(ctx, *opts)
+	if err != nil {
+		return err
+	}
+	if metrics == nil {
+		metrics = []client.Metric{}
+	}
+	if *output == "" {
+		return writeJSON(e.out, metrics)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(file, metrics); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// runImport загружает снимок метрик пакетами. У каждого пакета свой ключ
+// идемпотентности, поэтому counter не удваивается при повторе запроса.
+func runImport(ctx context.Context, e *env, args []string) error {
+	fs := newFlagSet("import")
+	input := fs.String("i", "", "input file (default stdin)")
+	batchSize := fs.Int("batch", defaultImportBatch, "metrics per request")
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	if *batchSize <= 0 {
+		return errUsage
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var metrics []client.Metric
+	if err := json.NewDecoder(r).Decode(&metrics); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	var accepted, failed int
+	for start := 0; start < len(metrics); start += *batchSize {
+		chunk := metrics[start:min(start+*batchSize, len(metrics))]
+		key, err := crypto.NewNonce()
+		if err != nil {
+			return err
+		}
+		result, err := e.client.UpdateBatch(ctx, chunk, client.BatchOptions{Partial: true, IdempotencyKey: key})
+		if err != nil {
+			return fmt.Errorf("import metrics %d-%d: %w", start, start+len(chunk)-1, err)
+		}
+		accepted += result.Accepted
+		for _, item := range result.Errors {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %s (%s)\n", item.ID, item.Message, item.Code)
+		}
+	}
+
+	fmt.Fprintf(e.out, "imported %d metrics\n", accepted)
+	if failed > 0 {
+		return fmt.Errorf("%d metrics rejected", failed)
+	}
+	return nil
+}
+
+func runVerifyAudit(_ context.Context, e *env, args []string) error {
+	args, err := parseFlags(newFlagSet("verify-audit"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := audit.VerifyLog(file)
+	if err != nil {
+		return err
+	}
+	for _, p := range report.Problems {
+		fmt.Fprintf(e.out, "line %d: %s\n", p.Line, p.Message)
+	}
+	fmt.Fprintf(e.out, "%d events (%d accepted, %d rejected)", report.Events, report.Accepted, report.Rejected)
+	if report.Events > 0 {
+		fmt.Fprintf(e.out, " from %s to %s",
+			time.Unix(report.FirstTS, 0).UTC().Format(time.RFC3339),
+			time.Unix(report.LastTS, 0).UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintln(e.out)
+
+	if !report.OK() {
+		return fmt.Errorf("%d problems found", len(report.Problems))
+	}
+	return nil
+}
+
+func runHealth(ctx context.Context, e *env, args []string) error {
+	if _, err := parseFlags(newFlagSet("health"), args, 0); err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := e.client.Ping(ctx); err != nil {
+		// Сервер ответил ошибкой: он доступен, но не работает его база данных
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			return fmt.Errorf("%s is reachable, but its database is unavailable: %w", e.cfg.ServerAddr, err)
+		}
+		return fmt.Errorf("%s is unreachable: %w", e.cfg.ServerAddr, err)
+	}
+	fmt.Fprintf(e.out, "%s is healthy (%s)\n", e.cfg.ServerAddr, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// writeJSON печатает значение в JSON с отступами
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
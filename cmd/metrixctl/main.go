@@ -0,0 +1,137 @@
+// Команда metrixctl — клиент командной строки сервера метрик для операторов.
+// Запросы подписываются ключом HMAC так же, как у агента.
+//
+//	metrixctl [флаги] <команда> [параметры]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/Mihklz/metrixcollector/internal/config"
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/pkg/client"
+)
+
+// errUsage — неверные аргументы команды
+var errUsage = errors.New("usage error")
+
+// env — окружение команды
+type env struct {
+	cfg    *config.CtlConfig
+	client *client.Client
+	out    io.Writer
+}
+
+// command — команда metrixctl
+type command struct {
+	usage string // параметры команды
+	help  string // описание
+	run   func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"get":          {"<type> <name>", "print metric value", runGet},
+	"set":          {"<type> <name> <value>", "set gauge value or add counter delta", runSet},
+	"list":         {"[-type t] [-prefix p] [-regex re] [-json]", "list metrics", runList},
+	"delete":       {"<type> <name>", "delete metric", runDelete},
+	"tail":         {"[-type t] [-name n] [-prefix p]", "print metric updates as they happen", runTail},
+	"export":       {"[-o file] [-type t] [-prefix p] [-regex re]", "export metrics snapshot as JSON", runExport},
+	"import":       {"[-i file] [-batch n]", "import metrics snapshot (counters are added)", runImport},
+	"verify-audit": {"<file>", "check audit log format", runVerifyAudit},
+	"health":       {"", "check server and database availability", runHealth},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run выполняет команду и возвращает код завершения:
+// 0 — успех, 1 — ошибка, 2 — неверные аргументы
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("metrixctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { usage(fs, stderr) }
+
+	cfg, rest, err := config.LoadCtlConfig(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(rest) == 0 {
+		usage(fs, stderr)
+		return 2
+	}
+	cmd, ok := commands[rest[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", rest[0])
+		usage(fs, stderr)
+		return 2
+	}
+
+	c, err := newClient(cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "metrixctl: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, &env{cfg: cfg, client: c, out: stdout}, rest[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(stderr, "usage: metrixctl %s %s\n", rest[0], cmd.usage)
+			return 2
+		}
+		fmt.Fprintf(stderr, "metrixctl %s: %v\n", rest[0], err)
+		return 1
+	}
+	return 0
+}
+
+// newClient создаёт клиент сервера по конфигурации
+func newClient(cfg *config.CtlConfig) (*client.Client, error) {
+	httpClient := &http.Client{Timeout: cfg.Timeout}
+	if cfg.TLSEnabled() {
+		tlsConfig, err := crypto.NewClientTLSConfig(cfg.TLSCAFile, cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("configure TLS: %w", err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		httpClient.Transport = transport
+	}
+
+	return client.New(cfg.ServerAddr,
+		client.WithHTTPClient(httpClient),
+		client.WithKey(cfg.Key),
+		client.WithKeyID(cfg.KeyID),
+		client.WithToken(cfg.Token),
+		client.WithTenant(cfg.Tenant),
+	)
+}
+
+// usage печатает справку по флагам и командам
+func usage(fs *flag.FlagSet, w io.Writer) {
+	fmt.Fprintln(w, "usage: metrixctl [flags] <command> [args]")
+	fmt.Fprintln(w, "\nflags:")
+	fs.PrintDefaults()
+	fmt.Fprintln(w, "\ncommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintf(w, "  %s %s\n    \t%s\n", name, cmd.usage, cmd.help)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 
 	"github.com/Mihklz/metrixcollector/internal/app"
 	"github.com/Mihklz/metrixcollector/internal/logger"
@@ -42,7 +43,7 @@ func main() {
 					// Запускаем сервер в горутине
 					go func() {
 						if err := srv.Run(); err != nil {
-							logger.Log.Error("Server run failed")
+							logger.Log.Error("Server run failed", zap.Error(err))
 						}
 					}()
 					return nil
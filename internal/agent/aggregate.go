@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Функции агрегации gauge-метрик за окно отчёта
+const (
+	AggMin  = "min"
+	AggMax  = "max"
+	AggAvg  = "avg"
+	AggLast = "last"
+	AggP95  = "p95"
+)
+
+// AggregationRule задаёт набор функций для метрик с указанным именем.
+// Имя, заканчивающееся на '*', задаёт префикс (например, "CPUutilization*"),
+// а "*" — все gauge-метрики.
+type AggregationRule struct {
+	Pattern   string
+	Functions []string
+}
+
+// matches проверяет, подходит ли правило для метрики
+func (r AggregationRule) matches(name string) bool {
+	if prefix, ok := strings.CutSuffix(r.Pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return r.Pattern == name
+}
+
+// ParseAggregationRules разбирает правила вида
+// "HeapAlloc=max,avg;CPUutilization*=p95".
+func ParseAggregationRules(spec string) ([]AggregationRule, error) {
+	var rules []AggregationRule
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		pattern, funcs, ok := strings.Cut(part, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid aggregation rule %q, expected <metric>=<func>[,<func>]", part)
+		}
+
+		rule := AggregationRule{Pattern: pattern}
+		for _, fn := range strings.Split(funcs, ",") {
+			fn = strings.TrimSpace(fn)
+			switch fn {
+			case AggMin, AggMax, AggAvg, AggLast, AggP95:
+				rule.Functions = append(rule.Functions, fn)
+			default:
+				return nil, fmt.Errorf("unknown aggregation function %q in rule %q", fn, part)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Aggregator накапливает значения gauge-метрик за окно отчёта и
+// выдаёт производные метрики вида <name>.<func> (например, HeapAlloc.max).
+// Без агрегации до сервера доходит только последний опрос окна и всплески не видны.
+type Aggregator struct {
+	rules []AggregationRule
+
+	mu      sync.Mutex
+	samples map[string][]float64
+}
+
+// NewAggregator создаёт агрегатор с заданными правилами.
+func NewAggregator(rules []AggregationRule) *Aggregator {
+	return &Aggregator{
+		rules:   rules,
+		samples: make(map[string][]float64),
+	}
+}
+
+// Observe добавляет значения одного опроса.
+func (a *Aggregator) Observe(gauges map[string]float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for name, v := range gauges {
+		if math.IsNaN(v) || len(a.functionsFor(name)) == 0 {
+			continue
+		}
+		a.samples[name] = append(a.samples[name], v)
+	}
+}
+
+// Flush возвращает агрегаты за окно и начинает новое окно.
+func (a *Aggregator) Flush() map[string]float64 {
+	a.mu.Lock()
+	samples := a.samples
+	a.samples = make(map[string][]float64, len(samples))
+	a.mu.Unlock()
+
+	result := make(map[string]float64)
+	for name, values := range samples {
+		if len(values) == 0 {
+			continue
+		}
+		for _, fn := range a.functionsFor(name) {
+			result[name+"."+fn] = aggregate(fn, values)
+		}
+	}
+	return result
+}
+
+// functionsFor возвращает функции из всех подходящих правил без повторов
+func (a *Aggregator) functionsFor(name string) []string {
+	var funcs []string
+	for _, rule := range a.rules {
+		if !rule.matches(name) {
+			continue
+		}
+		for _, fn := range rule.Functions {
+			if !slices.Contains(funcs, fn) {
+				funcs = append(funcs, fn)
+			}
+		}
+	}
+	return funcs
+}
+
+// aggregate вычисляет одну функцию по значениям окна
+func aggregate(fn string, values []float64) float64 {
+	switch fn {
+	case AggMin:
+		minV := values[0]
+		for _, v := range values[1:] {
+			minV = math.Min(minV, v)
+		}
+		return minV
+	case AggMax:
+		maxV := values[0]
+		for _, v := range values[1:] {
+			maxV = math.Max(maxV, v)
+		}
+		return maxV
+	case AggAvg:
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	case AggLast:
+		return values[len(values)-1]
+	case AggP95:
+		return percentile(values, 0.95)
+	}
+	return math.NaN()
+}
+
+// percentile вычисляет перцентиль методом ближайшего ранга
+func percentile(values []float64, p float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAggregationRules(t *testing.T) {
+	rules, err := ParseAggregationRules("HeapAlloc=max, avg; CPUutilization*=p95;")
+	require.NoError(t, err)
+	assert.Equal(t, []AggregationRule{
+		{Pattern: "HeapAlloc", Functions: []string{AggMax, AggAvg}},
+		{Pattern: "CPUutilization*", Functions: []string{AggP95}},
+	}, rules)
+
+	_, err = ParseAggregationRules("HeapAlloc=median")
+	assert.Error(t, err)
+
+	_, err = ParseAggregationRules("HeapAlloc")
+	assert.Error(t, err)
+}
+
+func TestAggregator_Flush(t *testing.T) {
+	agg := NewAggregator([]AggregationRule{
+		{Pattern: "HeapAlloc", Functions: []string{AggMin, AggMax, AggAvg, AggLast}},
+		{Pattern: "CPU*", Functions: []string{AggP95, AggMax}},
+	})
+
+	for i := 1; i <= 20; i++ {
+		agg.Observe(map[string]float64{
+			"HeapAlloc":   float64(i % 5),
+			"CPU1":        float64(i),
+			"RandomValue": 0.5,
+		})
+	}
+
+	result := agg.Flush()
+	assert.Equal(t, map[string]float64{
+		"HeapAlloc.min":  0,
+		"HeapAlloc.max":  4,
+		"HeapAlloc.avg":  2,
+		"HeapAlloc.last": 0,
+		"CPU1.p95":       19,
+		"CPU1.max":       20,
+	}, result)
+
+	// Новое окно начинается пустым
+	assert.Empty(t, agg.Flush())
+}
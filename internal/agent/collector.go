@@ -5,20 +5,23 @@ import (
 	"runtime"
 )
 
+// MetricsSet — набор метрик для отправки.
+// Counters содержат приращения (delta), которые сервер прибавит к своим значениям.
+// ID идентифицирует отчёт: сервер по нему отбрасывает повторную доставку пакета.
 type MetricsSet struct {
-	Gauges    map[string]float64
-	PollCount int64
+	ID       string
+	Gauges   map[string]float64
+	Counters map[string]int64
 }
 
-var pollCount int64
-
+// Collect снимает runtime-метрики. Каждый вызов — один опрос,
+// поэтому PollCount возвращается как приращение на 1.
 func Collect() MetricsSet {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
-	pollCount++
 
 	return MetricsSet{
-		PollCount: pollCount,
+		Counters: map[string]int64{"PollCount": 1},
 		Gauges: map[string]float64{
 			"Alloc":         float64(m.Alloc),
 			"BuckHashSys":   float64(m.BuckHashSys),
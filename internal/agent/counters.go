@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// UnsentCountersError сообщает, какие counter-приращения сервер не подтвердил.
+// Остальные приращения из отправленного набора считаются доставленными.
+type UnsentCountersError struct {
+	Counters map[string]int64
+	Err      error
+}
+
+// Error возвращает текст ошибки.
+func (e *UnsentCountersError) Error() string {
+	return fmt.Sprintf("%d counters not delivered: %v", len(e.Counters), e.Err)
+}
+
+// Unwrap возвращает исходную ошибку отправки.
+func (e *UnsentCountersError) Unwrap() error {
+	return e.Err
+}
+
+// CounterTracker накапливает приращения counter-метрик с момента последней
+// подтверждённой сервером отправки.
+//
+// Сервер складывает присланные delta, поэтому агент должен отправлять только
+// то, что ещё не было подтверждено. Snapshot переносит накопленные приращения
+// в «отправляемые», после ответа сервера они либо окончательно списываются
+// (Ack), либо возвращаются в накопление (Rollback) и уйдут со следующим отчётом.
+type CounterTracker struct {
+	mu       sync.Mutex
+	pending  map[string]int64 // накоплено и ещё не отправлялось
+	inflight map[string]int64 // отправлено, ждём подтверждения
+}
+
+// NewCounterTracker создаёт пустой трекер счётчиков.
+func NewCounterTracker() *CounterTracker {
+	return &CounterTracker{
+		pending:  make(map[string]int64),
+		inflight: make(map[string]int64),
+	}
+}
+
+// Add добавляет приращение счётчика.
+func (t *CounterTracker) Add(name string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending[name] += delta
+}
+
+// AddAll добавляет набор приращений.
+func (t *CounterTracker) AddAll(deltas map[string]int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, delta := range deltas {
+		if delta != 0 {
+			t.pending[name] += delta
+		}
+	}
+}
+
+// Snapshot забирает накопленные приращения для отправки.
+// Возвращённые значения нужно закрыть вызовом Ack, Rollback или Settle.
+func (t *CounterTracker) Snapshot() map[string]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := make(map[string]int64, len(t.pending))
+	for name, delta := range t.pending {
+		snapshot[name] = delta
+		t.inflight[name] += delta
+	}
+	t.pending = make(map[string]int64)
+	return snapshot
+}
+
+// Ack списывает приращения, подтверждённые сервером.
+func (t *CounterTracker) Ack(sent map[string]int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, delta := range sent {
+		t.release(name, delta)
+	}
+}
+
+// Rollback возвращает неподтверждённые приращения в накопление.
+func (t *CounterTracker) Rollback(sent map[string]int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, delta := range sent {
+		t.release(name, delta)
+		t.pending[name] += delta
+	}
+}
+
+// Settle закрывает отправку по результату SendMetrics: при успехе всё
+// подтверждается, при UnsentCountersError откатываются только недоставленные
+// счётчики, при любой другой ошибке откатывается весь набор.
+func (t *CounterTracker) Settle(sent map[string]int64, err error) {
+	if err == nil {
+		t.Ack(sent)
+		return
+	}
+
+	var unsentErr *UnsentCountersError
+	if !errors.As(err, &unsentErr) {
+		t.Rollback(sent)
+		return
+	}
+
+	delivered := make(map[string]int64, len(sent))
+	for name, delta := range sent {
+		if _, failed := unsentErr.Counters[name]; !failed {
+			delivered[name] = delta
+		}
+	}
+	t.Ack(delivered)
+	t.Rollback(unsentErr.Counters)
+}
+
+// Unacknowledged возвращает сумму накопленных и ожидающих подтверждения приращений.
+func (t *CounterTracker) Unacknowledged() map[string]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	total := make(map[string]int64, len(t.pending)+len(t.inflight))
+	for name, delta := range t.pending {
+		total[name] += delta
+	}
+	for name, delta := range t.inflight {
+		total[name] += delta
+	}
+	return total
+}
+
+// release уменьшает счётчик отправляемых приращений (вызывается под мьютексом)
+func (t *CounterTracker) release(name string, delta int64) {
+	t.inflight[name] -= delta
+	if t.inflight[name] == 0 {
+		delete(t.inflight, name)
+	}
+}
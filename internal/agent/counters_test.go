@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mihklz/metrixcollector/internal/config"
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+func TestCounterTracker_AckResetsDelta(t *testing.T) {
+	tracker := NewCounterTracker()
+	tracker.Add("PollCount", 1)
+	tracker.Add("PollCount", 1)
+
+	sent := tracker.Snapshot()
+	assert.Equal(t, map[string]int64{"PollCount": 2}, sent)
+
+	// Пока ответа нет, новые опросы копятся отдельно
+	tracker.Add("PollCount", 1)
+	tracker.Ack(sent)
+
+	assert.Equal(t, map[string]int64{"PollCount": 1}, tracker.Snapshot())
+}
+
+func TestCounterTracker_RollbackKeepsDelta(t *testing.T) {
+	tracker := NewCounterTracker()
+	tracker.AddAll(map[string]int64{"PollCount": 3, "hits": 5})
+
+	sent := tracker.Snapshot()
+	tracker.Add("PollCount", 1)
+	tracker.Rollback(sent)
+
+	assert.Equal(t, map[string]int64{"PollCount": 4, "hits": 5}, tracker.Snapshot())
+}
+
+func TestCounterTracker_Settle(t *testing.T) {
+	tracker := NewCounterTracker()
+	tracker.AddAll(map[string]int64{"a": 1, "b": 2})
+	sent := tracker.Snapshot()
+
+	tracker.Settle(sent, &UnsentCountersError{
+		Counters: map[string]int64{"b": 2},
+		Err:      errors.New("boom"),
+	})
+	assert.Equal(t, map[string]int64{"b": 2}, tracker.Unacknowledged())
+
+	sent = tracker.Snapshot()
+	tracker.Settle(sent, errors.New("network down"))
+	assert.Equal(t, map[string]int64{"b": 2}, tracker.Unacknowledged())
+
+	sent = tracker.Snapshot()
+	tracker.Settle(sent, nil)
+	assert.Empty(t, tracker.Unacknowledged())
+}
+
+func TestMetricsSender_ReportsUnsentCounters(t *testing.T) {
+	// Batch-эндпоинт недоступен, а одиночный отклоняет счётчик "bad"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/updates/" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		var m models.Metrics
+		require.NoError(t, json.NewDecoder(zr).Decode(&m))
+		if m.ID == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sender, err := NewMetricsSender(&config.AgentConfig{ServerAddrs: []string{srv.URL}})
+	require.NoError(t, err)
+	err = sender.SendMetrics(context.Background(), MetricsSet{
+		Counters: map[string]int64{"good": 1, "bad": 2},
+	})
+
+	var unsent *UnsentCountersError
+	require.ErrorAs(t, err, &unsent)
+	assert.Equal(t, map[string]int64{"bad": 2}, unsent.Counters)
+}
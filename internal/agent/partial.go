@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/retry"
+)
+
+// PartialBatchError — сервер сохранил пакет не полностью.
+// Failed содержит метрики, которые стоит отправить повторно;
+// метрики с неисправимыми ошибками уже отброшены.
+type PartialBatchError struct {
+	Failed MetricsSet
+	Errors []models.BatchItemError
+}
+
+// Error возвращает текст ошибки.
+func (e *PartialBatchError) Error() string {
+	return fmt.Sprintf("%d metrics not accepted by server: %s", len(e.Errors), e.Errors[0].Message)
+}
+
+// partialAwareClassifier считает частичный отказ временной ошибкой:
+// повтор отправит только непринятые метрики
+type partialAwareClassifier struct {
+	retry.ErrorClassifier
+}
+
+func (c partialAwareClassifier) Classify(err error) retry.ErrorClassification {
+	if _, ok := err.(*PartialBatchError); ok {
+		return retry.Retriable
+	}
+	return c.ErrorClassifier.Classify(err)
+}
+
+// partialFailures разбирает ответ сервера на пакет sent и возвращает
+// метрики, которые нужно отправить повторно.
+func partialFailures(sent []models.Metrics, response []byte) error {
+	var result models.BatchResult
+	if len(response) > 0 {
+		if err := json.Unmarshal(response, &result); err != nil {
+			// Старый сервер без режима частичного успеха отвечает пустым телом
+			logger.Log.Debug("Batch response is not a batch result", zap.Error(err))
+		}
+	}
+
+	failed := make(map[int]models.BatchItemError, len(result.Errors))
+	for _, itemErr := range result.Errors {
+		if itemErr.Index >= 0 && itemErr.Index < len(sent) {
+			failed[itemErr.Index] = itemErr
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	partialErr := &PartialBatchError{
+		// Остаток — новый пакет, поэтому у него свой ключ идемпотентности
+		Failed: MetricsSet{ID: NewReportID(), Gauges: map[string]float64{}, Counters: map[string]int64{}},
+	}
+	for i, metric := range sent {
+		itemErr, ok := failed[i]
+		if !ok {
+			continue
+		}
+		partialErr.Errors = append(partialErr.Errors, itemErr)
+
+		if !itemErr.Retriable {
+			logger.Log.Warn("Metric rejected by server, dropping",
+				zap.String("id", metric.ID),
+				zap.String("code", itemErr.Code),
+				zap.String("reason", itemErr.Message),
+			)
+			continue
+		}
+		switch {
+		case metric.MType == models.Gauge && metric.Value != nil:
+			partialErr.Failed.Gauges[metric.ID] = *metric.Value
+		case metric.MType == models.Counter && metric.Delta != nil:
+			partialErr.Failed.Counters[metric.ID] = *metric.Delta
+		}
+	}
+
+	// Повторять нечего: все ошибки неисправимы
+	if len(partialErr.Failed.Gauges) == 0 && len(partialErr.Failed.Counters) == 0 {
+		return nil
+	}
+	return partialErr
+}
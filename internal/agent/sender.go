@@ -4,35 +4,134 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/Mihklz/metrixcollector/internal/config"
 	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/idempotency"
 	"github.com/Mihklz/metrixcollector/internal/logger"
 	models "github.com/Mihklz/metrixcollector/internal/model"
 	"github.com/Mihklz/metrixcollector/internal/retry"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
 )
 
+// StatusError — сервер ответил, но не кодом 200.
+type StatusError struct {
+	StatusCode int
+}
+
+// Error возвращает текст ошибки. Текст статуса нужен классификатору retry
+// (например, "503 service unavailable" считается временной ошибкой).
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// IsPermanentStatus сообщает, что сервер отверг данные и повтор того же
+// запроса не поможет (4xx, кроме 408 и 429).
+func IsPermanentStatus(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	code := statusErr.StatusCode
+	return code >= 400 && code < 500 &&
+		code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
+
 type MetricsSender struct {
 	client      *http.Client
-	serverAddr  string
+	targets     *targetSet
 	retryConfig *retry.RetryConfig
-	key         string // ключ для подписи данных
+	key         string             // ключ для подписи данных
+	keyID       string             // идентификатор ключа в связке ключей сервера
+	publicKey   *rsa.PublicKey     // открытый ключ сервера для шифрования (nil — без шифрования)
+	fingerprint string             // отпечаток publicKey
+	signKey     ed25519.PrivateKey // ключ агента для подписи (nil — без подписи)
+	agentID     string
+	token       string   // токен API (пусто — без аутентификации)
+	tenant      string   // арендатор (пусто — арендатор по умолчанию или из токена)
+	outboundIPs sync.Map // адрес сервера -> исходящий IP агента
 }
 
-func NewMetricsSender(serverAddr string, key string) *MetricsSender {
-	return &MetricsSender{
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		serverAddr:  serverAddr,
-		retryConfig: retry.DefaultRetryConfig(),
-		key:         key,
+// NewMetricsSender создаёт отправителя для серверов из конфигурации
+// с учётом режима работы (failover или fanout).
+func NewMetricsSender(cfg *config.AgentConfig) (*MetricsSender, error) {
+	retryConfig := retry.DefaultRetryConfig()
+	retryConfig.Classifier = partialAwareClassifier{retryConfig.Classifier}
+
+	targets, err := newTargetSet(cfg.ServerAddrs, cfg.ServerMode, retryConfig.Classifier)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	// HTTPS: собственный CA и клиентский сертификат для mutual TLS
+	if cfg.TLSEnabled() {
+		tlsConfig, err := crypto.NewClientTLSConfig(cfg.TLSCAFile, cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("configure TLS: %w", err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+	}
+
+	sender := &MetricsSender{
+		client:      client,
+		targets:     targets,
+		retryConfig: retryConfig,
+		key:         cfg.Key,
+		keyID:       cfg.KeyID,
+		agentID:     cfg.AgentID,
+		token:       cfg.Token,
+		tenant:      cfg.Tenant,
+	}
+
+	// Шифруем тела запросов открытым ключом сервера
+	if cfg.CryptoKey != "" {
+		pub, err := crypto.LoadPublicKey(cfg.CryptoKey)
+		if err != nil {
+			return nil, fmt.Errorf("load crypto key: %w", err)
+		}
+		sender.publicKey = pub
+		sender.fingerprint = crypto.KeyFingerprint(pub)
+	}
+
+	// Подписываем запросы собственным ключом агента
+	if cfg.SignKey != "" {
+		if cfg.AgentID == "" {
+			return nil, errors.New("agent ID is required for signing requests")
+		}
+		signKey, err := crypto.LoadSigningKey(cfg.SignKey)
+		if err != nil {
+			return nil, fmt.Errorf("load sign key: %w", err)
+		}
+		sender.signKey = signKey
 	}
+
+	return sender, nil
+}
+
+// Health возвращает состояние серверов назначения.
+func (s *MetricsSender) Health() []TargetHealth {
+	return s.targets.health()
 }
 
 // compressData сжимает данные в формате gzip
@@ -53,40 +152,101 @@ func compressData(data []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// NewReportID возвращает случайный идентификатор отчёта для заголовка Idempotency-Key.
+// Пустой идентификатор (не удалось получить случайные данные) отключает дедупликацию.
+func NewReportID() string {
+	id, err := crypto.NewNonce()
+	if err != nil {
+		logger.Log.Warn("Failed to generate report ID", zap.Error(err))
+		return ""
+	}
+	return id
+}
+
 func (s *MetricsSender) SendMetrics(ctx context.Context, metrics MetricsSet) error {
-	// Пытаемся отправить всё одним batch запросом с retry-логикой
+	// Все повторы отчёта идут с одним ключом идемпотентности, чтобы сервер
+	// не применил дважды пакет, ответ на который не дошёл до агента
+	if metrics.ID == "" {
+		metrics.ID = NewReportID()
+	}
+	// Пытаемся отправить всё одним batch запросом с retry-логикой.
+	// Если сервер принял пакет частично, повторяем только непринятые метрики.
+	pending := metrics
 	err := retry.Execute(ctx, s.retryConfig, func() error {
-		return s.SendMetricsBatch(ctx, metrics)
+		err := s.SendMetricsBatch(ctx, pending)
+		var partialErr *PartialBatchError
+		if errors.As(err, &partialErr) {
+			pending = partialErr.Failed
+		}
+		return err
 	})
 
+	var partialErr *PartialBatchError
+	if errors.As(err, &partialErr) {
+		return &UnsentCountersError{Counters: partialErr.Failed.Counters, Err: err}
+	}
+
 	if err != nil {
+		// Если сервер недоступен, поштучная отправка тоже не пройдёт —
+		// возвращаем ошибку сразу, чтобы агент сохранил отчёт в очередь
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			return err
+		}
+		// Поштучная отправка только увеличит число запросов сверх лимита
+		if statusErr.StatusCode == http.StatusTooManyRequests {
+			return err
+		}
+
 		logger.Log.Warn("Batch send failed after retries, falling back to individual requests", zap.Error(err))
 
 		// Fallback на отдельные запросы для обратной совместимости
-		return s.sendMetricsIndividually(ctx, metrics)
+		if s.targets.mode == ModeFanout {
+			return s.targets.fanout(ctx, metrics, s.sendIndividuallyTo)
+		}
+		return s.sendMetricsIndividually(ctx, metrics, s.send)
 	}
 
 	return nil
 }
 
-// SendMetricsBatch отправляет все метрики одним batch запросом
+// SendMetricsBatch отправляет все метрики одним batch запросом в режиме
+// частичного успеха. Если сервер принял не все метрики, возвращает
+// *PartialBatchError с метриками, которые стоит отправить повторно.
+// ID отчёта передаётся в заголовке Idempotency-Key, а метрики упорядочены
+// по имени, чтобы повтор отчёта совпадал с первой попыткой байт в байт.
+//
+// В режиме fanout непринятое серверами откладывается для них самих
+// (см. targetSet.fanout), поэтому *PartialBatchError не возвращается.
 func (s *MetricsSender) SendMetricsBatch(ctx context.Context, metrics MetricsSet) error {
-	if len(metrics.Gauges) == 0 && metrics.PollCount == 0 {
+	if len(metrics.Gauges) == 0 && len(metrics.Counters) == 0 {
 		return nil // Не отправляем пустые батчи
 	}
+	if s.targets.mode == ModeFanout {
+		return s.targets.fanout(ctx, metrics, s.sendBatchTo)
+	}
+	return s.sendBatch(ctx, metrics, s.send)
+}
 
+// sendBatchTo отправляет пакет на один сервер addr
+func (s *MetricsSender) sendBatchTo(ctx context.Context, addr string, metrics MetricsSet) error {
+	return s.sendBatch(ctx, metrics, s.sendTo(addr))
+}
+
+// sendBatch собирает пакет и отправляет его функцией send
+func (s *MetricsSender) sendBatch(ctx context.Context, metrics MetricsSet, send sendFunc) error {
 	// Собираем все метрики в один слайс
 	var allMetrics []models.Metrics
 
 	// Добавляем gauge метрики
-	for name, value := range metrics.Gauges {
+	for _, name := range sortedKeys(metrics.Gauges) {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
-		v := value // создаём копию для указателя
+		v := metrics.Gauges[name] // создаём копию для указателя
 		allMetrics = append(allMetrics, models.Metrics{
 			ID:    name,
 			MType: models.Gauge,
@@ -94,11 +254,11 @@ func (s *MetricsSender) SendMetricsBatch(ctx context.Context, metrics MetricsSet
 		})
 	}
 
-	// Добавляем counter метрику
-	if metrics.PollCount > 0 {
-		delta := metrics.PollCount
+	// Добавляем counter метрики (приращения с последней подтверждённой отправки)
+	for _, name := range sortedKeys(metrics.Counters) {
+		delta := metrics.Counters[name]
 		allMetrics = append(allMetrics, models.Metrics{
-			ID:    "PollCount",
+			ID:    name,
 			MType: models.Counter,
 			Delta: &delta,
 		})
@@ -110,44 +270,30 @@ func (s *MetricsSender) SendMetricsBatch(ctx context.Context, metrics MetricsSet
 		return fmt.Errorf("marshal batch metrics error: %w", err)
 	}
 
-	// Сжимаем данные в gzip
-	compressedData, err := compressData(jsonData)
-	if err != nil {
-		return fmt.Errorf("compress batch data error: %w", err)
+	// Отправляем POST запрос к /updates/
+	header := http.Header{models.BatchModeHeader: {models.BatchModePartial}}
+	if metrics.ID != "" {
+		header.Set(idempotency.Header, metrics.ID)
 	}
-
-	// Создаём POST запрос к /updates/
-	url := fmt.Sprintf("%s/updates/", s.serverAddr)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(compressedData))
+	response, err := send(ctx, "/updates/", jsonData, header)
 	if err != nil {
-		return fmt.Errorf("create batch request error: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Content-Encoding", "gzip")
-	req.Header.Set("Accept-Encoding", "gzip")
-
-	// Добавляем хеш в заголовок, если есть ключ
-	if s.key != "" {
-		hash := crypto.CalculateHMAC(jsonData, s.key)
-		req.Header.Set("HashSHA256", hash)
-	}
-
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("send batch error: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if err := partialFailures(allMetrics, response); err != nil {
+		return err
 	}
 
 	logger.Log.Info("Batch metrics sent successfully", zap.Int("count", len(allMetrics)))
 	return nil
 }
 
-// sendMetricsIndividually отправляет метрики по одной (fallback)
-func (s *MetricsSender) sendMetricsIndividually(ctx context.Context, metrics MetricsSet) error {
+// sendIndividuallyTo отправляет метрики по одной на сервер addr (fallback в режиме fanout)
+func (s *MetricsSender) sendIndividuallyTo(ctx context.Context, addr string, metrics MetricsSet) error {
+	return s.sendMetricsIndividually(ctx, metrics, s.sendTo(addr))
+}
+
+// sendMetricsIndividually отправляет метрики по одной функцией send (fallback)
+func (s *MetricsSender) sendMetricsIndividually(ctx context.Context, metrics MetricsSet, send sendFunc) error {
 	// Отправляем gauge метрики с retry-логикой
 	for name, value := range metrics.Gauges {
 		select {
@@ -157,7 +303,7 @@ func (s *MetricsSender) sendMetricsIndividually(ctx context.Context, metrics Met
 		}
 
 		err := retry.Execute(ctx, s.retryConfig, func() error {
-			return s.sendGauge(name, value)
+			return s.sendGauge(ctx, send, name, value)
 		})
 
 		if err != nil {
@@ -170,30 +316,40 @@ func (s *MetricsSender) sendMetricsIndividually(ctx context.Context, metrics Met
 		}
 	}
 
-	// Отправляем counter метрику с retry-логикой
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
-	}
+	// Отправляем counter метрики с retry-логикой.
+	// Запоминаем недоставленные приращения, чтобы агент отправил их повторно.
+	unsent := make(map[string]int64)
+	var lastErr error
+	for name, value := range metrics.Counters {
+		if ctx.Err() != nil {
+			unsent[name] = value
+			lastErr = ctx.Err()
+			continue
+		}
 
-	err := retry.Execute(ctx, s.retryConfig, func() error {
-		return s.sendCounter("PollCount", metrics.PollCount)
-	})
+		err := retry.Execute(ctx, s.retryConfig, func() error {
+			return s.sendCounter(ctx, send, name, value)
+		})
 
-	if err != nil {
-		logger.Log.Error("Failed to send counter metric after retries",
-			zap.String("name", "PollCount"),
-			zap.Int64("value", metrics.PollCount),
-			zap.Error(err),
-		)
-		return err
+		if err != nil {
+			logger.Log.Error("Failed to send counter metric after retries",
+				zap.String("name", name),
+				zap.Int64("value", value),
+				zap.Error(err),
+			)
+			unsent[name] = value
+			lastErr = err
+		}
+	}
+
+	if len(unsent) > 0 {
+		return &UnsentCountersError{Counters: unsent, Err: lastErr}
 	}
 
 	return nil
 }
 
-func (s *MetricsSender) sendGauge(name string, value float64) error {
+func (s *MetricsSender) sendGauge(ctx context.Context, send sendFunc, name string, value float64) error {
 	// Создаём структуру для JSON API
 	metric := models.Metrics{
 		ID:    name,
@@ -207,86 +363,208 @@ func (s *MetricsSender) sendGauge(name string, value float64) error {
 		return fmt.Errorf("marshal gauge metric error: %w", err)
 	}
 
-	// Сжимаем данные в gzip
+	_, err = send(ctx, "/update", jsonData, nil)
+	return err
+}
+
+func (s *MetricsSender) sendCounter(ctx context.Context, send sendFunc, name string, value int64) error {
+	// Создаём структуру для JSON API
+	metric := models.Metrics{
+		ID:    name,
+		MType: models.Counter,
+		Delta: &value,
+	}
+
+	// Сериализуем в JSON
+	jsonData, err := json.Marshal(metric)
+	if err != nil {
+		return fmt.Errorf("marshal counter metric error: %w", err)
+	}
+
+	_, err = send(ctx, "/update", jsonData, nil)
+	return err
+}
+
+// sortedKeys возвращает имена метрик по возрастанию
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for name := range m {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sendFunc отправляет JSON по пути path и возвращает тело ответа сервера
+type sendFunc func(ctx context.Context, path string, jsonData []byte, header http.Header) ([]byte, error)
+
+// send отправляет JSON на серверы назначения в режиме failover
+// и возвращает тело ответа принявшего сервера
+func (s *MetricsSender) send(ctx context.Context, path string, jsonData []byte, header http.Header) ([]byte, error) {
+	body, err := s.encodeBody(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	var response []byte
+	err = s.targets.failover(ctx, func(addr string) error {
+		response, err = s.postTo(ctx, addr, path, header, jsonData, body)
+		return err
+	})
+	return response, err
+}
+
+// sendTo возвращает функцию отправки на один сервер addr
+func (s *MetricsSender) sendTo(addr string) sendFunc {
+	return func(ctx context.Context, path string, jsonData []byte, header http.Header) ([]byte, error) {
+		body, err := s.encodeBody(jsonData)
+		if err != nil {
+			return nil, err
+		}
+		return s.postTo(ctx, addr, path, header, jsonData, body)
+	}
+}
+
+// encodeBody сжимает JSON и, если задан ключ сервера, шифрует его
+func (s *MetricsSender) encodeBody(jsonData []byte) ([]byte, error) {
 	compressedData, err := compressData(jsonData)
 	if err != nil {
-		return fmt.Errorf("compress gauge data error: %w", err)
+		return nil, fmt.Errorf("compress data error: %w", err)
+	}
+
+	// Шифруем уже сжатые данные: зашифрованные данные не сжимаются
+	if s.publicKey != nil {
+		compressedData, err = crypto.Encrypt(s.publicKey, compressedData)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt data error: %w", err)
+		}
 	}
+	return compressedData, nil
+}
 
-	// Создаём POST запрос к /update
-	url := fmt.Sprintf("%s/update", s.serverAddr)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(compressedData))
+// postTo выполняет один POST запрос к одному серверу и возвращает тело ответа
+func (s *MetricsSender) postTo(ctx context.Context, addr, path string, header http.Header, jsonData, compressedData []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+path, bytes.NewReader(compressedData))
 	if err != nil {
-		return fmt.Errorf("create gauge request error: %w", err)
+		return nil, fmt.Errorf("create request error: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Content-Encoding", "gzip")
 	req.Header.Set("Accept-Encoding", "gzip")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	if s.tenant != "" {
+		req.Header.Set(tenant.Header, s.tenant)
+	}
+	// Сервер пускает обновления только из доверенных подсетей
+	if ip := s.outboundIP(addr); ip != "" {
+		req.Header.Set("X-Real-IP", ip)
+	}
+	if s.publicKey != nil {
+		req.Header.Set(crypto.EncryptionHeader, crypto.EncryptionScheme)
+		req.Header.Set(crypto.KeyFingerprintHeader, s.fingerprint)
+	}
+
+	// Время и nonce входят в подпись и защищают от повтора запроса
+	payload := jsonData
+	if s.key != "" || s.signKey != nil {
+		nonce, err := crypto.NewNonce()
+		if err != nil {
+			return nil, err
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(crypto.TimestampHeader, timestamp)
+		req.Header.Set(crypto.NonceHeader, nonce)
+		payload = crypto.SignedPayload(timestamp, nonce, jsonData)
+	}
 
 	// Добавляем хеш в заголовок, если есть ключ
 	if s.key != "" {
-		hash := crypto.CalculateHMAC(jsonData, s.key)
+		hash := crypto.CalculateHMAC(payload, s.key)
 		req.Header.Set("HashSHA256", hash)
+		if s.keyID != "" {
+			req.Header.Set(crypto.KeyIDHeader, s.keyID)
+		}
+	}
+
+	// Добавляем подпись агента
+	if s.agentID != "" {
+		req.Header.Set(crypto.AgentIDHeader, s.agentID)
+	}
+	if s.signKey != nil {
+		req.Header.Set(crypto.SignatureHeader, crypto.SignEd25519(payload, s.signKey))
 	}
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("send gauge error: %w", err)
+		return nil, fmt.Errorf("send request error: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
-	return nil
+	return readResponseBody(resp)
 }
 
-func (s *MetricsSender) sendCounter(name string, value int64) error {
-	// Создаём структуру для JSON API
-	metric := models.Metrics{
-		ID:    name,
-		MType: models.Counter,
-		Delta: &value,
+// readResponseBody читает тело ответа. Accept-Encoding выставлен вручную,
+// поэтому сжатый ответ распаковываем сами.
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	body := io.Reader(resp.Body)
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read response error: %w", err)
+		}
+		defer zr.Close()
+		body = zr
 	}
 
-	// Сериализуем в JSON
-	jsonData, err := json.Marshal(metric)
+	data, err := io.ReadAll(body)
 	if err != nil {
-		return fmt.Errorf("marshal counter metric error: %w", err)
+		return nil, fmt.Errorf("read response error: %w", err)
 	}
+	return data, nil
+}
 
-	// Сжимаем данные в gzip
-	compressedData, err := compressData(jsonData)
-	if err != nil {
-		return fmt.Errorf("compress counter data error: %w", err)
+// outboundIP возвращает IP, с которого агент обращается к серверу.
+// Адрес определяется по таблице маршрутизации (UDP-сокет без отправки пакетов)
+// и запоминается для каждого сервера.
+func (s *MetricsSender) outboundIP(addr string) string {
+	if ip, ok := s.outboundIPs.Load(addr); ok {
+		return ip.(string)
 	}
 
-	// Создаём POST запрос к /update
-	url := fmt.Sprintf("%s/update", s.serverAddr)
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(compressedData))
+	u, err := url.Parse(addr)
 	if err != nil {
-		return fmt.Errorf("create counter request error: %w", err)
+		return ""
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Content-Encoding", "gzip")
-	req.Header.Set("Accept-Encoding", "gzip")
-
-	// Добавляем хеш в заголовок, если есть ключ
-	if s.key != "" {
-		hash := crypto.CalculateHMAC(jsonData, s.key)
-		req.Header.Set("HashSHA256", hash)
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
 	}
 
-	resp, err := s.client.Do(req)
+	conn, err := net.Dial("udp", host)
 	if err != nil {
-		return fmt.Errorf("send counter error: %w", err)
+		logger.Log.Warn("Failed to determine outbound IP", zap.String("server", addr), zap.Error(err))
+		return ""
 	}
-	defer resp.Body.Close()
+	defer conn.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	udpAddr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return ""
 	}
-
-	return nil
+	ip := udpAddr.IP.String()
+	s.outboundIPs.Store(addr, ip)
+	return ip
 }
@@ -0,0 +1,241 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mihklz/metrixcollector/internal/config"
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/idempotency"
+	"github.com/Mihklz/metrixcollector/internal/middleware"
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+func TestMetricsSender_TLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	// Самоподписанный сертификат тестового сервера служит CA для агента
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	ms := MetricsSet{Gauges: map[string]float64{"Alloc": 1}}
+
+	sender, err := NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{srv.URL},
+		TLSCAFile:   caFile,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, sender.SendMetricsBatch(context.Background(), ms))
+
+	// Без CA агент не доверяет серверу
+	untrusted, err := NewMetricsSender(&config.AgentConfig{ServerAddrs: []string{srv.URL}})
+	require.NoError(t, err)
+	assert.Error(t, untrusted.SendMetricsBatch(context.Background(), ms))
+
+	_, err = NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{srv.URL},
+		TLSCAFile:   filepath.Join(t.TempDir(), "missing.pem"),
+	})
+	assert.Error(t, err)
+}
+
+func TestMetricsSender_EncryptsPayload(t *testing.T) {
+	serverKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var received []models.Metrics
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := httptest.NewServer(middleware.WithDecryption(serverKey)(middleware.WithGzip(handler)))
+	defer srv.Close()
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&serverKey.PublicKey)
+	require.NoError(t, err)
+	pubFile := filepath.Join(t.TempDir(), "public.pem")
+	require.NoError(t, os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600))
+
+	sender, err := NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{srv.URL},
+		CryptoKey:   pubFile,
+	})
+	require.NoError(t, err)
+	require.NoError(t, sender.SendMetricsBatch(context.Background(), MetricsSet{Gauges: map[string]float64{"Alloc": 1}}))
+	require.Len(t, received, 1)
+	assert.Equal(t, "Alloc", received[0].ID)
+
+	// Сервер с другим ключом отвечает понятной ошибкой
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other := httptest.NewServer(middleware.WithDecryption(otherKey)(middleware.WithGzip(handler)))
+	defer other.Close()
+
+	sender, err = NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{other.URL},
+		CryptoKey:   pubFile,
+	})
+	require.NoError(t, err)
+	err = sender.SendMetricsBatch(context.Background(), MetricsSet{Gauges: map[string]float64{"Alloc": 1}})
+	assert.True(t, IsPermanentStatus(err))
+}
+
+func TestMetricsSender_SignsWithAgentKey(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "agent.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	var agentID string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agentID, _ = middleware.AgentIDFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+	registry := crypto.NewAgentRegistry(map[string]ed25519.PublicKey{"web-1": pub})
+	srv := httptest.NewServer(middleware.WithGzip(middleware.WithSignatureValidation(registry, true)(handler)))
+	defer srv.Close()
+
+	ms := MetricsSet{Gauges: map[string]float64{"Alloc": 1}}
+
+	sender, err := NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{srv.URL},
+		SignKey:     keyFile,
+		AgentID:     "web-1",
+	})
+	require.NoError(t, err)
+	require.NoError(t, sender.SendMetricsBatch(context.Background(), ms))
+	assert.Equal(t, "web-1", agentID)
+
+	// Чужой идентификатор с тем же ключом не принимается
+	impostor, err := NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{srv.URL},
+		SignKey:     keyFile,
+		AgentID:     "web-2",
+	})
+	require.NoError(t, err)
+	assert.True(t, IsPermanentStatus(impostor.SendMetricsBatch(context.Background(), ms)))
+
+	// Без подписи сервер отклоняет запрос
+	unsigned, err := NewMetricsSender(&config.AgentConfig{ServerAddrs: []string{srv.URL}})
+	require.NoError(t, err)
+	assert.True(t, IsPermanentStatus(unsigned.SendMetricsBatch(context.Background(), ms)))
+}
+
+func TestMetricsSender_SetsOutboundIP(t *testing.T) {
+	var realIP string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realIP = r.Header.Get("X-Real-IP")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sender, err := NewMetricsSender(&config.AgentConfig{ServerAddrs: []string{srv.URL}})
+	require.NoError(t, err)
+	require.NoError(t, sender.SendMetricsBatch(context.Background(), MetricsSet{Gauges: map[string]float64{"Alloc": 1}}))
+
+	// До сервера на localhost агент ходит с loopback-адреса
+	assert.Equal(t, "127.0.0.1", realIP)
+}
+
+func TestMetricsSender_ResendsOnlyFailedItems(t *testing.T) {
+	var batches [][]models.Metrics
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, models.BatchModePartial, r.Header.Get(models.BatchModeHeader))
+		var batch []models.Metrics
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		batches = append(batches, batch)
+
+		// В первый раз счётчик не сохраняется из-за временного сбоя,
+		// а метрика Bad отклоняется окончательно
+		result := models.BatchResult{}
+		for i, metric := range batch {
+			switch {
+			case metric.ID == "Bad":
+				result.Errors = append(result.Errors, models.BatchItemError{Index: i, ID: metric.ID, Code: "invalid_value"})
+			case metric.ID == "PollCount" && len(batches) == 1:
+				result.Errors = append(result.Errors, models.BatchItemError{Index: i, ID: metric.ID, Code: "storage_error", Retriable: true})
+			default:
+				result.Accepted++
+			}
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(result))
+	})
+	srv := httptest.NewServer(middleware.WithGzip(handler))
+	defer srv.Close()
+
+	sender, err := NewMetricsSender(&config.AgentConfig{ServerAddrs: []string{srv.URL}})
+	require.NoError(t, err)
+	sender.retryConfig.Delays = []time.Duration{time.Millisecond}
+
+	err = sender.SendMetrics(context.Background(), MetricsSet{
+		Gauges:   map[string]float64{"Alloc": 1, "Bad": 2},
+		Counters: map[string]int64{"PollCount": 5},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, batches, 2)
+	assert.Len(t, batches[0], 3)
+	require.Len(t, batches[1], 1)
+	assert.Equal(t, "PollCount", batches[1][0].ID)
+	assert.Equal(t, int64(5), *batches[1][0].Delta)
+}
+
+func TestMetricsSender_RetriesWithSameIdempotencyKey(t *testing.T) {
+	var keys []string
+	var bodies []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		keys = append(keys, r.Header.Get(idempotency.Header))
+		bodies = append(bodies, string(body))
+		// Первая попытка «не дошла» до агента
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := httptest.NewServer(middleware.WithGzip(handler))
+	defer srv.Close()
+
+	sender, err := NewMetricsSender(&config.AgentConfig{ServerAddrs: []string{srv.URL}})
+	require.NoError(t, err)
+	sender.retryConfig.Delays = []time.Duration{time.Millisecond}
+
+	ms := MetricsSet{
+		Gauges:   map[string]float64{"Alloc": 1, "HeapAlloc": 2, "Sys": 3},
+		Counters: map[string]int64{"PollCount": 5},
+	}
+	require.NoError(t, sender.SendMetrics(context.Background(), ms))
+
+	require.Len(t, keys, 2)
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	assert.Equal(t, bodies[0], bodies[1])
+
+	// Следующий отчёт получает новый ключ
+	require.NoError(t, sender.SendMetrics(context.Background(), ms))
+	require.Len(t, keys, 3)
+	assert.NotEqual(t, keys[0], keys[2])
+}
@@ -0,0 +1,351 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/logger"
+)
+
+// spoolFileExt — расширение файлов с отчётами в каталоге очереди
+const spoolFileExt = ".batch"
+
+// SpoolConfig задаёт каталог и ограничения очереди неотправленных отчётов.
+type SpoolConfig struct {
+	Dir      string        // каталог для файлов очереди
+	MaxBytes int64         // максимальный суммарный размер файлов (0 — без ограничения)
+	MaxAge   time.Duration // максимальный возраст отчёта (0 — без ограничения)
+}
+
+// SpoolStats — состояние очереди и счётчики потерь.
+type SpoolStats struct {
+	Batches        int   // отчётов в очереди
+	Bytes          int64 // суммарный размер файлов
+	DroppedBatches int64 // отброшено отчётов за всё время работы
+	DroppedMetrics int64 // отброшено метрик в этих отчётах
+}
+
+// spoolRecord — формат файла с одним отчётом
+type spoolRecord struct {
+	ID        string             `json:"id,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	Gauges    map[string]float64 `json:"gauges,omitempty"`
+	Counters  map[string]int64   `json:"counters,omitempty"`
+}
+
+// spoolEntry — описание файла очереди в памяти
+type spoolEntry struct {
+	seq       uint64
+	path      string
+	size      int64
+	createdAt time.Time
+	metrics   int
+}
+
+// Spool — ограниченная очередь неотправленных отчётов на диске.
+//
+// Каждый отчёт хранится в отдельном файле с возрастающим номером, поэтому
+// порядок сохраняется между перезапусками агента. При превышении размера
+// или возраста отбрасываются самые старые отчёты.
+type Spool struct {
+	cfg SpoolConfig
+
+	mu             sync.Mutex
+	entries        []spoolEntry // от старых к новым
+	bytes          int64
+	nextSeq        uint64
+	droppedBatches int64
+	droppedMetrics int64
+}
+
+// OpenSpool открывает (или создаёт) очередь в каталоге cfg.Dir
+// и подхватывает отчёты, оставшиеся от предыдущего запуска.
+func OpenSpool(cfg SpoolConfig) (*Spool, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+
+	s := &Spool{cfg: cfg}
+
+	files, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spool dir: %w", err)
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), spoolFileExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), spoolFileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(cfg.Dir, f.Name())
+		record, size, err := readSpoolRecord(path)
+		if err != nil {
+			// Повреждённый файл (например, после сбоя питания) — отбрасываем
+			logger.Log.Warn("Dropping corrupted spool file", zap.String("file", path), zap.Error(err))
+			os.Remove(path)
+			s.droppedBatches++
+			continue
+		}
+
+		s.entries = append(s.entries, spoolEntry{
+			seq:       seq,
+			path:      path,
+			size:      size,
+			createdAt: record.CreatedAt,
+			metrics:   len(record.Gauges) + len(record.Counters),
+		})
+		s.bytes += size
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].seq < s.entries[j].seq })
+
+	s.mu.Lock()
+	s.enforceLimits(time.Now())
+	s.mu.Unlock()
+
+	return s, nil
+}
+
+// Push сохраняет отчёт в конец очереди.
+func (s *Spool) Push(ms MetricsSet) error {
+	record := spoolRecord{
+		ID:        ms.ID,
+		CreatedAt: time.Now(),
+		Gauges:    ms.Gauges,
+		Counters:  ms.Counters,
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal spool record: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := s.nextSeq
+	path := filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", seq, spoolFileExt))
+
+	if err := writeSpoolFile(path, data); err != nil {
+		return err
+	}
+
+	s.nextSeq++
+	s.entries = append(s.entries, spoolEntry{
+		seq:       seq,
+		path:      path,
+		size:      int64(len(data)),
+		createdAt: record.CreatedAt,
+		metrics:   len(ms.Gauges) + len(ms.Counters),
+	})
+	s.bytes += int64(len(data))
+
+	s.enforceLimits(record.CreatedAt)
+	return nil
+}
+
+// Peek возвращает самый старый отчёт и его номер, не удаляя отчёт из очереди.
+// Номер передаётся в Pop или Drop: пока отчёт отправляется, его могут вытеснить
+// новые отчёты, и тогда удалять из очереди уже нечего.
+func (s *Spool) Peek() (uint64, MetricsSet, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enforceLimits(time.Now())
+
+	for len(s.entries) > 0 {
+		entry := s.entries[0]
+		record, _, err := readSpoolRecord(entry.path)
+		if err != nil {
+			logger.Log.Warn("Dropping unreadable spool file", zap.String("file", entry.path), zap.Error(err))
+			s.dropOldest()
+			continue
+		}
+		return entry.seq, MetricsSet{ID: record.ID, Gauges: record.Gauges, Counters: record.Counters}, true, nil
+	}
+
+	return 0, MetricsSet{}, false, nil
+}
+
+// Pop удаляет отчёт с номером seq после успешной отправки.
+// Если отчёт уже вытеснен из очереди, ничего не делает.
+func (s *Spool) Pop(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isHead(seq) {
+		return nil
+	}
+	entry := s.entries[0]
+	s.entries = s.entries[1:]
+	s.bytes -= entry.size
+	if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove spool file: %w", err)
+	}
+	return nil
+}
+
+// Replace заменяет отчёт с номером seq его остатком, сохраняя место в очереди
+// и время создания. Используется, когда сервер принял отчёт частично.
+// Если отчёт уже вытеснен из очереди, ничего не делает: его потеря учтена в статистике.
+func (s *Spool) Replace(seq uint64, ms MetricsSet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isHead(seq) {
+		return nil
+	}
+	entry := &s.entries[0]
+	record := spoolRecord{
+		ID:        ms.ID,
+		CreatedAt: entry.createdAt,
+		Gauges:    ms.Gauges,
+		Counters:  ms.Counters,
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal spool record: %w", err)
+	}
+
+	if err := writeSpoolFile(entry.path, data); err != nil {
+		return err
+	}
+
+	s.bytes += int64(len(data)) - entry.size
+	entry.size = int64(len(data))
+	entry.metrics = len(ms.Gauges) + len(ms.Counters)
+	return nil
+}
+
+// Drop удаляет отчёт с номером seq как потерянный (например, сервер его отверг).
+// Если отчёт уже вытеснен из очереди, ничего не делает.
+func (s *Spool) Drop(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isHead(seq) {
+		s.dropOldest()
+	}
+}
+
+// isHead сообщает, что отчёт seq всё ещё первый в очереди (вызывается под мьютексом).
+// Отчёты удаляются только из начала очереди, поэтому другого места у него быть не может.
+func (s *Spool) isHead(seq uint64) bool {
+	return len(s.entries) > 0 && s.entries[0].seq == seq
+}
+
+// Len возвращает количество отчётов в очереди.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Stats возвращает текущее состояние очереди.
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SpoolStats{
+		Batches:        len(s.entries),
+		Bytes:          s.bytes,
+		DroppedBatches: s.droppedBatches,
+		DroppedMetrics: s.droppedMetrics,
+	}
+}
+
+// enforceLimits отбрасывает самые старые отчёты сверх ограничений (вызывается под мьютексом).
+// Последний добавленный отчёт сохраняется, даже если он один больше MaxBytes.
+func (s *Spool) enforceLimits(now time.Time) {
+	for len(s.entries) > 0 {
+		oldest := s.entries[0]
+		tooOld := s.cfg.MaxAge > 0 && now.Sub(oldest.createdAt) > s.cfg.MaxAge
+		tooBig := s.cfg.MaxBytes > 0 && s.bytes > s.cfg.MaxBytes && len(s.entries) > 1
+		if !tooOld && !tooBig {
+			return
+		}
+		logger.Log.Warn("Dropping oldest spooled report",
+			zap.String("file", oldest.path),
+			zap.Bool("expired", tooOld),
+			zap.Int64("spool_bytes", s.bytes),
+		)
+		s.dropOldest()
+	}
+}
+
+// dropOldest удаляет самый старый отчёт и учитывает потерю (вызывается под мьютексом)
+func (s *Spool) dropOldest() {
+	entry := s.entries[0]
+	s.entries = s.entries[1:]
+	s.bytes -= entry.size
+	s.droppedBatches++
+	s.droppedMetrics += int64(entry.metrics)
+	if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		logger.Log.Error("Failed to remove spool file", zap.String("file", entry.path), zap.Error(err))
+	}
+}
+
+// writeSpoolFile атомарно записывает файл очереди: данные пишутся во временный
+// файл, сбрасываются на диск и переименовываются, после чего сбрасывается каталог.
+// Так отчёт не теряется и не остаётся полузаписанным при сбое питания.
+func writeSpoolFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("write spool file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("write spool file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("sync spool file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write spool file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("commit spool file: %w", err)
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("sync spool dir: %w", err)
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("sync spool dir: %w", err)
+	}
+	return nil
+}
+
+// readSpoolRecord читает и разбирает файл очереди
+func readSpoolRecord(path string) (spoolRecord, int64, error) {
+	var record spoolRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return record, 0, err
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, 0, err
+	}
+	return record, int64(len(data)), nil
+}
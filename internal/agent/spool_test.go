@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpool_PushPeekPopInOrder(t *testing.T) {
+	spool, err := OpenSpool(SpoolConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	require.NoError(t, spool.Push(MetricsSet{Gauges: map[string]float64{"Alloc": 1}}))
+	require.NoError(t, spool.Push(MetricsSet{Counters: map[string]int64{"PollCount": 5}}))
+	assert.Equal(t, 2, spool.Len())
+
+	seq, ms, ok, err := spool.Peek()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, 1.0, ms.Gauges["Alloc"])
+
+	require.NoError(t, spool.Pop(seq))
+	seq, ms, ok, err = spool.Peek()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(5), ms.Counters["PollCount"])
+
+	require.NoError(t, spool.Pop(seq))
+	_, _, ok, err = spool.Peek()
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestSpool_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	spool, err := OpenSpool(SpoolConfig{Dir: dir})
+	require.NoError(t, err)
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, spool.Push(MetricsSet{Counters: map[string]int64{"PollCount": i}}))
+	}
+
+	// Недописанный временный файл и мусор в каталоге игнорируются
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000009.batch.tmp"), []byte("{"), 0o644))
+
+	reopened, err := OpenSpool(SpoolConfig{Dir: dir})
+	require.NoError(t, err)
+	assert.Equal(t, 3, reopened.Len())
+
+	_, ms, _, err := reopened.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), ms.Counters["PollCount"])
+
+	// Новые отчёты получают номера после уже существующих
+	require.NoError(t, reopened.Push(MetricsSet{Counters: map[string]int64{"PollCount": 4}}))
+	for i := int64(1); i <= 4; i++ {
+		seq, ms, ok, err := reopened.Peek()
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, i, ms.Counters["PollCount"])
+		require.NoError(t, reopened.Pop(seq))
+	}
+}
+
+func TestSpool_DropsOldestWhenTooBig(t *testing.T) {
+	spool, err := OpenSpool(SpoolConfig{Dir: t.TempDir(), MaxBytes: 200})
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, spool.Push(MetricsSet{Gauges: map[string]float64{"Alloc": float64(i), "Sys": 1}}))
+	}
+
+	stats := spool.Stats()
+	assert.LessOrEqual(t, stats.Bytes, int64(200))
+	assert.Equal(t, int64(10-stats.Batches), stats.DroppedBatches)
+	assert.Equal(t, stats.DroppedBatches*2, stats.DroppedMetrics)
+
+	// Остались самые свежие отчёты
+	_, ms, _, err := spool.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, float64(10-stats.Batches), ms.Gauges["Alloc"])
+}
+
+func TestSpool_DropsExpired(t *testing.T) {
+	spool, err := OpenSpool(SpoolConfig{Dir: t.TempDir(), MaxAge: 50 * time.Millisecond})
+	require.NoError(t, err)
+
+	require.NoError(t, spool.Push(MetricsSet{Gauges: map[string]float64{"Alloc": 1}}))
+	time.Sleep(100 * time.Millisecond)
+
+	_, _, ok, err := spool.Peek()
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, int64(1), spool.Stats().DroppedBatches)
+}
+
+func TestSpool_PopAfterEvictionKeepsNext(t *testing.T) {
+	spool, err := OpenSpool(SpoolConfig{Dir: t.TempDir(), MaxBytes: 200})
+	require.NoError(t, err)
+
+	require.NoError(t, spool.Push(MetricsSet{ID: "first", Gauges: map[string]float64{"Alloc": 1, "Sys": 1}}))
+	seq, ms, ok, err := spool.Peek()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "first", ms.ID)
+
+	// Пока отчёт отправлялся, новые отчёты вытеснили его из очереди
+	for i := 0; i < 5; i++ {
+		require.NoError(t, spool.Push(MetricsSet{ID: "next", Gauges: map[string]float64{"Alloc": float64(i), "Sys": 1}}))
+	}
+	stats := spool.Stats()
+	require.Positive(t, stats.DroppedBatches)
+
+	// Pop и Drop по устаревшему номеру не трогают неотправленные отчёты
+	require.NoError(t, spool.Pop(seq))
+	spool.Drop(seq)
+	assert.Equal(t, stats, spool.Stats())
+
+	_, ms, _, err = spool.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "next", ms.ID)
+}
+
+func TestSpool_ReplaceKeepsPosition(t *testing.T) {
+	spool, err := OpenSpool(SpoolConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	require.NoError(t, spool.Push(MetricsSet{ID: "first", Gauges: map[string]float64{"Alloc": 1, "Bad": 2}}))
+	require.NoError(t, spool.Push(MetricsSet{ID: "second", Counters: map[string]int64{"PollCount": 5}}))
+
+	// Сервер принял часть отчёта: остаток остаётся первым в очереди
+	seq, _, _, err := spool.Peek()
+	require.NoError(t, err)
+	require.NoError(t, spool.Replace(seq, MetricsSet{ID: "rest", Gauges: map[string]float64{"Bad": 2}}))
+	seq, ms, ok, err := spool.Peek()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "rest", ms.ID)
+	assert.Equal(t, map[string]float64{"Bad": 2}, ms.Gauges)
+
+	require.NoError(t, spool.Pop(seq))
+	_, ms, _, err = spool.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "second", ms.ID)
+}
+
+func TestSpool_ReplaceAfterEvictionKeepsNext(t *testing.T) {
+	spool, err := OpenSpool(SpoolConfig{Dir: t.TempDir(), MaxBytes: 200})
+	require.NoError(t, err)
+
+	require.NoError(t, spool.Push(MetricsSet{ID: "first", Gauges: map[string]float64{"Alloc": 1, "Bad": 2}}))
+	seq, _, _, err := spool.Peek()
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, spool.Push(MetricsSet{ID: "next", Gauges: map[string]float64{"Alloc": float64(i), "Sys": 1}}))
+	}
+
+	// Остаток вытесненного отчёта не должен затереть следующий неотправленный
+	require.NoError(t, spool.Replace(seq, MetricsSet{ID: "rest", Gauges: map[string]float64{"Bad": 2}}))
+	_, ms, _, err := spool.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "next", ms.ID)
+	assert.Equal(t, 1.0, ms.Gauges["Sys"])
+}
@@ -0,0 +1,266 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/logger"
+)
+
+// statsdMaxPacketSize — максимальный размер UDP-пакета StatsD
+const statsdMaxPacketSize = 65535
+
+// Типы метрик протокола StatsD
+const (
+	statsdCounter = "c"
+	statsdGauge   = "g"
+	statsdTimer   = "ms"
+	statsdHisto   = "h"
+	statsdSet     = "s"
+)
+
+// statsdSample — одна разобранная строка протокола StatsD
+type statsdSample struct {
+	name       string
+	value      float64
+	raw        string  // исходное значение (нужно для set)
+	mtype      string  // c, g, ms, h, s
+	sampleRate float64 // частота семплирования (@0.1), по умолчанию 1
+	relative   bool    // gauge со знаком (+N/-N) изменяет текущее значение
+}
+
+// StatsDListener принимает метрики по протоколу StatsD через UDP
+// и агрегирует их между тиками отправки агента.
+//
+// Счётчики суммируются и сбрасываются при Flush, gauge сохраняют последнее
+// значение между отправками, таймеры превращаются в производные метрики
+// (<name>.count, <name>.min, <name>.max, <name>.mean), а set — в число
+// уникальных значений за окно.
+type StatsDListener struct {
+	addr string
+	conn net.PacketConn
+
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+	timers   map[string][]float64
+	sets     map[string]map[string]struct{}
+}
+
+// NewStatsDListener создаёт StatsD-приёмник для указанного адреса (например, localhost:8125).
+func NewStatsDListener(addr string) *StatsDListener {
+	return &StatsDListener{
+		addr:     addr,
+		counters: make(map[string]float64),
+		gauges:   make(map[string]float64),
+		timers:   make(map[string][]float64),
+		sets:     make(map[string]map[string]struct{}),
+	}
+}
+
+// Listen открывает UDP-сокет. Вызывается до Serve, чтобы ошибка привязки
+// была видна сразу при старте агента.
+func (l *StatsDListener) Listen() error {
+	conn, err := net.ListenPacket("udp", l.addr)
+	if err != nil {
+		return fmt.Errorf("listen statsd on %s: %w", l.addr, err)
+	}
+	l.conn = conn
+	return nil
+}
+
+// Addr возвращает фактический адрес сокета (полезно, если порт был выбран системой).
+func (l *StatsDListener) Addr() net.Addr {
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.LocalAddr()
+}
+
+// Serve читает пакеты до отмены контекста.
+func (l *StatsDListener) Serve(ctx context.Context) {
+	if l.conn == nil {
+		return
+	}
+
+	// Закрываем сокет при отмене контекста, чтобы разблокировать ReadFrom
+	go func() {
+		<-ctx.Done()
+		l.conn.Close()
+	}()
+
+	buf := make([]byte, statsdMaxPacketSize)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Log.Warn("StatsD read failed", zap.Error(err))
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		l.HandlePacket(buf[:n])
+	}
+}
+
+// HandlePacket разбирает пакет (одна или несколько строк через \n) и агрегирует значения.
+func (l *StatsDListener) HandlePacket(packet []byte) {
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sample, err := parseStatsDLine(line)
+		if err != nil {
+			logger.Log.Debug("Invalid StatsD line", zap.String("line", line), zap.Error(err))
+			continue
+		}
+		l.add(sample)
+	}
+}
+
+// add агрегирует одно значение
+func (l *StatsDListener) add(s statsdSample) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch s.mtype {
+	case statsdCounter:
+		l.counters[s.name] += s.value / s.sampleRate
+	case statsdGauge:
+		if s.relative {
+			l.gauges[s.name] += s.value
+		} else {
+			l.gauges[s.name] = s.value
+		}
+	case statsdTimer, statsdHisto:
+		l.timers[s.name] = append(l.timers[s.name], s.value)
+	case statsdSet:
+		set, ok := l.sets[s.name]
+		if !ok {
+			set = make(map[string]struct{})
+			l.sets[s.name] = set
+		}
+		set[s.raw] = struct{}{}
+	}
+}
+
+// Flush возвращает агрегированные за окно метрики и сбрасывает счётчики,
+// таймеры и множества. Gauge сохраняются до следующего значения, как в statsd.
+func (l *StatsDListener) Flush() MetricsSet {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ms := MetricsSet{
+		Gauges:   make(map[string]float64, len(l.gauges)),
+		Counters: make(map[string]int64, len(l.counters)),
+	}
+
+	for name, v := range l.gauges {
+		ms.Gauges[name] = v
+	}
+
+	for name, v := range l.counters {
+		if delta := int64(math.Round(v)); delta != 0 {
+			ms.Counters[name] = delta
+		}
+	}
+
+	for name, values := range l.timers {
+		if len(values) == 0 {
+			continue
+		}
+		minV, maxV, sum := values[0], values[0], 0.0
+		for _, v := range values {
+			minV = math.Min(minV, v)
+			maxV = math.Max(maxV, v)
+			sum += v
+		}
+		ms.Counters[name+".count"] = int64(len(values))
+		ms.Gauges[name+".min"] = minV
+		ms.Gauges[name+".max"] = maxV
+		ms.Gauges[name+".mean"] = sum / float64(len(values))
+	}
+
+	for name, set := range l.sets {
+		ms.Gauges[name] = float64(len(set))
+	}
+
+	l.counters = make(map[string]float64)
+	l.timers = make(map[string][]float64)
+	l.sets = make(map[string]map[string]struct{})
+
+	return ms
+}
+
+// parseStatsDLine разбирает строку вида <name>:<value>|<type>[|@<rate>][|#tags]
+func parseStatsDLine(line string) (statsdSample, error) {
+	sample := statsdSample{sampleRate: 1}
+
+	// Имя отделяется от значения последним ':' до первого '|' (в тегах тоже бывает ':')
+	head := line
+	if pipe := strings.Index(line, "|"); pipe >= 0 {
+		head = line[:pipe]
+	}
+	colon := strings.LastIndex(head, ":")
+	if colon < 0 {
+		return sample, errors.New("missing value separator")
+	}
+	if colon == 0 {
+		return sample, errors.New("missing metric name")
+	}
+	sample.name = line[:colon]
+
+	parts := strings.Split(line[colon+1:], "|")
+	if len(parts) < 2 {
+		return sample, errors.New("missing metric type")
+	}
+
+	sample.raw = parts[0]
+	sample.mtype = parts[1]
+
+	for _, opt := range parts[2:] {
+		if strings.HasPrefix(opt, "@") {
+			rate, err := strconv.ParseFloat(opt[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return sample, fmt.Errorf("invalid sample rate %q", opt)
+			}
+			sample.sampleRate = rate
+		}
+		// Теги (#tag) пока игнорируем: сервер не поддерживает измерения
+	}
+
+	switch sample.mtype {
+	case statsdSet:
+		if sample.raw == "" {
+			return sample, errors.New("empty set value")
+		}
+		return sample, nil
+	case statsdCounter, statsdGauge, statsdTimer, statsdHisto:
+	default:
+		return sample, fmt.Errorf("unsupported metric type %q", sample.mtype)
+	}
+
+	value, err := strconv.ParseFloat(sample.raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return sample, fmt.Errorf("invalid value %q", sample.raw)
+	}
+	sample.value = value
+
+	// Для gauge знак означает относительное изменение
+	if sample.mtype == statsdGauge && (strings.HasPrefix(sample.raw, "+") || strings.HasPrefix(sample.raw, "-")) {
+		sample.relative = true
+	}
+
+	return sample, nil
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/logger"
+)
+
+func init() {
+	// Инициализируем логгер для тестов
+	logger.Log = zap.NewNop()
+}
+
+func TestParseStatsDLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    statsdSample
+		wantErr bool
+	}{
+		{
+			name: "counter",
+			line: "requests:3|c",
+			want: statsdSample{name: "requests", value: 3, raw: "3", mtype: "c", sampleRate: 1},
+		},
+		{
+			name: "counter with sample rate",
+			line: "requests:1|c|@0.5",
+			want: statsdSample{name: "requests", value: 1, raw: "1", mtype: "c", sampleRate: 0.5},
+		},
+		{
+			name: "relative gauge",
+			line: "queue:-2|g",
+			want: statsdSample{name: "queue", value: -2, raw: "-2", mtype: "g", sampleRate: 1, relative: true},
+		},
+		{
+			name: "timer with tags",
+			line: "db.query:12.5|ms|#env:prod",
+			want: statsdSample{name: "db.query", value: 12.5, raw: "12.5", mtype: "ms", sampleRate: 1},
+		},
+		{name: "missing type", line: "requests:1", wantErr: true},
+		{name: "missing name", line: ":1|c", wantErr: true},
+		{name: "unknown type", line: "requests:1|x", wantErr: true},
+		{name: "invalid value", line: "requests:abc|c", wantErr: true},
+		{name: "invalid sample rate", line: "requests:1|c|@2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStatsDLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStatsDListener_Flush(t *testing.T) {
+	l := NewStatsDListener("localhost:0")
+
+	l.HandlePacket([]byte("hits:1|c\nhits:2|c\nhits:1|c|@0.25\n"))
+	l.HandlePacket([]byte("temp:20|g\ntemp:+5|g"))
+	l.HandlePacket([]byte("latency:10|ms\nlatency:30|ms\nlatency:20|ms"))
+	l.HandlePacket([]byte("users:alice|s\nusers:bob|s\nusers:alice|s"))
+	l.HandlePacket([]byte("garbage line\n"))
+
+	ms := l.Flush()
+
+	assert.Equal(t, int64(7), ms.Counters["hits"])
+	assert.Equal(t, 25.0, ms.Gauges["temp"])
+	assert.Equal(t, int64(3), ms.Counters["latency.count"])
+	assert.Equal(t, 10.0, ms.Gauges["latency.min"])
+	assert.Equal(t, 30.0, ms.Gauges["latency.max"])
+	assert.Equal(t, 20.0, ms.Gauges["latency.mean"])
+	assert.Equal(t, 2.0, ms.Gauges["users"])
+
+	// После сброса счётчики и таймеры обнуляются, gauge сохраняется
+	ms = l.Flush()
+	assert.Empty(t, ms.Counters)
+	assert.Equal(t, map[string]float64{"temp": 25}, ms.Gauges)
+}
+
+func TestStatsDListener_ServeUDP(t *testing.T) {
+	l := NewStatsDListener("127.0.0.1:0")
+	require.NoError(t, l.Listen())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.Serve(ctx)
+
+	conn, err := net.Dial("udp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("jobs:4|c"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.counters["jobs"] == 4
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,371 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	"github.com/Mihklz/metrixcollector/internal/retry"
+)
+
+// Режимы работы с несколькими серверами
+const (
+	// ModeFailover — отчёт уходит на один сервер, при его отказе — на следующий
+	ModeFailover = "failover"
+	// ModeFanout — отчёт уходит на все серверы (например, prod и staging)
+	ModeFanout = "fanout"
+)
+
+// targetCooldown — сколько сервер после отказа пропускается при выборе в режиме failover
+const targetCooldown = 30 * time.Second
+
+// fanoutBacklogSize — сколько отчётов хранится в памяти для сервера, не принявшего
+// их в режиме fanout. При переполнении отбрасываются самые старые отчёты.
+const fanoutBacklogSize = 100
+
+// TargetHealth — снимок состояния сервера назначения.
+type TargetHealth struct {
+	Addr                string
+	Healthy             bool
+	ConsecutiveFailures int
+	LastError           string
+	LastSuccess         time.Time
+	LastFailure         time.Time
+	Backlog             int   // отчётов ждут доставки на сервер (режим fanout)
+	DroppedReports      int64 // отчётов не доставлено на сервер и отброшено
+}
+
+// reportSender отправляет отчёт на один сервер. Если сервер принял отчёт
+// частично, возвращает *PartialBatchError или *UnsentCountersError.
+type reportSender func(ctx context.Context, addr string, ms MetricsSet) error
+
+// pendingReport — отчёт, ожидающий доставки на сервер в режиме fanout
+type pendingReport struct {
+	metrics MetricsSet
+	send    reportSender
+}
+
+// target — сервер назначения и его состояние
+type target struct {
+	addr string
+
+	mu      sync.Mutex
+	health  TargetHealth
+	backlog []pendingReport // от старых к новым
+}
+
+func newTarget(addr string) *target {
+	return &target{
+		addr:   addr,
+		health: TargetHealth{Addr: addr, Healthy: true},
+	}
+}
+
+// markSuccess отмечает успешный ответ сервера
+func (t *target) markSuccess() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.health.Healthy {
+		logger.Log.Info("Server is healthy again", zap.String("server", t.addr))
+	}
+	t.health.Healthy = true
+	t.health.ConsecutiveFailures = 0
+	t.health.LastSuccess = time.Now()
+}
+
+// markFailure отмечает отказ сервера
+func (t *target) markFailure(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.health.Healthy = false
+	t.health.ConsecutiveFailures++
+	t.health.LastError = err.Error()
+	t.health.LastFailure = time.Now()
+}
+
+// available сообщает, стоит ли сейчас пробовать сервер
+func (t *target) available(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.health.Healthy || now.Sub(t.health.LastFailure) >= targetCooldown
+}
+
+// enqueue откладывает отчёт до восстановления сервера
+func (t *target) enqueue(report pendingReport) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.backlog) >= fanoutBacklogSize {
+		logger.Log.Warn("Server backlog is full, dropping oldest report", zap.String("server", t.addr))
+		t.backlog = t.backlog[1:]
+		t.health.DroppedReports++
+	}
+	t.backlog = append(t.backlog, report)
+	t.health.Backlog = len(t.backlog)
+}
+
+// requeue возвращает отчёт в начало очереди после неудачной доставки
+func (t *target) requeue(report pendingReport) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.backlog = append([]pendingReport{report}, t.backlog...)
+	t.health.Backlog = len(t.backlog)
+}
+
+// next забирает самый старый отложенный отчёт
+func (t *target) next() (pendingReport, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.backlog) == 0 {
+		return pendingReport{}, false
+	}
+	report := t.backlog[0]
+	t.backlog = t.backlog[1:]
+	t.health.Backlog = len(t.backlog)
+	return report, true
+}
+
+// drop учитывает отчёт, который сервер отверг
+func (t *target) drop(err error) {
+	logger.Log.Warn("Report rejected by server, dropping", zap.String("server", t.addr), zap.Error(err))
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.health.DroppedReports++
+}
+
+// snapshot возвращает копию состояния
+func (t *target) snapshot() TargetHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.health
+}
+
+// targetSet — набор серверов назначения с выбором по режиму
+type targetSet struct {
+	mode       string
+	targets    []*target
+	classifier retry.ErrorClassifier
+
+	mu     sync.Mutex
+	active int // текущий сервер в режиме failover
+}
+
+func newTargetSet(addrs []string, mode string, classifier retry.ErrorClassifier) (*targetSet, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no server addresses configured")
+	}
+	if mode == "" {
+		mode = ModeFailover
+	}
+	if mode != ModeFailover && mode != ModeFanout {
+		return nil, fmt.Errorf("unknown server mode %q, expected %q or %q", mode, ModeFailover, ModeFanout)
+	}
+
+	set := &targetSet{mode: mode, classifier: classifier}
+	for _, addr := range addrs {
+		set.targets = append(set.targets, newTarget(addr))
+	}
+	return set, nil
+}
+
+// failover пробует серверы по очереди, начиная с текущего.
+// К следующему серверу переходим только при временной ошибке
+// (по классификатору retry): если сервер отверг данные, другой отвергнет их так же.
+func (ts *targetSet) failover(ctx context.Context, send func(addr string) error) error {
+	var lastErr error
+	for _, idx := range ts.failoverOrder() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		t := ts.targets[idx]
+		err := send(t.addr)
+		// Частичный приём — сервер ответил, остаток повторяется на нём же
+		if _, partial := remainder(err); err == nil || partial {
+			t.markSuccess()
+			ts.setActive(idx)
+			return err
+		}
+		lastErr = err
+
+		if ts.classifier.Classify(err) == retry.NonRetriable {
+			return err
+		}
+
+		t.markFailure(err)
+		if len(ts.targets) > 1 {
+			logger.Log.Warn("Server failed, switching to next one",
+				zap.String("server", t.addr),
+				zap.Error(err),
+			)
+		}
+	}
+	return lastErr
+}
+
+// failoverOrder — порядок обхода: сначала доступные серверы начиная с текущего,
+// затем серверы, недавно отказавшие (на случай, если отказали все)
+func (ts *targetSet) failoverOrder() []int {
+	ts.mu.Lock()
+	start := ts.active
+	ts.mu.Unlock()
+
+	now := time.Now()
+	order := make([]int, 0, len(ts.targets))
+	var cooling []int
+	for i := range ts.targets {
+		idx := (start + i) % len(ts.targets)
+		if ts.targets[idx].available(now) {
+			order = append(order, idx)
+		} else {
+			cooling = append(cooling, idx)
+		}
+	}
+	return append(order, cooling...)
+}
+
+func (ts *targetSet) setActive(idx int) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.active = idx
+}
+
+// fanout отправляет отчёт на все серверы параллельно. Сначала каждый сервер
+// получает отложенные для него отчёты, чтобы сохранить порядок.
+//
+// Если отчёт принял хотя бы один сервер, остальным он будет доставлен позже:
+// отчёт или его непринятый остаток откладывается в очередь каждого такого
+// сервера, и вызывающий может считать отчёт отправленным. Если отчёт не принял
+// никто, ничего не откладывается и возвращается ошибка — отчёт остаётся
+// за вызывающим (например, уходит в очередь на диске).
+func (ts *targetSet) fanout(ctx context.Context, ms MetricsSet, send reportSender) error {
+	type result struct {
+		accepted bool
+		pending  *MetricsSet // что ещё нужно доставить на сервер
+		err      error
+	}
+	results := make([]result, len(ts.targets))
+
+	var wg sync.WaitGroup
+	for i, t := range ts.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := &results[i]
+
+			if err := ts.flush(ctx, t); err != nil {
+				// Сервер не принял старые отчёты — новый встаёт за ними
+				res.pending, res.err = &ms, err
+				if _, partial := remainder(err); !partial {
+					t.markFailure(err)
+				}
+				return
+			}
+
+			err := send(ctx, t.addr, ms)
+			res.err = err
+			if rest, partial := remainder(err); err == nil || partial {
+				res.accepted = true
+				if partial {
+					res.pending = &rest
+				}
+				t.markSuccess()
+				return
+			}
+			// Сервер ответил, но отверг данные — он сам по себе исправен
+			if ts.retriable(ctx, err) {
+				res.pending = &ms
+				t.markFailure(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	accepted := false
+	for _, res := range results {
+		accepted = accepted || res.accepted
+	}
+	if !accepted {
+		errs := make([]error, 0, len(results))
+		for i, res := range results {
+			errs = append(errs, fmt.Errorf("%s: %w", ts.targets[i].addr, res.err))
+		}
+		return errors.Join(errs...)
+	}
+
+	for i, res := range results {
+		t := ts.targets[i]
+		switch {
+		case res.pending != nil:
+			logger.Log.Warn("Fan-out delivery failed, report kept for retry",
+				zap.String("server", t.addr),
+				zap.Error(res.err),
+			)
+			t.enqueue(pendingReport{metrics: *res.pending, send: send})
+		case res.err != nil:
+			t.drop(res.err)
+		}
+	}
+	return nil
+}
+
+// flush доставляет на сервер отложенные для него отчёты по порядку.
+// Если сервер снова не принял отчёт, тот (или его остаток) остаётся первым
+// в очереди и возвращается ошибка. Отвергнутые сервером отчёты отбрасываются.
+func (ts *targetSet) flush(ctx context.Context, t *target) error {
+	for ctx.Err() == nil {
+		report, ok := t.next()
+		if !ok {
+			return nil
+		}
+
+		err := report.send(ctx, t.addr, report.metrics)
+		if err == nil {
+			continue
+		}
+		if rest, partial := remainder(err); partial {
+			t.requeue(pendingReport{metrics: rest, send: report.send})
+			return err
+		}
+		if !ts.retriable(ctx, err) {
+			t.drop(err)
+			continue
+		}
+		t.requeue(report)
+		return err
+	}
+	return ctx.Err()
+}
+
+// retriable сообщает, что отчёт стоит доставить повторно.
+// Прерванная отправка (например, при остановке агента) не означает отказа сервера.
+func (ts *targetSet) retriable(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || ts.classifier.Classify(err) == retry.Retriable
+}
+
+// remainder возвращает часть отчёта, которую сервер не принял,
+// если ошибка означает частичный приём
+func remainder(err error) (MetricsSet, bool) {
+	var partialErr *PartialBatchError
+	if errors.As(err, &partialErr) {
+		return partialErr.Failed, true
+	}
+	var unsentErr *UnsentCountersError
+	if errors.As(err, &unsentErr) {
+		return MetricsSet{ID: NewReportID(), Counters: unsentErr.Counters}, true
+	}
+	return MetricsSet{}, false
+}
+
+// health возвращает состояние всех серверов
+func (ts *targetSet) health() []TargetHealth {
+	result := make([]TargetHealth, 0, len(ts.targets))
+	for _, t := range ts.targets {
+		result = append(result, t.snapshot())
+	}
+	return result
+}
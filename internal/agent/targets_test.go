@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mihklz/metrixcollector/internal/config"
+	"github.com/Mihklz/metrixcollector/internal/middleware"
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+// countingServer считает запросы и отвечает заданным кодом
+func countingServer(t *testing.T, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+// deadAddr возвращает адрес, на котором никто не слушает
+func deadAddr(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	addr := srv.URL
+	srv.Close()
+	return addr
+}
+
+func TestMetricsSender_Failover(t *testing.T) {
+	dead := deadAddr(t)
+	backup, backupHits := countingServer(t, http.StatusOK)
+
+	sender, err := NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{dead, backup.URL},
+		ServerMode:  ModeFailover,
+	})
+	require.NoError(t, err)
+
+	ms := MetricsSet{Gauges: map[string]float64{"Alloc": 1}}
+	require.NoError(t, sender.SendMetricsBatch(context.Background(), ms))
+	assert.Equal(t, int32(1), backupHits.Load())
+
+	health := sender.Health()
+	require.Len(t, health, 2)
+	assert.False(t, health[0].Healthy)
+	assert.Equal(t, 1, health[0].ConsecutiveFailures)
+	assert.NotEmpty(t, health[0].LastError)
+	assert.True(t, health[1].Healthy)
+
+	// Следующий отчёт сразу идёт на рабочий сервер
+	require.NoError(t, sender.SendMetricsBatch(context.Background(), ms))
+	assert.Equal(t, int32(2), backupHits.Load())
+	assert.Equal(t, 1, sender.Health()[0].ConsecutiveFailures)
+}
+
+func TestMetricsSender_FailoverStopsOnRejection(t *testing.T) {
+	primary, _ := countingServer(t, http.StatusBadRequest)
+	backup, backupHits := countingServer(t, http.StatusOK)
+
+	sender, err := NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{primary.URL, backup.URL},
+	})
+	require.NoError(t, err)
+
+	// Сервер отверг данные — второй отверг бы их так же
+	err = sender.SendMetricsBatch(context.Background(), MetricsSet{Gauges: map[string]float64{"Alloc": 1}})
+	assert.True(t, IsPermanentStatus(err))
+	assert.Zero(t, backupHits.Load())
+	assert.True(t, sender.Health()[0].Healthy)
+}
+
+func TestMetricsSender_Fanout(t *testing.T) {
+	prod, prodHits := countingServer(t, http.StatusOK)
+	staging, stagingHits := countingServer(t, http.StatusOK)
+	dead := deadAddr(t)
+
+	sender, err := NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{prod.URL, staging.URL, dead},
+		ServerMode:  ModeFanout,
+	})
+	require.NoError(t, err)
+
+	// Достаточно, чтобы данные принял хотя бы один сервер
+	require.NoError(t, sender.SendMetricsBatch(context.Background(), MetricsSet{Counters: map[string]int64{"PollCount": 1}}))
+	assert.Equal(t, int32(1), prodHits.Load())
+	assert.Equal(t, int32(1), stagingHits.Load())
+
+	health := sender.Health()
+	assert.True(t, health[0].Healthy)
+	assert.True(t, health[1].Healthy)
+	assert.False(t, health[2].Healthy)
+	assert.Equal(t, 1, health[2].Backlog)
+}
+
+// counterServer складывает принятые приращения PollCount.
+// Пока fail возвращает true, сервер отвечает 503.
+func counterServer(t *testing.T, fail func() bool) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var total atomic.Int64
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var batch []models.Metrics
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		for _, metric := range batch {
+			if metric.ID == "PollCount" && metric.Delta != nil {
+				total.Add(*metric.Delta)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := httptest.NewServer(middleware.WithGzip(handler))
+	t.Cleanup(srv.Close)
+	return srv, &total
+}
+
+func TestMetricsSender_FanoutRedeliversToFailedTarget(t *testing.T) {
+	var stagingDown atomic.Bool
+	stagingDown.Store(true)
+	prod, prodTotal := counterServer(t, func() bool { return false })
+	staging, stagingTotal := counterServer(t, stagingDown.Load)
+
+	sender, err := NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{prod.URL, staging.URL},
+		ServerMode:  ModeFanout,
+	})
+	require.NoError(t, err)
+
+	// Отчёт принят prod, для staging он откладывается
+	require.NoError(t, sender.SendMetricsBatch(context.Background(), MetricsSet{Counters: map[string]int64{"PollCount": 1}}))
+	assert.Equal(t, int64(1), prodTotal.Load())
+	assert.Zero(t, stagingTotal.Load())
+	assert.Equal(t, 1, sender.Health()[1].Backlog)
+
+	// Пока staging недоступен, новые отчёты встают в его очередь за старыми
+	require.NoError(t, sender.SendMetricsBatch(context.Background(), MetricsSet{Counters: map[string]int64{"PollCount": 2}}))
+	assert.Equal(t, 2, sender.Health()[1].Backlog)
+
+	// После восстановления staging получает всё, а prod — ничего повторно
+	stagingDown.Store(false)
+	require.NoError(t, sender.SendMetricsBatch(context.Background(), MetricsSet{Counters: map[string]int64{"PollCount": 4}}))
+	assert.Equal(t, int64(7), prodTotal.Load())
+	assert.Equal(t, int64(7), stagingTotal.Load())
+
+	health := sender.Health()
+	assert.Zero(t, health[1].Backlog)
+	assert.True(t, health[1].Healthy)
+	assert.Zero(t, health[1].DroppedReports)
+}
+
+func TestMetricsSender_FanoutKeepsRemainderForTarget(t *testing.T) {
+	prod, prodTotal := counterServer(t, func() bool { return false })
+
+	// staging один раз не сохраняет счётчик из-за временного сбоя
+	var stagingBatches [][]models.Metrics
+	staging := httptest.NewServer(middleware.WithGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []models.Metrics
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		stagingBatches = append(stagingBatches, batch)
+		result := models.BatchResult{}
+		for i, metric := range batch {
+			if metric.ID == "PollCount" && len(stagingBatches) == 1 {
+				result.Errors = append(result.Errors, models.BatchItemError{Index: i, ID: metric.ID, Code: "storage_error", Retriable: true})
+				continue
+			}
+			result.Accepted++
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(result))
+	})))
+	t.Cleanup(staging.Close)
+
+	sender, err := NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{prod.URL, staging.URL},
+		ServerMode:  ModeFanout,
+	})
+	require.NoError(t, err)
+
+	ms := MetricsSet{Gauges: map[string]float64{"Alloc": 1}, Counters: map[string]int64{"PollCount": 5}}
+	require.NoError(t, sender.SendMetricsBatch(context.Background(), ms))
+	assert.Equal(t, int64(5), prodTotal.Load())
+	assert.Equal(t, 1, sender.Health()[1].Backlog)
+
+	// Остаток уходит только на staging перед следующим отчётом
+	require.NoError(t, sender.SendMetricsBatch(context.Background(), MetricsSet{Gauges: map[string]float64{"Alloc": 2}}))
+	require.Len(t, stagingBatches, 3)
+	require.Len(t, stagingBatches[1], 1)
+	assert.Equal(t, "PollCount", stagingBatches[1][0].ID)
+	assert.Equal(t, int64(5), *stagingBatches[1][0].Delta)
+	assert.Equal(t, int64(5), prodTotal.Load())
+}
+
+func TestMetricsSender_FanoutAllFailed(t *testing.T) {
+	sender, err := NewMetricsSender(&config.AgentConfig{
+		ServerAddrs: []string{deadAddr(t), deadAddr(t)},
+		ServerMode:  ModeFanout,
+	})
+	require.NoError(t, err)
+
+	err = sender.SendMetricsBatch(context.Background(), MetricsSet{Gauges: map[string]float64{"Alloc": 1}})
+	assert.Error(t, err)
+}
+
+func TestNewMetricsSender_InvalidConfig(t *testing.T) {
+	_, err := NewMetricsSender(&config.AgentConfig{})
+	assert.Error(t, err)
+
+	_, err = NewMetricsSender(&config.AgentConfig{ServerAddrs: []string{"http://localhost:8080"}, ServerMode: "broadcast"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+// Package apierror описывает единый формат ошибок API /api/v1:
+//
+//	{"error": {"code": "not_found", "message": "metric not found", "details": {...}}}
+//
+// code — машиночитаемый код ошибки, message — описание на английском,
+// details — необязательные подробности (например, поле с ошибкой).
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ContentType — тип содержимого ответа с ошибкой.
+const ContentType = "application/json"
+
+// Коды ошибок, общие для всех эндпоинтов
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeTooLarge         = "payload_too_large"
+	CodeUnprocessable    = "unprocessable_entity"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "unavailable"
+)
+
+// Error — ошибка API.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// Error возвращает текст ошибки.
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// envelope — тело ответа с ошибкой
+type envelope struct {
+	Error *Error `json:"error"`
+}
+
+// New создаёт ошибку API.
+func New(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// WithDetails возвращает копию ошибки с подробностями.
+func (e *Error) WithDetails(details any) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// Write отвечает ошибкой apiErr с кодом status.
+func Write(w http.ResponseWriter, status int, apiErr *Error) {
+	data, err := json.Marshal(envelope{Error: apiErr})
+	if err != nil {
+		data = []byte(`{"error":{"code":"internal_error","message":"failed to encode error"}}`)
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// WriteStatus отвечает ошибкой с кодом, соответствующим HTTP-статусу.
+// Пустое message заменяется стандартным текстом статуса.
+func WriteStatus(w http.ResponseWriter, status int, message string) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		message = strings.ToLower(http.StatusText(status))
+	}
+	Write(w, status, New(CodeForStatus(status), message))
+}
+
+// CodeForStatus возвращает код ошибки для HTTP-статуса.
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusUnprocessableEntity:
+		return CodeUnprocessable
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
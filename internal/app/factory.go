@@ -5,6 +5,7 @@ import (
 
 	"github.com/Mihklz/metrixcollector/internal/config"
 	"github.com/Mihklz/metrixcollector/internal/logger"
+	models "github.com/Mihklz/metrixcollector/internal/model"
 	"github.com/Mihklz/metrixcollector/internal/repository"
 	"github.com/Mihklz/metrixcollector/internal/server"
 	"github.com/Mihklz/metrixcollector/internal/service"
@@ -65,7 +66,7 @@ func (f *AppFactory) CreateSyncStorage(baseStorage repository.Storage, fileServi
 }
 
 // CreateServer создает HTTP сервер со всеми зависимостями
-func (f *AppFactory) CreateServer(storage repository.Storage, fileService *service.FileStorageService, db repository.Database) *server.Server {
+func (f *AppFactory) CreateServer(storage repository.Storage, fileService *service.FileStorageService, db repository.Database) (*server.Server, error) {
 	return server.NewServer(f.config, storage, fileService, db)
 }
 
@@ -96,3 +97,25 @@ func (s *SyncStorage) Update(metricType, name, value string) error {
 
 	return nil
 }
+
+// Delete удаляет метрику и синхронно сохраняет хранилище
+func (s *SyncStorage) Delete(metricType, name string) (bool, error) {
+	deleted, err := repository.Delete(s.Storage, metricType, name)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+
+	_ = s.fileService.SaveSync() // игнорируем ошибку для fail-safe работы
+
+	return true, nil
+}
+
+// List выбирает метрики средствами исходного хранилища
+func (s *SyncStorage) List(query repository.ListQuery) ([]models.Metrics, error) {
+	return repository.List(s.Storage, query)
+}
+
+// ForTenant возвращает хранилище арендатора с тем же синхронным сохранением
+func (s *SyncStorage) ForTenant(name string) repository.Storage {
+	return NewSyncStorage(s.Storage.ForTenant(name), s.fileService)
+}
@@ -94,7 +94,7 @@ func ProvideFileStorageService(cfg *config.ServerConfig, storage repository.Stor
 }
 
 // ProvideServer предоставляет HTTP сервер
-func ProvideServer(cfg *config.ServerConfig, baseStorage repository.Storage, fileService *service.FileStorageService, db repository.Database) *server.Server {
+func ProvideServer(cfg *config.ServerConfig, baseStorage repository.Storage, fileService *service.FileStorageService, db repository.Database) (*server.Server, error) {
 	var storage = baseStorage
 
 	// Если интервал равен 0 и НЕ используется PostgreSQL, используем синхронное сохранение
@@ -2,14 +2,23 @@ package audit
 
 import (
 	"encoding/json"
+	"net/http"
 	"time"
 )
 
+// EventRequestRejected — запрос отклонён при проверке подписи.
+const EventRequestRejected = "request_rejected"
+
 // AuditEvent представляет событие аудита.
+// Для принятых метрик Event пуст, для отклонённых запросов заполнены Event, Reason и Path.
 type AuditEvent struct {
-	Timestamp int64    `json:"ts"`         // unix timestamp события
-	Metrics   []string `json:"metrics"`    // наименование полученных метрик
-	IPAddress string   `json:"ip_address"` // IP адрес входящего запроса
+	Timestamp int64    `json:"ts"`                 // unix timestamp события
+	Metrics   []string `json:"metrics"`            // наименование полученных метрик
+	IPAddress string   `json:"ip_address"`         // IP адрес входящего запроса
+	Event     string   `json:"event,omitempty"`    // тип события, если это не приём метрик
+	Reason    string   `json:"reason,omitempty"`   // причина отказа
+	Path      string   `json:"path,omitempty"`     // путь отклонённого запроса
+	Identity  string   `json:"identity,omitempty"` // имя токена API клиента
 }
 
 // NewAuditEvent создает новое событие аудита.
@@ -21,6 +30,17 @@ func NewAuditEvent(metrics []string, ipAddress string) *AuditEvent {
 	}
 }
 
+// NewRejectionEvent создает событие аудита об отклонённом запросе.
+func NewRejectionEvent(r *http.Request, reason string) *AuditEvent {
+	return &AuditEvent{
+		Timestamp: time.Now().Unix(),
+		IPAddress: GetIPAddress(r),
+		Event:     EventRequestRejected,
+		Reason:    reason,
+		Path:      r.URL.Path,
+	}
+}
+
 // ToJSON преобразует событие аудита в JSON.
 func (e *AuditEvent) ToJSON() ([]byte, error) {
 	return json.Marshal(e)
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxBackwardSkew — на сколько секунд время события может быть меньше
+// времени предыдущего: наблюдатели пишут события асинхронно, и соседние
+// записи могут поменяться местами
+const maxBackwardSkew = 60
+
+// maxLineSize — максимальная длина строки журнала
+const maxLineSize = 1 << 20
+
+// VerifyProblem — нарушение формата журнала аудита в строке Line.
+type VerifyProblem struct {
+	Line    int
+	Message string
+}
+
+// VerifyReport — результат проверки журнала аудита.
+type VerifyReport struct {
+	Events   int   // корректные события
+	Accepted int   // события о принятых метриках
+	Rejected int   // события об отклонённых запросах
+	FirstTS  int64 // время первого события
+	LastTS   int64 // время последнего события
+	Problems []VerifyProblem
+}
+
+// OK сообщает, что журнал прошёл проверку.
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// VerifyLog проверяет журнал аудита, записанный FileAuditObserver:
+// каждая строка — событие AuditEvent без посторонних полей, с временем,
+// известным типом и причиной для отклонённых запросов, а время событий
+// не идёт назад больше чем на maxBackwardSkew секунд.
+// Журнал не подписывается, поэтому проверка выявляет повреждение
+// и ручную правку, но не подделку корректными записями.
+func VerifyLog(r io.Reader) (*VerifyReport, error) {
+	report := &VerifyReport{}
+	problem := func(line int, format string, args ...any) {
+		report.Problems = append(report.Problems, VerifyProblem{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	var maxTS int64
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var event AuditEvent
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&event); err != nil {
+			problem(line, "invalid event: %v", err)
+			continue
+		}
+		if decoder.More() {
+			problem(line, "unexpected data after event")
+			continue
+		}
+
+		if event.Timestamp <= 0 {
+			problem(line, "missing timestamp")
+			continue
+		}
+		switch event.Event {
+		case "":
+			report.Accepted++
+		case EventRequestRejected:
+			if event.Reason == "" {
+				problem(line, "rejection event without reason")
+				continue
+			}
+			report.Rejected++
+		default:
+			problem(line, "unknown event type %q", event.Event)
+			continue
+		}
+
+		if event.Timestamp < maxTS-maxBackwardSkew {
+			problem(line, "timestamp %d goes back from %d", event.Timestamp, maxTS)
+		}
+		maxTS = max(maxTS, event.Timestamp)
+		if report.Events == 0 {
+			report.FirstTS = event.Timestamp
+		}
+		report.LastTS = event.Timestamp
+		report.Events++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestVerifyLogValid проверяет журнал без нарушений
+func TestVerifyLogValid(t *testing.T) {
+	log := `{"ts":100,"metrics":["Alloc"],"ip_address":"10.0.0.1"}
+{"ts":99,"metrics":null,"ip_address":"10.0.0.2","event":"request_rejected","reason":"invalid hash","path":"/update/"}
+
+{"ts":120,"metrics":["PollCount","Alloc"],"ip_address":"10.0.0.1","identity":"agent"}
+`
+	report, err := VerifyLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("VerifyLog failed: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("Expected no problems, got %+v", report.Problems)
+	}
+	if report.Events != 3 || report.Accepted != 2 || report.Rejected != 1 {
+		t.Errorf("Unexpected counts: %+v", report)
+	}
+	if report.FirstTS != 100 || report.LastTS != 120 {
+		t.Errorf("Unexpected time range: %d..%d", report.FirstTS, report.LastTS)
+	}
+}
+
+// TestVerifyLogProblems проверяет, что нарушения привязаны к строкам
+func TestVerifyLogProblems(t *testing.T) {
+	log := `{"ts":1000,"metrics":["Alloc"],"ip_address":"10.0.0.1"}
+{"ts":1001,"metrics":["Alloc"],"ip_address":"10.0.0.1"
+{"ts":1002,"metrics":["Alloc"],"ip_address":"10.0.0.1","admin":true}
+{"metrics":["Alloc"],"ip_address":"10.0.0.1"}
+{"ts":1003,"ip_address":"10.0.0.1","event":"request_rejected"}
+{"ts":1004,"ip_address":"10.0.0.1","event":"deleted"}
+{"ts":10,"metrics":["Alloc"],"ip_address":"10.0.0.1"}
+`
+	report, err := VerifyLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("VerifyLog failed: %v", err)
+	}
+
+	var lines []int
+	for _, p := range report.Problems {
+		lines = append(lines, p.Line)
+	}
+	expected := []int{2, 3, 4, 5, 6, 7}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected problems on lines %v, got %+v", expected, report.Problems)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Fatalf("Expected problems on lines %v, got %+v", expected, report.Problems)
+		}
+	}
+}
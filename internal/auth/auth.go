@@ -0,0 +1,76 @@
+// Package auth реализует аутентификацию клиентов API по токенам
+// и проверку ролей.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Role — роль клиента API.
+type Role string
+
+// Роли клиентов API
+const (
+	// RoleIngest — отправка метрик (агенты)
+	RoleIngest Role = "ingest"
+	// RoleRead — чтение метрик (дашборды, скрипты)
+	RoleRead Role = "read"
+	// RoleAdmin — все операции, включая административные
+	RoleAdmin Role = "admin"
+)
+
+// ParseRole разбирает название роли.
+func ParseRole(value string) (Role, error) {
+	switch role := Role(strings.TrimSpace(value)); role {
+	case RoleIngest, RoleRead, RoleAdmin:
+		return role, nil
+	default:
+		return "", fmt.Errorf("unknown role %q", value)
+	}
+}
+
+// ErrUnknownToken — токен не найден или отозван.
+var ErrUnknownToken = errors.New("unknown or revoked token")
+
+// Identity — клиент API, которому принадлежит токен.
+type Identity struct {
+	Name   string // имя токена, попадает в аудит
+	Roles  []Role
+	Tenant string // арендатор токена; пустой — арендатор из заголовка X-Tenant-ID
+}
+
+// HasRole проверяет, есть ли у клиента роль. Роль admin включает все остальные.
+func (i *Identity) HasRole(role Role) bool {
+	return slices.Contains(i.Roles, role) || slices.Contains(i.Roles, RoleAdmin)
+}
+
+// TokenStore ищет клиента по токену.
+type TokenStore interface {
+	Lookup(ctx context.Context, token string) (*Identity, error)
+}
+
+// HashToken возвращает SHA-256 токена в hex: в хранилищах токены
+// хранятся только в виде хеша.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type identityKey struct{}
+
+// WithIdentity сохраняет клиента в контексте запроса.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext возвращает клиента, прошедшего аутентификацию.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTokenFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestFileTokenStore(t *testing.T) {
+	path := writeTokenFile(t, `{"tokens": [
+		{"name": "agent-prod", "token": "ingest-secret", "roles": ["ingest"]},
+		{"name": "grafana", "token_sha256": "`+HashToken("read-secret")+`", "roles": ["read"], "tenant": "team-a"},
+		{"name": "ops", "token": "admin-secret", "roles": ["admin"]}
+	]}`)
+
+	store, err := LoadTokenFile(path)
+	require.NoError(t, err)
+
+	agent, err := store.Lookup(context.Background(), "ingest-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "agent-prod", agent.Name)
+	assert.True(t, agent.HasRole(RoleIngest))
+	assert.False(t, agent.HasRole(RoleRead))
+
+	grafana, err := store.Lookup(context.Background(), "read-secret")
+	require.NoError(t, err)
+	assert.True(t, grafana.HasRole(RoleRead))
+	assert.False(t, grafana.HasRole(RoleIngest))
+	assert.Equal(t, "team-a", grafana.Tenant)
+
+	// admin включает все роли
+	ops, err := store.Lookup(context.Background(), "admin-secret")
+	require.NoError(t, err)
+	assert.True(t, ops.HasRole(RoleIngest))
+	assert.True(t, ops.HasRole(RoleRead))
+
+	_, err = store.Lookup(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrUnknownToken)
+}
+
+func TestLoadTokenFile_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown role": `{"tokens": [{"name": "a", "token": "x", "roles": ["write"]}]}`,
+		"no name":      `{"tokens": [{"token": "x", "roles": ["read"]}]}`,
+		"no token":     `{"tokens": [{"name": "a", "roles": ["read"]}]}`,
+		"duplicate":    `{"tokens": [{"name": "a", "token": "x"}, {"name": "b", "token": "x"}]}`,
+		"not json":     `tokens`,
+		"bad tenant":   `{"tokens": [{"name": "a", "token": "x", "tenant": "a/b"}]}`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadTokenFile(writeTokenFile(t, content))
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Mihklz/metrixcollector/internal/tenant"
+)
+
+// tokenFileEntry — токен в файле. Вместо самого токена можно указать его SHA-256,
+// чтобы не хранить секрет в открытом виде.
+type tokenFileEntry struct {
+	Name        string   `json:"name"`
+	Token       string   `json:"token,omitempty"`
+	TokenSHA256 string   `json:"token_sha256,omitempty"`
+	Roles       []string `json:"roles"`
+	Tenant      string   `json:"tenant,omitempty"`
+}
+
+type tokenFile struct {
+	Tokens []tokenFileEntry `json:"tokens"`
+}
+
+// FileTokenStore — токены из JSON-файла, загруженные в память.
+type FileTokenStore struct {
+	byHash map[string]*Identity
+}
+
+// LoadTokenFile читает токены из JSON-файла вида
+// {"tokens": [{"name": "agent-prod", "token": "...", "roles": ["ingest"]},
+// {"name": "grafana", "token_sha256": "...", "roles": ["read"], "tenant": "team-a"}]}.
+func LoadTokenFile(path string) (*FileTokenStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file tokenFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse tokens file %s: %w", path, err)
+	}
+
+	store := &FileTokenStore{byHash: make(map[string]*Identity, len(file.Tokens))}
+	for i, entry := range file.Tokens {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("tokens file %s: token #%d has no name", path, i+1)
+		}
+
+		hash := entry.TokenSHA256
+		if entry.Token != "" {
+			hash = HashToken(entry.Token)
+		}
+		if hash == "" {
+			return nil, fmt.Errorf("tokens file %s: token %q has neither token nor token_sha256", path, entry.Name)
+		}
+		if _, exists := store.byHash[hash]; exists {
+			return nil, fmt.Errorf("tokens file %s: token %q is a duplicate", path, entry.Name)
+		}
+
+		identity := &Identity{Name: entry.Name, Tenant: entry.Tenant}
+		if entry.Tenant != "" {
+			if err := tenant.Validate(entry.Tenant); err != nil {
+				return nil, fmt.Errorf("tokens file %s: token %q: %w", path, entry.Name, err)
+			}
+		}
+		for _, value := range entry.Roles {
+			role, err := ParseRole(value)
+			if err != nil {
+				return nil, fmt.Errorf("tokens file %s: token %q: %w", path, entry.Name, err)
+			}
+			identity.Roles = append(identity.Roles, role)
+		}
+		store.byHash[hash] = identity
+	}
+
+	return store, nil
+}
+
+// Lookup ищет клиента по токену.
+func (s *FileTokenStore) Lookup(_ context.Context, token string) (*Identity, error) {
+	identity, ok := s.byHash[HashToken(token)]
+	if !ok {
+		return nil, ErrUnknownToken
+	}
+	return identity, nil
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PostgresTokenStore — токены из таблицы api_tokens (миграции 000002 и 000003).
+// Изменения в таблице (новые и отозванные токены) применяются без перезапуска сервера.
+type PostgresTokenStore struct {
+	db *sql.DB
+}
+
+// NewPostgresTokenStore создаёт хранилище токенов в PostgreSQL.
+func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
+	return &PostgresTokenStore{db: db}
+}
+
+// Lookup ищет действующий токен по его хешу.
+func (s *PostgresTokenStore) Lookup(ctx context.Context, token string) (*Identity, error) {
+	var name, roles string
+	var tenant sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT name, roles, tenant FROM api_tokens WHERE token_hash = $1 AND revoked_at IS NULL`,
+		HashToken(token),
+	).Scan(&name, &roles, &tenant)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnknownToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup token: %w", err)
+	}
+
+	identity := &Identity{Name: name, Tenant: tenant.String}
+	for _, value := range strings.Split(roles, ",") {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		role, err := ParseRole(value)
+		if err != nil {
+			return nil, fmt.Errorf("token %q: %w", name, err)
+		}
+		identity.Roles = append(identity.Roles, role)
+	}
+	return identity, nil
+}
@@ -5,32 +5,83 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type AgentConfig struct {
-	ServerAddr     string
+	ServerAddrs    []string // адреса серверов со схемой, например http://localhost:8080
+	ServerMode     string   // режим работы с несколькими серверами: failover или fanout
 	PollInterval   time.Duration
 	ReportInterval time.Duration
-	Key            string // ключ для подписи данных
-	RateLimit      int    // ограничение на число одновременных исходящих запросов
+	Key            string        // ключ для подписи данных
+	KeyID          string        // идентификатор ключа в связке ключей сервера
+	RateLimit      int           // ограничение на число одновременных исходящих запросов
+	StatsDAddr     string        // адрес UDP-приёмника StatsD (пусто — выключен)
+	SpoolDir       string        // каталог очереди неотправленных отчётов (пусто — выключена)
+	SpoolMaxBytes  int64         // максимальный размер очереди в байтах
+	SpoolMaxAge    time.Duration // максимальный возраст отчёта в очереди
+	Aggregations   string        // правила агрегации gauge за окно отчёта, например "HeapAlloc=max,avg;CPUutilization*=p95"
+	TLSCAFile      string        // CA для проверки сертификата сервера
+	TLSCertFile    string        // клиентский сертификат агента для mutual TLS
+	TLSKeyFile     string        // закрытый ключ клиентского сертификата
+	CryptoKey      string        // открытый RSA-ключ сервера в PEM для шифрования тел запросов
+	SignKey        string        // закрытый ключ Ed25519 агента в PEM для подписи запросов
+	AgentID        string        // идентификатор агента в реестре сервера
+	Token          string        // токен API с ролью ingest
+	Tenant         string        // арендатор, в пространство имён которого пишутся метрики
+}
+
+// TLSEnabled сообщает, что агент подключается к серверам по HTTPS.
+func (c *AgentConfig) TLSEnabled() bool {
+	return c.TLSCAFile != "" || c.TLSCertFile != ""
 }
 
 func LoadAgentConfig() *AgentConfig {
 	var (
 		serverAddr string
+		serverMode string
 		pollSec    int
 		reportSec  int
 		key        string
+		keyID      string
 		rateLimit  int
+		statsdAddr string
+		spoolDir   string
+		spoolBytes int64
+		spoolAge   int
+		aggregates string
+		tlsCAFile  string
+		tlsCert    string
+		tlsKey     string
+		cryptoKey  string
+		signKey    string
+		agentID    string
+		token      string
+		tenantID   string
 	)
 
 	// 1. Устанавливаем значения по умолчанию через флаги
-	flag.StringVar(&serverAddr, "a", "localhost:8080", "address of HTTP server")
+	flag.StringVar(&serverAddr, "a", "localhost:8080", "comma-separated addresses of HTTP servers")
+	flag.StringVar(&serverMode, "mode", "failover", "delivery mode for multiple servers: failover or fanout")
 	flag.IntVar(&pollSec, "p", 2, "poll interval in seconds")
 	flag.IntVar(&reportSec, "r", 10, "report interval in seconds")
 	flag.StringVar(&key, "k", "", "key for signing data")
+	flag.StringVar(&keyID, "key-id", "", "ID of the signing key in the server keyring")
 	flag.IntVar(&rateLimit, "l", 10, "rate limit for concurrent requests")
+	flag.StringVar(&statsdAddr, "statsd", "", "address of StatsD UDP listener, e.g. localhost:8125 (empty to disable)")
+	flag.StringVar(&spoolDir, "spool-dir", "", "directory for unsent reports (empty to disable)")
+	flag.Int64Var(&spoolBytes, "spool-max-size", 64<<20, "max total size of unsent reports in bytes")
+	flag.IntVar(&spoolAge, "spool-max-age", 86400, "max age of unsent reports in seconds")
+	flag.StringVar(&aggregates, "agg", "", "gauge aggregation rules over the report window, e.g. HeapAlloc=max,avg;CPUutilization*=p95")
+	flag.StringVar(&tlsCAFile, "tls-ca", "", "CA file for verifying server certificates (enables HTTPS)")
+	flag.StringVar(&tlsCert, "tls-cert", "", "client certificate file in PEM for mutual TLS")
+	flag.StringVar(&tlsKey, "tls-key", "", "client private key file in PEM for mutual TLS")
+	flag.StringVar(&cryptoKey, "crypto-key", "", "server RSA public key file in PEM for encrypting payloads")
+	flag.StringVar(&signKey, "sign-key", "", "agent Ed25519 private key file in PEM for signing requests")
+	flag.StringVar(&agentID, "agent-id", "", "agent ID registered on the server (defaults to hostname)")
+	flag.StringVar(&token, "token", "", "API token with the ingest role")
+	flag.StringVar(&tenantID, "tenant", "", "tenant whose metric namespace receives the metrics")
 	flag.Parse()
 
 	// 2. Проверяем переменные окружения (приоритет выше флагов)
@@ -40,6 +91,11 @@ func LoadAgentConfig() *AgentConfig {
 		serverAddr = envAddr
 	}
 
+	// SERVER_MODE - режим работы с несколькими серверами
+	if envMode := os.Getenv("SERVER_MODE"); envMode != "" {
+		serverMode = envMode
+	}
+
 	// POLL_INTERVAL - интервал сбора метрик в секундах
 	if envPollSec := os.Getenv("POLL_INTERVAL"); envPollSec != "" {
 		if parsedPoll, err := strconv.Atoi(envPollSec); err == nil {
@@ -63,6 +119,11 @@ func LoadAgentConfig() *AgentConfig {
 		key = envKey
 	}
 
+	// KEY_ID - идентификатор ключа подписи
+	if envKeyID := os.Getenv("KEY_ID"); envKeyID != "" {
+		keyID = envKeyID
+	}
+
 	// RATE_LIMIT - ограничение на количество одновременных запросов
 	if envRate := os.Getenv("RATE_LIMIT"); envRate != "" {
 		if v, err := strconv.Atoi(envRate); err == nil {
@@ -72,11 +133,123 @@ func LoadAgentConfig() *AgentConfig {
 		}
 	}
 
-	return &AgentConfig{
-		ServerAddr:     "http://" + serverAddr,
+	// STATSD_ADDRESS - адрес UDP-приёмника StatsD
+	if envStatsD := os.Getenv("STATSD_ADDRESS"); envStatsD != "" {
+		statsdAddr = envStatsD
+	}
+
+	// SPOOL_DIR - каталог очереди неотправленных отчётов
+	if envSpoolDir := os.Getenv("SPOOL_DIR"); envSpoolDir != "" {
+		spoolDir = envSpoolDir
+	}
+
+	// SPOOL_MAX_SIZE - максимальный размер очереди в байтах
+	if envSpoolSize := os.Getenv("SPOOL_MAX_SIZE"); envSpoolSize != "" {
+		if v, err := strconv.ParseInt(envSpoolSize, 10, 64); err == nil {
+			spoolBytes = v
+		} else {
+			log.Printf("Invalid SPOOL_MAX_SIZE value: %s, using default: %d", envSpoolSize, spoolBytes)
+		}
+	}
+
+	// SPOOL_MAX_AGE - максимальный возраст отчёта в очереди в секундах
+	if envSpoolAge := os.Getenv("SPOOL_MAX_AGE"); envSpoolAge != "" {
+		if v, err := strconv.Atoi(envSpoolAge); err == nil {
+			spoolAge = v
+		} else {
+			log.Printf("Invalid SPOOL_MAX_AGE value: %s, using default: %d", envSpoolAge, spoolAge)
+		}
+	}
+
+	// AGGREGATIONS - правила агрегации gauge-метрик
+	if envAgg := os.Getenv("AGGREGATIONS"); envAgg != "" {
+		aggregates = envAgg
+	}
+
+	// TLS_CA_FILE, TLS_CERT_FILE, TLS_KEY_FILE - настройки TLS
+	if envCA := os.Getenv("TLS_CA_FILE"); envCA != "" {
+		tlsCAFile = envCA
+	}
+	if envCert := os.Getenv("TLS_CERT_FILE"); envCert != "" {
+		tlsCert = envCert
+	}
+	if envKey := os.Getenv("TLS_KEY_FILE"); envKey != "" {
+		tlsKey = envKey
+	}
+
+	// CRYPTO_KEY - открытый ключ сервера для шифрования
+	if envCryptoKey := os.Getenv("CRYPTO_KEY"); envCryptoKey != "" {
+		cryptoKey = envCryptoKey
+	}
+
+	// SIGN_KEY, AGENT_ID - подпись запросов ключом агента
+	if envSignKey := os.Getenv("SIGN_KEY"); envSignKey != "" {
+		signKey = envSignKey
+	}
+	if envAgentID := os.Getenv("AGENT_ID"); envAgentID != "" {
+		agentID = envAgentID
+	}
+	if agentID == "" && signKey != "" {
+		if hostname, err := os.Hostname(); err == nil {
+			agentID = hostname
+		}
+	}
+
+	// API_TOKEN - токен API
+	if envToken := os.Getenv("API_TOKEN"); envToken != "" {
+		token = envToken
+	}
+
+	// TENANT_ID - арендатор
+	if envTenant := os.Getenv("TENANT_ID"); envTenant != "" {
+		tenantID = envTenant
+	}
+
+	cfg := &AgentConfig{
+		ServerMode:     serverMode,
 		PollInterval:   time.Duration(pollSec) * time.Second,
 		ReportInterval: time.Duration(reportSec) * time.Second,
 		Key:            key,
+		KeyID:          keyID,
 		RateLimit:      rateLimit,
+		StatsDAddr:     statsdAddr,
+		SpoolDir:       spoolDir,
+		SpoolMaxBytes:  spoolBytes,
+		SpoolMaxAge:    time.Duration(spoolAge) * time.Second,
+		Aggregations:   aggregates,
+		TLSCAFile:      tlsCAFile,
+		TLSCertFile:    tlsCert,
+		TLSKeyFile:     tlsKey,
+		CryptoKey:      cryptoKey,
+		SignKey:        signKey,
+		AgentID:        agentID,
+		Token:          token,
+		Tenant:         tenantID,
+	}
+
+	// Адреса без схемы получают https://, если настроен TLS
+	scheme := "http"
+	if cfg.TLSEnabled() {
+		scheme = "https"
+	}
+	cfg.ServerAddrs = parseServerAddrs(serverAddr, scheme)
+
+	return cfg
+}
+
+// parseServerAddrs разбирает список адресов через запятую.
+// Адресам без схемы добавляется указанная схема.
+func parseServerAddrs(value, scheme string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(value, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if !strings.Contains(addr, "://") {
+			addr = scheme + "://" + addr
+		}
+		addrs = append(addrs, strings.TrimSuffix(addr, "/"))
 	}
+	return addrs
 }
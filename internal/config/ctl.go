@@ -0,0 +1,82 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"time"
+)
+
+// CtlConfig — настройки утилиты metrixctl.
+type CtlConfig struct {
+	ServerAddr  string        // адрес сервера со схемой, например http://localhost:8080
+	Key         string        // ключ для подписи данных
+	KeyID       string        // идентификатор ключа в связке ключей сервера
+	Token       string        // токен API
+	Tenant      string        // арендатор
+	Timeout     time.Duration // таймаут одного запроса
+	TLSCAFile   string        // CA для проверки сертификата сервера
+	TLSCertFile string        // клиентский сертификат для mutual TLS
+	TLSKeyFile  string        // закрытый ключ клиентского сертификата
+}
+
+// TLSEnabled сообщает, что утилита подключается к серверу по HTTPS.
+func (c *CtlConfig) TLSEnabled() bool {
+	return c.TLSCAFile != "" || c.TLSCertFile != ""
+}
+
+// LoadCtlConfig разбирает общие флаги metrixctl из args (до имени команды)
+// и переменные окружения агента (ADDRESS, KEY, KEY_ID, API_TOKEN, TENANT_ID,
+// TLS_*). Возвращает конфигурацию и оставшиеся аргументы: команду и её параметры.
+func LoadCtlConfig(fs *flag.FlagSet, args []string) (*CtlConfig, []string, error) {
+	var (
+		serverAddr string
+		timeoutSec int
+	)
+	cfg := &CtlConfig{}
+
+	// 1. Устанавливаем значения по умолчанию через флаги
+	fs.StringVar(&serverAddr, "a", "localhost:8080", "server address")
+	fs.StringVar(&cfg.Key, "k", "", "key for signing requests")
+	fs.StringVar(&cfg.KeyID, "key-id", "", "ID of the signing key in the server keyring")
+	fs.StringVar(&cfg.Token, "token", "", "API token")
+	fs.StringVar(&cfg.Tenant, "tenant", "", "tenant whose metric namespace is used")
+	fs.IntVar(&timeoutSec, "timeout", 10, "request timeout in seconds")
+	fs.StringVar(&cfg.TLSCAFile, "tls-ca", "", "CA file for verifying server certificates (enables HTTPS)")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert", "", "client certificate file in PEM for mutual TLS")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key", "", "client private key file in PEM for mutual TLS")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	// 2. Переменные окружения (приоритет выше флагов, как у агента)
+	envs := map[string]*string{
+		"ADDRESS":       &serverAddr,
+		"KEY":           &cfg.Key,
+		"KEY_ID":        &cfg.KeyID,
+		"API_TOKEN":     &cfg.Token,
+		"TENANT_ID":     &cfg.Tenant,
+		"TLS_CA_FILE":   &cfg.TLSCAFile,
+		"TLS_CERT_FILE": &cfg.TLSCertFile,
+		"TLS_KEY_FILE":  &cfg.TLSKeyFile,
+	}
+	for name, value := range envs {
+		if env := os.Getenv(name); env != "" {
+			*value = env
+		}
+	}
+
+	cfg.Timeout = time.Duration(timeoutSec) * time.Second
+
+	// Адрес без схемы получает https://, если настроен TLS
+	scheme := "http"
+	if cfg.TLSEnabled() {
+		scheme = "https"
+	}
+	if addrs := parseServerAddrs(serverAddr, scheme); len(addrs) > 0 {
+		cfg.ServerAddr = addrs[0]
+	}
+	cfg.ServerAddr = strings.TrimSuffix(cfg.ServerAddr, "/")
+
+	return cfg, fs.Args(), nil
+}
@@ -4,17 +4,51 @@ import (
 	"flag"
 	"os"
 	"strconv"
+	"strings"
 )
 
 type ServerConfig struct {
 	RunAddr         string
-	StoreInterval   int    // интервал сохранения в секундах
-	FileStoragePath string // путь к файлу для сохранения метрик
-	Restore         bool   // загружать ли метрики при старте
-	DatabaseDSN     string // строка подключения к базе данных
-	Key             string // ключ для подписи данных
-	AuditFile       string // путь к файлу для логов аудита
-	AuditURL        string // URL для отправки логов аудита
+	StoreInterval   int      // интервал сохранения в секундах
+	FileStoragePath string   // путь к файлу для сохранения метрик
+	Restore         bool     // загружать ли метрики при старте
+	DatabaseDSN     string   // строка подключения к базе данных
+	Key             string   // ключ для подписи данных
+	AuditFile       string   // путь к файлу для логов аудита
+	AuditURL        string   // URL для отправки логов аудита
+	TLSCertFile     string   // сертификат сервера в PEM (пусто — HTTP без TLS)
+	TLSKeyFile      string   // закрытый ключ сертификата сервера в PEM
+	TLSClientCAFile string   // CA для проверки клиентских сертификатов (mutual TLS)
+	CryptoKey       string   // закрытый RSA-ключ в PEM для расшифровки тел запросов
+	AgentKeysFile   string   // реестр открытых ключей Ed25519 агентов
+	RequireAgentSig bool     // отклонять запросы на запись без подписи агента
+	KeyringFile     string   // JSON-файл со связкой ключей HMAC (заменяет Key)
+	ReplayWindow    int      // окно приёма подписанных запросов в секундах (0 — без защиты от повтора)
+	ReplayCacheSize int      // максимальное число запомненных nonce (сверх него подписанные запросы получают 503)
+	StrictHash      bool     // отклонять запросы без подписи HashSHA256, если задан ключ
+	HashExempt      []string // пути, не требующие подписи в строгом режиме ('*' в конце — префикс)
+	TrustedSubnets  []string // подсети агентов в нотации CIDR, из которых принимаются обновления
+	AuthTokensFile  string   // JSON-файл с токенами API и их ролями
+	AuthFromDB      bool     // брать токены API из таблицы api_tokens
+	TenantMaxSeries int      // максимальное число рядов метрик у арендатора (0 — без ограничения)
+	RateLimitRPS    float64  // запросов в секунду на агента с проверенной подписью или IP-адрес (0 — без ограничения)
+	RateLimitBurst  int      // запас запросов сверх RateLimitRPS (0 — одна секунда запросов)
+	MaxBodySize     int64    // максимальный размер тела запроса в байтах (0 — без ограничения)
+	MaxUnzippedSize int64    // максимальный размер распакованного gzip-тела в байтах (0 — без ограничения)
+	SeriesLimit     int      // максимальное число рядов метрик всех арендаторов (0 — без ограничения)
+	SeriesPrefixes  []string // лимиты рядов по префиксам имён вида "http_=1000"
+	SeriesPolicy    string   // что делать с рядами сверх лимита: reject или sample
+	SeriesSample    float64  // доля новых рядов, принимаемых сверх лимита в режиме sample
+	NamePattern     string   // регулярное выражение для имён метрик (пусто — по умолчанию)
+	MaxNameLength   int      // максимальная длина имени метрики (0 — без ограничения)
+	ReservedNames   []string // префиксы имён метрик, запрещённые для клиентов
+	AllowNonFinite  bool     // принимать NaN и ±Inf в gauge
+	MaxCounterDelta int64    // максимальный модуль приращения counter (0 — без ограничения)
+	RejectNegative  bool     // отклонять отрицательные приращения counter
+	IdempotencyTTL  int      // окно дедупликации запросов с Idempotency-Key в секундах (0 — без дедупликации)
+	IdempotencySize int      // максимальное число ключей идемпотентности в памяти
+	StreamBuffer    int      // буфер обновлений подписчика /api/v1/stream
+	StreamMaxSubs   int      // максимальное число подписчиков /api/v1/stream (0 — без ограничения)
 }
 
 func LoadServerConfig() *ServerConfig {
@@ -26,6 +60,39 @@ func LoadServerConfig() *ServerConfig {
 	var key string
 	var auditFile string
 	var auditURL string
+	var tlsCertFile string
+	var tlsKeyFile string
+	var tlsClientCAFile string
+	var cryptoKey string
+	var agentKeysFile string
+	var requireAgentSig bool
+	var keyringFile string
+	var replayWindow int
+	var replayCacheSize int
+	var strictHash bool
+	var hashExempt string
+	var trustedSubnet string
+	var authTokensFile string
+	var authFromDB bool
+	var tenantMaxSeries int
+	var rateLimitRPS float64
+	var rateLimitBurst int
+	var maxBodySize int64
+	var maxUnzippedSize int64
+	var seriesLimit int
+	var seriesPrefixes string
+	var seriesPolicy string
+	var seriesSample float64
+	var namePattern string
+	var maxNameLength int
+	var reservedNames string
+	var allowNonFinite bool
+	var maxCounterDelta int64
+	var rejectNegative bool
+	var idempotencyTTL int
+	var idempotencySize int
+	var streamBuffer int
+	var streamMaxSubs int
 
 	// 1. Устанавливаем значения по умолчанию
 	flag.StringVar(&runAddr, "a", "localhost:8080", "address and port to run HTTP server")
@@ -36,6 +103,39 @@ func LoadServerConfig() *ServerConfig {
 	flag.StringVar(&key, "k", "", "key for signing data")
 	flag.StringVar(&auditFile, "audit-file", "", "audit log file path")
 	flag.StringVar(&auditURL, "audit-url", "", "audit log URL")
+	flag.StringVar(&tlsCertFile, "tls-cert", "", "TLS certificate file in PEM (enables HTTPS)")
+	flag.StringVar(&tlsKeyFile, "tls-key", "", "TLS private key file in PEM")
+	flag.StringVar(&tlsClientCAFile, "tls-client-ca", "", "CA file for verifying agent certificates (enables mutual TLS)")
+	flag.StringVar(&cryptoKey, "crypto-key", "", "RSA private key file in PEM for decrypting agent payloads")
+	flag.StringVar(&agentKeysFile, "agent-keys", "", "file with agent IDs and their Ed25519 public keys")
+	flag.BoolVar(&requireAgentSig, "require-agent-signature", false, "reject write requests without an agent signature")
+	flag.StringVar(&keyringFile, "keyring", "", "JSON file with HMAC keys for rotation (overrides -k)")
+	flag.IntVar(&replayWindow, "replay-window", 0, "acceptance window for signed requests in seconds (0 disables replay protection)")
+	flag.IntVar(&replayCacheSize, "replay-cache-size", 100000, "max number of remembered request nonces; signed requests get 503 while the cache is full")
+	flag.BoolVar(&strictHash, "strict-hash", false, "reject requests without HashSHA256 when a key is configured")
+	flag.StringVar(&hashExempt, "hash-exempt", "/ping", "comma-separated paths exempt from strict hash mode, '*' suffix matches a prefix")
+	flag.StringVar(&trustedSubnet, "t", "", "comma-separated trusted agent subnets in CIDR notation (empty allows all)")
+	flag.StringVar(&authTokensFile, "auth-tokens", "", "JSON file with API tokens and roles (enables token authentication)")
+	flag.BoolVar(&authFromDB, "auth-db", false, "load API tokens from the api_tokens database table")
+	flag.IntVar(&tenantMaxSeries, "tenant-max-series", 0, "max number of metric series per tenant (0 for unlimited)")
+	flag.Float64Var(&rateLimitRPS, "rate-limit", 0, "max requests per second per verified agent or client IP (0 for unlimited)")
+	flag.IntVar(&rateLimitBurst, "rate-limit-burst", 0, "burst of requests allowed above the rate limit (0 for one second of requests)")
+	flag.Int64Var(&maxBodySize, "max-body-size", 10<<20, "max request body size in bytes (0 for unlimited)")
+	flag.Int64Var(&maxUnzippedSize, "max-decompressed-body-size", 64<<20, "max decompressed gzip body size in bytes (0 for unlimited)")
+	flag.IntVar(&seriesLimit, "series-limit", 0, "max number of metric series across all tenants (0 for unlimited)")
+	flag.StringVar(&seriesPrefixes, "series-prefix-limits", "", "comma-separated per-tenant series limits per name prefix, e.g. http_=1000,db.=500")
+	flag.StringVar(&seriesPolicy, "series-limit-policy", "reject", "what to do with new series past the limit: reject or sample")
+	flag.Float64Var(&seriesSample, "series-sample-rate", 0.01, "share of new series accepted past the limit in sample mode")
+	flag.StringVar(&namePattern, "metric-name-pattern", "", "regular expression for metric names (empty for the default)")
+	flag.IntVar(&maxNameLength, "metric-name-max-length", 255, "max metric name length in bytes (0 for unlimited)")
+	flag.StringVar(&reservedNames, "reserved-prefixes", "", "comma-separated metric name prefixes reserved for the server")
+	flag.BoolVar(&allowNonFinite, "allow-non-finite", false, "accept NaN and Inf gauge values")
+	flag.Int64Var(&maxCounterDelta, "max-counter-delta", 0, "max absolute counter delta (0 for unlimited)")
+	flag.BoolVar(&rejectNegative, "reject-negative-delta", false, "reject negative counter deltas")
+	flag.IntVar(&idempotencyTTL, "idempotency-window", 86400, "dedupe window for batches with Idempotency-Key in seconds (0 disables deduplication)")
+	flag.IntVar(&idempotencySize, "idempotency-cache-size", 100000, "max number of remembered idempotency keys in memory")
+	flag.IntVar(&streamBuffer, "stream-buffer", 256, "updates buffered per live stream subscriber before dropping")
+	flag.IntVar(&streamMaxSubs, "stream-max-subscribers", 1000, "max concurrent live stream subscribers (0 for unlimited)")
 	flag.Parse()
 
 	// 2. Проверяем переменные окружения (приоритет выше флагов)
@@ -75,6 +175,178 @@ func LoadServerConfig() *ServerConfig {
 		auditURL = envAuditURL
 	}
 
+	if envTLSCert, ok := os.LookupEnv("TLS_CERT_FILE"); ok {
+		tlsCertFile = envTLSCert
+	}
+
+	if envTLSKey, ok := os.LookupEnv("TLS_KEY_FILE"); ok {
+		tlsKeyFile = envTLSKey
+	}
+
+	if envTLSClientCA, ok := os.LookupEnv("TLS_CLIENT_CA_FILE"); ok {
+		tlsClientCAFile = envTLSClientCA
+	}
+
+	if envCryptoKey, ok := os.LookupEnv("CRYPTO_KEY"); ok {
+		cryptoKey = envCryptoKey
+	}
+
+	if envAgentKeys, ok := os.LookupEnv("AGENT_KEYS_FILE"); ok {
+		agentKeysFile = envAgentKeys
+	}
+
+	if envRequireSig, ok := os.LookupEnv("REQUIRE_AGENT_SIGNATURE"); ok {
+		if value, err := strconv.ParseBool(envRequireSig); err == nil {
+			requireAgentSig = value
+		}
+	}
+
+	if envKeyring, ok := os.LookupEnv("KEYRING_FILE"); ok {
+		keyringFile = envKeyring
+	}
+
+	if envReplayWindow, ok := os.LookupEnv("REPLAY_WINDOW"); ok {
+		if value, err := strconv.Atoi(envReplayWindow); err == nil {
+			replayWindow = value
+		}
+	}
+
+	if envReplayCache, ok := os.LookupEnv("REPLAY_CACHE_SIZE"); ok {
+		if value, err := strconv.Atoi(envReplayCache); err == nil {
+			replayCacheSize = value
+		}
+	}
+
+	if envStrictHash, ok := os.LookupEnv("STRICT_HASH"); ok {
+		if value, err := strconv.ParseBool(envStrictHash); err == nil {
+			strictHash = value
+		}
+	}
+
+	if envHashExempt, ok := os.LookupEnv("HASH_EXEMPT"); ok {
+		hashExempt = envHashExempt
+	}
+
+	if envTrustedSubnet, ok := os.LookupEnv("TRUSTED_SUBNET"); ok {
+		trustedSubnet = envTrustedSubnet
+	}
+
+	if envAuthTokens, ok := os.LookupEnv("AUTH_TOKENS_FILE"); ok {
+		authTokensFile = envAuthTokens
+	}
+
+	if envAuthDB, ok := os.LookupEnv("AUTH_DB"); ok {
+		if value, err := strconv.ParseBool(envAuthDB); err == nil {
+			authFromDB = value
+		}
+	}
+
+	if envTenantMaxSeries, ok := os.LookupEnv("TENANT_MAX_SERIES"); ok {
+		if value, err := strconv.Atoi(envTenantMaxSeries); err == nil {
+			tenantMaxSeries = value
+		}
+	}
+
+	if envRateLimit, ok := os.LookupEnv("RATE_LIMIT_RPS"); ok {
+		if value, err := strconv.ParseFloat(envRateLimit, 64); err == nil {
+			rateLimitRPS = value
+		}
+	}
+
+	if envRateBurst, ok := os.LookupEnv("RATE_LIMIT_BURST"); ok {
+		if value, err := strconv.Atoi(envRateBurst); err == nil {
+			rateLimitBurst = value
+		}
+	}
+
+	if envMaxBody, ok := os.LookupEnv("MAX_BODY_SIZE"); ok {
+		if value, err := strconv.ParseInt(envMaxBody, 10, 64); err == nil {
+			maxBodySize = value
+		}
+	}
+
+	if envMaxUnzipped, ok := os.LookupEnv("MAX_DECOMPRESSED_BODY_SIZE"); ok {
+		if value, err := strconv.ParseInt(envMaxUnzipped, 10, 64); err == nil {
+			maxUnzippedSize = value
+		}
+	}
+
+	if envSeriesLimit, ok := os.LookupEnv("SERIES_LIMIT"); ok {
+		if value, err := strconv.Atoi(envSeriesLimit); err == nil {
+			seriesLimit = value
+		}
+	}
+
+	if envSeriesPrefixes, ok := os.LookupEnv("SERIES_PREFIX_LIMITS"); ok {
+		seriesPrefixes = envSeriesPrefixes
+	}
+
+	if envSeriesPolicy, ok := os.LookupEnv("SERIES_LIMIT_POLICY"); ok {
+		seriesPolicy = envSeriesPolicy
+	}
+
+	if envSeriesSample, ok := os.LookupEnv("SERIES_SAMPLE_RATE"); ok {
+		if value, err := strconv.ParseFloat(envSeriesSample, 64); err == nil {
+			seriesSample = value
+		}
+	}
+
+	if envNamePattern, ok := os.LookupEnv("METRIC_NAME_PATTERN"); ok {
+		namePattern = envNamePattern
+	}
+
+	if envMaxNameLength, ok := os.LookupEnv("METRIC_NAME_MAX_LENGTH"); ok {
+		if value, err := strconv.Atoi(envMaxNameLength); err == nil {
+			maxNameLength = value
+		}
+	}
+
+	if envReserved, ok := os.LookupEnv("RESERVED_PREFIXES"); ok {
+		reservedNames = envReserved
+	}
+
+	if envNonFinite, ok := os.LookupEnv("ALLOW_NON_FINITE"); ok {
+		if value, err := strconv.ParseBool(envNonFinite); err == nil {
+			allowNonFinite = value
+		}
+	}
+
+	if envMaxDelta, ok := os.LookupEnv("MAX_COUNTER_DELTA"); ok {
+		if value, err := strconv.ParseInt(envMaxDelta, 10, 64); err == nil {
+			maxCounterDelta = value
+		}
+	}
+
+	if envRejectNegative, ok := os.LookupEnv("REJECT_NEGATIVE_DELTA"); ok {
+		if value, err := strconv.ParseBool(envRejectNegative); err == nil {
+			rejectNegative = value
+		}
+	}
+
+	if envIdempotencyTTL, ok := os.LookupEnv("IDEMPOTENCY_WINDOW"); ok {
+		if value, err := strconv.Atoi(envIdempotencyTTL); err == nil {
+			idempotencyTTL = value
+		}
+	}
+
+	if envIdempotencySize, ok := os.LookupEnv("IDEMPOTENCY_CACHE_SIZE"); ok {
+		if value, err := strconv.Atoi(envIdempotencySize); err == nil {
+			idempotencySize = value
+		}
+	}
+
+	if envStreamBuffer, ok := os.LookupEnv("STREAM_BUFFER"); ok {
+		if value, err := strconv.Atoi(envStreamBuffer); err == nil {
+			streamBuffer = value
+		}
+	}
+
+	if envStreamMaxSubs, ok := os.LookupEnv("STREAM_MAX_SUBSCRIBERS"); ok {
+		if value, err := strconv.Atoi(envStreamMaxSubs); err == nil {
+			streamMaxSubs = value
+		}
+	}
+
 	return &ServerConfig{
 		RunAddr:         runAddr,
 		StoreInterval:   storeInterval,
@@ -84,5 +356,49 @@ func LoadServerConfig() *ServerConfig {
 		Key:             key,
 		AuditFile:       auditFile,
 		AuditURL:        auditURL,
+		TLSCertFile:     tlsCertFile,
+		TLSKeyFile:      tlsKeyFile,
+		TLSClientCAFile: tlsClientCAFile,
+		CryptoKey:       cryptoKey,
+		AgentKeysFile:   agentKeysFile,
+		RequireAgentSig: requireAgentSig,
+		KeyringFile:     keyringFile,
+		ReplayWindow:    replayWindow,
+		ReplayCacheSize: replayCacheSize,
+		StrictHash:      strictHash,
+		HashExempt:      splitList(hashExempt),
+		TrustedSubnets:  splitList(trustedSubnet),
+		AuthTokensFile:  authTokensFile,
+		AuthFromDB:      authFromDB,
+		TenantMaxSeries: tenantMaxSeries,
+		RateLimitRPS:    rateLimitRPS,
+		RateLimitBurst:  rateLimitBurst,
+		MaxBodySize:     maxBodySize,
+		MaxUnzippedSize: maxUnzippedSize,
+		SeriesLimit:     seriesLimit,
+		SeriesPrefixes:  splitList(seriesPrefixes),
+		SeriesPolicy:    seriesPolicy,
+		SeriesSample:    seriesSample,
+		NamePattern:     namePattern,
+		MaxNameLength:   maxNameLength,
+		ReservedNames:   splitList(reservedNames),
+		AllowNonFinite:  allowNonFinite,
+		MaxCounterDelta: maxCounterDelta,
+		RejectNegative:  rejectNegative,
+		IdempotencyTTL:  idempotencyTTL,
+		IdempotencySize: idempotencySize,
+		StreamBuffer:    streamBuffer,
+		StreamMaxSubs:   streamMaxSubs,
+	}
+}
+
+// splitList разбирает список значений через запятую, пропуская пустые
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
@@ -0,0 +1,116 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Заголовки запроса, подписанного ключом агента
+const (
+	// AgentIDHeader содержит идентификатор агента из реестра сервера
+	AgentIDHeader = "X-Agent-ID"
+	// SignatureHeader содержит подпись Ed25519 тела запроса в base64
+	SignatureHeader = "X-Signature-Ed25519"
+)
+
+// LoadSigningKey читает закрытый ключ Ed25519 агента из PEM-файла (PKCS#8, блок PRIVATE KEY).
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse signing key %s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key in %s is not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+// SignEd25519 подписывает данные и возвращает подпись в base64.
+func SignEd25519(data []byte, key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+}
+
+// VerifyEd25519 проверяет подпись в base64, полученную от SignEd25519.
+func VerifyEd25519(data []byte, key ed25519.PublicKey, signature string) bool {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(key, data, sig)
+}
+
+// AgentRegistry — реестр агентов, которым разрешено присылать метрики,
+// и их открытых ключей Ed25519.
+type AgentRegistry struct {
+	keys map[string]ed25519.PublicKey
+}
+
+// NewAgentRegistry создаёт реестр из готового набора ключей.
+func NewAgentRegistry(keys map[string]ed25519.PublicKey) *AgentRegistry {
+	return &AgentRegistry{keys: keys}
+}
+
+// LoadAgentRegistry читает реестр из файла. Каждая строка содержит
+// идентификатор агента и его открытый ключ (32 байта в base64) через пробел;
+// пустые строки и строки, начинающиеся с '#', пропускаются.
+func LoadAgentRegistry(path string) (*AgentRegistry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys := make(map[string]ed25519.PublicKey)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<agent-id> <base64 public key>\"", path, lineNo)
+		}
+		raw, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s:%d: invalid Ed25519 public key for agent %q", path, lineNo, fields[0])
+		}
+		if _, exists := keys[fields[0]]; exists {
+			return nil, fmt.Errorf("%s:%d: duplicate agent %q", path, lineNo, fields[0])
+		}
+		keys[fields[0]] = ed25519.PublicKey(raw)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewAgentRegistry(keys), nil
+}
+
+// PublicKey возвращает открытый ключ агента.
+func (r *AgentRegistry) PublicKey(agentID string) (ed25519.PublicKey, bool) {
+	key, ok := r.keys[agentID]
+	return key, ok
+}
+
+// Len возвращает число агентов в реестре.
+func (r *AgentRegistry) Len() int {
+	return len(r.keys)
+}
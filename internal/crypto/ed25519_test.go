@@ -0,0 +1,83 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerifyEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	data := []byte(`{"id":"Alloc","type":"gauge","value":1}`)
+	sig := SignEd25519(data, priv)
+
+	assert.True(t, VerifyEd25519(data, pub, sig))
+	assert.False(t, VerifyEd25519([]byte("tampered"), pub, sig))
+	assert.False(t, VerifyEd25519(data, otherPub, sig))
+	assert.False(t, VerifyEd25519(data, pub, "not base64!"))
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "agent.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	loaded, err := LoadSigningKey(path)
+	require.NoError(t, err)
+	assert.True(t, priv.Equal(loaded))
+}
+
+func TestLoadAgentRegistry(t *testing.T) {
+	pub1, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pub2, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agents")
+	content := "# агенты продакшена\n" +
+		"web-1 " + base64.StdEncoding.EncodeToString(pub1) + "\n\n" +
+		"web-2\t" + base64.StdEncoding.EncodeToString(pub2) + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	registry, err := LoadAgentRegistry(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, registry.Len())
+
+	key, ok := registry.PublicKey("web-2")
+	require.True(t, ok)
+	assert.True(t, pub2.Equal(key))
+
+	_, ok = registry.PublicKey("web-3")
+	assert.False(t, ok)
+
+	invalid := map[string]string{
+		"bad key":   "web-1 c2hvcnQ=\n",
+		"no key":    "web-1\n",
+		"duplicate": "web-1 " + base64.StdEncoding.EncodeToString(pub1) + "\nweb-1 " + base64.StdEncoding.EncodeToString(pub2) + "\n",
+	}
+	for name, content := range invalid {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "invalid")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			_, err := LoadAgentRegistry(path)
+			assert.Error(t, err)
+		})
+	}
+}
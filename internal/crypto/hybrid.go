@@ -0,0 +1,200 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// EncryptionScheme — значение заголовка EncryptionHeader для гибридного шифрования:
+// случайный ключ AES-256-GCM шифрует тело, а сам ключ шифруется RSA-OAEP (SHA-256)
+// открытым ключом сервера.
+const EncryptionScheme = "rsa-oaep-aes256gcm"
+
+// Заголовки зашифрованного запроса
+const (
+	// EncryptionHeader содержит схему шифрования тела
+	EncryptionHeader = "X-Encryption"
+	// KeyFingerprintHeader содержит отпечаток открытого ключа, которым зашифрован запрос
+	KeyFingerprintHeader = "X-Encryption-Key"
+)
+
+// ErrKeyMismatch — данные зашифрованы не для этого закрытого ключа.
+var ErrKeyMismatch = errors.New("payload is encrypted with a different public key")
+
+// aesKeySize — размер ключа AES-256
+const aesKeySize = 32
+
+// LoadPublicKey читает открытый RSA-ключ из PEM-файла
+// (PUBLIC KEY, RSA PUBLIC KEY или сертификат).
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pub any
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		pub, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			pub = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse public key %s: %w", path, err)
+	}
+
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key in %s is not an RSA key", path)
+	}
+	return rsaPub, nil
+}
+
+// LoadPrivateKey читает закрытый RSA-ключ из PEM-файла (PKCS#1 или PKCS#8).
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse private key %s: %w", path, err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse private key %s: %w", path, err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("private key in %s is not an RSA key", path)
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+}
+
+// readPEM читает первый PEM-блок файла
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
+
+// KeyFingerprint возвращает короткий отпечаток открытого ключа (SHA-256 от DER).
+// По нему сервер сообщает о несовпадении ключей ещё до попытки расшифровки.
+func KeyFingerprint(pub *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Encrypt шифрует данные гибридной схемой EncryptionScheme.
+// Формат результата: длина зашифрованного ключа (2 байта, big endian),
+// зашифрованный ключ AES, nonce GCM, шифротекст с тегом.
+func Encrypt(pub *rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	aesKey := make([]byte, aesKeySize)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, fmt.Errorf("generate AES key: %w", err)
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, aesKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt AES key: %w", err)
+	}
+
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	out := make([]byte, 2, 2+len(wrappedKey)+len(nonce)+len(plaintext)+gcm.Overhead())
+	binary.BigEndian.PutUint16(out, uint16(len(wrappedKey)))
+	out = append(out, wrappedKey...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, nil), nil
+}
+
+// Decrypt расшифровывает данные, полученные от Encrypt.
+// Если данные зашифрованы для другого ключа, возвращает ErrKeyMismatch.
+func Decrypt(priv *rsa.PrivateKey, data []byte) ([]byte, error) {
+	if len(data) < 2 {
+		return nil, errors.New("encrypted payload is too short")
+	}
+	keyLen := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if keyLen != priv.Size() {
+		return nil, ErrKeyMismatch
+	}
+	if len(data) < keyLen {
+		return nil, errors.New("encrypted payload is truncated")
+	}
+
+	aesKey, err := rsa.DecryptOAEP(sha256.New(), nil, priv, data[:keyLen], nil)
+	if err != nil {
+		return nil, ErrKeyMismatch
+	}
+	data = data[keyLen:]
+
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted payload is truncated")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt payload: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create AES cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create GCM: %w", err)
+	}
+	return gcm, nil
+}
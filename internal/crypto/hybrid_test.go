@@ -0,0 +1,88 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRSAKeys сохраняет пару ключей в PEM-файлы и возвращает пути к ним
+func writeRSAKeys(t *testing.T, key *rsa.PrivateKey) (privFile, pubFile string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	privFile = filepath.Join(dir, "private.pem")
+	pubFile = filepath.Join(dir, "public.pem")
+	require.NoError(t, os.WriteFile(privFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600))
+	require.NoError(t, os.WriteFile(pubFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600))
+	return privFile, pubFile
+}
+
+func TestHybrid_EncryptDecrypt(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privFile, pubFile := writeRSAKeys(t, key)
+
+	priv, err := LoadPrivateKey(privFile)
+	require.NoError(t, err)
+	pub, err := LoadPublicKey(pubFile)
+	require.NoError(t, err)
+	assert.Equal(t, KeyFingerprint(&priv.PublicKey), KeyFingerprint(pub))
+
+	plaintext := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+	encrypted, err := Encrypt(pub, plaintext)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encrypted), "Alloc")
+
+	decrypted, err := Decrypt(priv, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	// Повреждённый шифротекст не проходит проверку GCM
+	encrypted[len(encrypted)-1] ^= 0xff
+	_, err = Decrypt(priv, encrypted)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrKeyMismatch)
+}
+
+func TestHybrid_KeyMismatch(t *testing.T) {
+	serverKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	encrypted, err := Encrypt(&otherKey.PublicKey, []byte("payload"))
+	require.NoError(t, err)
+
+	_, err = Decrypt(serverKey, encrypted)
+	assert.ErrorIs(t, err, ErrKeyMismatch)
+	assert.NotEqual(t, KeyFingerprint(&serverKey.PublicKey), KeyFingerprint(&otherKey.PublicKey))
+
+	_, err = Decrypt(serverKey, []byte{0})
+	assert.Error(t, err)
+}
+
+func TestLoadKeys_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pem")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a pem"), 0o600))
+
+	_, err := LoadPublicKey(garbage)
+	assert.Error(t, err)
+	_, err = LoadPrivateKey(garbage)
+	assert.Error(t, err)
+	_, err = LoadPrivateKey(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
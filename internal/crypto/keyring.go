@@ -0,0 +1,163 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// KeyIDHeader содержит идентификатор ключа, которым подписан запрос или ответ
+const KeyIDHeader = "HashKeyID"
+
+// KeyringKey — ключ HMAC в связке.
+type KeyringKey struct {
+	ID       string    `json:"id"`
+	Key      string    `json:"key"`
+	Primary  bool      `json:"primary,omitempty"` // этим ключом сервер подписывает ответы
+	RetireAt time.Time `json:"retire_at"`         // после этого момента ключ не принимается
+}
+
+// active сообщает, принимается ли ключ в момент now
+func (k KeyringKey) active(now time.Time) bool {
+	return k.RetireAt.IsZero() || now.Before(k.RetireAt)
+}
+
+// Keyring — связка ключей HMAC для ротации без одновременного перезапуска
+// всех агентов и серверов: сервер принимает подпись любым действующим ключом,
+// а ответы подписывает основным. Старые ключи выводятся из оборота по RetireAt.
+type Keyring struct {
+	keys []KeyringKey
+	now  func() time.Time
+}
+
+// keyringFile — формат файла связки ключей
+type keyringFile struct {
+	Keys []KeyringKey `json:"keys"`
+}
+
+// NewKeyring создаёт связку ключей. Ровно один ключ должен быть основным,
+// и у основного ключа не может быть срока вывода из оборота.
+func NewKeyring(keys []KeyringKey) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring is empty")
+	}
+
+	seen := make(map[string]bool, len(keys))
+	primaries := 0
+	for _, k := range keys {
+		if k.Key == "" {
+			return nil, fmt.Errorf("key %q is empty", k.ID)
+		}
+		if seen[k.ID] {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		seen[k.ID] = true
+
+		if k.Primary {
+			primaries++
+			if !k.RetireAt.IsZero() {
+				return nil, fmt.Errorf("primary key %q cannot have retire_at", k.ID)
+			}
+		}
+	}
+	if primaries != 1 {
+		return nil, fmt.Errorf("keyring must have exactly one primary key, got %d", primaries)
+	}
+
+	return &Keyring{keys: keys, now: time.Now}, nil
+}
+
+// NewStaticKeyring создаёт связку из одного ключа без идентификатора (флаг -k).
+// Для пустого ключа возвращает nil: подпись выключена.
+func NewStaticKeyring(key string) *Keyring {
+	if key == "" {
+		return nil
+	}
+	return &Keyring{
+		keys: []KeyringKey{{Key: key, Primary: true}},
+		now:  time.Now,
+	}
+}
+
+// LoadKeyring читает связку ключей из JSON-файла вида
+// {"keys": [{"id": "2024-06", "key": "...", "primary": true},
+// {"id": "2024-01", "key": "...", "retire_at": "2024-07-01T00:00:00Z"}]}.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse keyring %s: %w", path, err)
+	}
+
+	keyring, err := NewKeyring(file.Keys)
+	if err != nil {
+		return nil, fmt.Errorf("keyring %s: %w", path, err)
+	}
+	return keyring, nil
+}
+
+// Enabled сообщает, что связка содержит ключи и подпись включена.
+func (k *Keyring) Enabled() bool {
+	return k != nil && len(k.keys) > 0
+}
+
+// Sign подписывает данные основным ключом и возвращает идентификатор ключа и хеш.
+func (k *Keyring) Sign(data []byte) (keyID, hash string) {
+	if !k.Enabled() {
+		return "", ""
+	}
+	for _, key := range k.keys {
+		if key.Primary {
+			return key.ID, CalculateHMAC(data, key.Key)
+		}
+	}
+	return "", ""
+}
+
+// Verify проверяет подпись любым действующим ключом. Если указан keyID,
+// отозванный ключ с этим идентификатором отклоняется сразу.
+func (k *Keyring) Verify(data []byte, keyID, signature string) error {
+	if !k.Enabled() {
+		return nil
+	}
+	if signature == "" {
+		return errors.New("signature is missing")
+	}
+
+	now := k.now()
+	if keyID != "" {
+		for _, key := range k.keys {
+			if key.ID != keyID {
+				continue
+			}
+			if !key.active(now) {
+				return fmt.Errorf("key %q was retired at %s", keyID, key.RetireAt.Format(time.RFC3339))
+			}
+			if validateHMAC(data, key.Key, signature) {
+				return nil
+			}
+			return fmt.Errorf("signature does not match key %q", keyID)
+		}
+	}
+
+	// Агент без идентификатора ключа или с неизвестным идентификатором:
+	// пробуем все действующие ключи
+	for _, key := range k.keys {
+		if key.active(now) && validateHMAC(data, key.Key, signature) {
+			return nil
+		}
+	}
+	return errors.New("signature does not match any active key")
+}
+
+// validateHMAC сравнивает подпись за постоянное время
+func validateHMAC(data []byte, key, signature string) bool {
+	return hmac.Equal([]byte(CalculateHMAC(data, key)), []byte(signature))
+}
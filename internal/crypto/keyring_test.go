@@ -0,0 +1,92 @@
+package crypto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyring_RotationAndRetirement(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	keyring, err := NewKeyring([]KeyringKey{
+		{ID: "2024-06", Key: "new-secret", Primary: true},
+		{ID: "2024-01", Key: "old-secret", RetireAt: now.Add(time.Hour)},
+	})
+	require.NoError(t, err)
+	keyring.now = func() time.Time { return now }
+
+	data := []byte(`{"id":"Alloc"}`)
+	oldHash := CalculateHMAC(data, "old-secret")
+	newHash := CalculateHMAC(data, "new-secret")
+
+	// Ответы подписываются основным ключом
+	keyID, hash := keyring.Sign(data)
+	assert.Equal(t, "2024-06", keyID)
+	assert.Equal(t, newHash, hash)
+
+	// До вывода из оборота принимаются оба ключа, с идентификатором и без
+	assert.NoError(t, keyring.Verify(data, "2024-01", oldHash))
+	assert.NoError(t, keyring.Verify(data, "", oldHash))
+	assert.NoError(t, keyring.Verify(data, "2024-06", newHash))
+	assert.Error(t, keyring.Verify(data, "2024-06", oldHash))
+	assert.Error(t, keyring.Verify(data, "", CalculateHMAC(data, "unknown")))
+
+	// После RetireAt старый ключ больше не принимается
+	keyring.now = func() time.Time { return now.Add(2 * time.Hour) }
+	assert.ErrorContains(t, keyring.Verify(data, "2024-01", oldHash), "retired")
+	assert.Error(t, keyring.Verify(data, "", oldHash))
+	assert.NoError(t, keyring.Verify(data, "", newHash))
+}
+
+func TestKeyring_Invalid(t *testing.T) {
+	tests := map[string][]KeyringKey{
+		"empty":        nil,
+		"no primary":   {{ID: "a", Key: "x"}},
+		"two primary":  {{ID: "a", Key: "x", Primary: true}, {ID: "b", Key: "y", Primary: true}},
+		"duplicate id": {{ID: "a", Key: "x", Primary: true}, {ID: "a", Key: "y"}},
+		"empty key":    {{ID: "a", Primary: true}},
+		"retiring primary": {
+			{ID: "a", Key: "x", Primary: true, RetireAt: time.Now()},
+		},
+	}
+	for name, keys := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewKeyring(keys)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	content := `{"keys": [
+		{"id": "2024-06", "key": "new-secret", "primary": true},
+		{"id": "2024-01", "key": "old-secret", "retire_at": "2999-01-01T00:00:00Z"}
+	]}`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	keyring, err := LoadKeyring(path)
+	require.NoError(t, err)
+	assert.True(t, keyring.Enabled())
+
+	data := []byte("payload")
+	assert.NoError(t, keyring.Verify(data, "2024-01", CalculateHMAC(data, "old-secret")))
+}
+
+func TestStaticKeyring(t *testing.T) {
+	assert.Nil(t, NewStaticKeyring(""))
+	assert.False(t, NewStaticKeyring("").Enabled())
+
+	keyring := NewStaticKeyring("secret")
+	data := []byte("payload")
+	keyID, hash := keyring.Sign(data)
+	assert.Empty(t, keyID)
+	assert.Equal(t, CalculateHMAC(data, "secret"), hash)
+
+	// Агент с идентификатором ключа проходит проверку и на сервере с одним ключом
+	assert.NoError(t, keyring.Verify(data, "2024-06", hash))
+}
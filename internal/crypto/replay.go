@@ -0,0 +1,39 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// Заголовки защиты от повтора подписанных запросов
+const (
+	// TimestampHeader содержит время отправки запроса (Unix, секунды)
+	TimestampHeader = "X-Timestamp"
+	// NonceHeader содержит случайное одноразовое значение запроса
+	NonceHeader = "X-Nonce"
+)
+
+// NewNonce возвращает случайное одноразовое значение (128 бит в hex).
+func NewNonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SignedPayload возвращает данные, которые подписываются HMAC и Ed25519:
+// время и nonce входят в подпись, чтобы их нельзя было подменить при повторе.
+// Без времени и nonce подписывается только тело (прежний формат).
+func SignedPayload(timestamp, nonce string, body []byte) []byte {
+	if timestamp == "" && nonce == "" {
+		return body
+	}
+	payload := make([]byte, 0, len(timestamp)+len(nonce)+2+len(body))
+	payload = append(payload, timestamp...)
+	payload = append(payload, '\n')
+	payload = append(payload, nonce...)
+	payload = append(payload, '\n')
+	return append(payload, body...)
+}
@@ -0,0 +1,155 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPKI — самоподписанный CA и выпущенные им сертификаты в PEM-файлах
+type testPKI struct {
+	caFile, serverCert, serverKey, clientCert, clientKey string
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "metrix test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	pki := testPKI{caFile: filepath.Join(dir, "ca.pem")}
+	writePEM(t, pki.caFile, "CERTIFICATE", caDER)
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+
+		certFile := filepath.Join(dir, name+".pem")
+		keyFile := filepath.Join(dir, name+"-key.pem")
+		writePEM(t, certFile, "CERTIFICATE", der)
+		writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+		return certFile, keyFile
+	}
+
+	pki.serverCert, pki.serverKey = issue("server", 2, x509.ExtKeyUsageServerAuth)
+	pki.clientCert, pki.clientKey = issue("agent", 3, x509.ExtKeyUsageClientAuth)
+	return pki
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+// startTLSServer запускает тестовый сервер с заданной TLS-конфигурацией
+func startTLSServer(t *testing.T, cfg *tls.Config) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTLS_ServerVerifiedByCA(t *testing.T) {
+	pki := newTestPKI(t)
+
+	serverCfg, err := NewServerTLSConfig(pki.serverCert, pki.serverKey, "")
+	require.NoError(t, err)
+	srv := startTLSServer(t, serverCfg)
+
+	clientCfg, err := NewClientTLSConfig(pki.caFile, "", "")
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg}}
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Без нашего CA сертификат сервера не проходит проверку
+	_, err = (&http.Client{}).Get(srv.URL)
+	assert.Error(t, err)
+}
+
+func TestTLS_MutualAuthentication(t *testing.T) {
+	pki := newTestPKI(t)
+
+	serverCfg, err := NewServerTLSConfig(pki.serverCert, pki.serverKey, pki.caFile)
+	require.NoError(t, err)
+	srv := startTLSServer(t, serverCfg)
+
+	withCert, err := NewClientTLSConfig(pki.caFile, pki.clientCert, pki.clientKey)
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: withCert}}).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Агент без клиентского сертификата не проходит аутентификацию
+	withoutCert, err := NewClientTLSConfig(pki.caFile, "", "")
+	require.NoError(t, err)
+	_, err = (&http.Client{Transport: &http.Transport{TLSClientConfig: withoutCert}}).Get(srv.URL)
+	assert.Error(t, err)
+}
+
+func TestTLS_InvalidConfig(t *testing.T) {
+	pki := newTestPKI(t)
+
+	_, err := NewServerTLSConfig(pki.serverCert, "", "")
+	assert.Error(t, err)
+
+	_, err = NewServerTLSConfig(pki.serverCert, pki.serverKey, pki.serverKey)
+	assert.Error(t, err)
+
+	_, err = NewClientTLSConfig("", pki.clientCert, "")
+	assert.Error(t, err)
+
+	_, err = NewClientTLSConfig(filepath.Join(t.TempDir(), "missing.pem"), "", "")
+	assert.Error(t, err)
+}
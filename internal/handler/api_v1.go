@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/apierror"
+	"github.com/Mihklz/metrixcollector/internal/audit"
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/service"
+)
+
+// codeMetricNotFound — код ошибки API v1 для отсутствующей метрики
+const codeMetricNotFound = "metric_not_found"
+
+// Размер страницы списка метрик
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// codeInvalidQuery — код ошибки API v1 для некорректных параметров запроса
+const codeInvalidQuery = "invalid_query"
+
+// MetricList — ответ GET /api/v1/metrics
+type MetricList struct {
+	Metrics    []models.Metrics `json:"metrics"`
+	NextCursor string           `json:"next_cursor,omitempty"` // пусто — страница последняя
+}
+
+// NewAPIListMetricsHandler создаёт обработчик GET /api/v1/metrics.
+// Метрики арендатора упорядочены по типу и имени и отдаются страницами.
+// Параметры: type — тип метрики, prefix — префикс имени, regex — регулярное
+// выражение для имени, limit — размер страницы (по умолчанию 100, не больше 1000),
+// cursor — значение next_cursor предыдущей страницы.
+func NewAPIListMetricsHandler(storage repository.Storage, keyring *crypto.Keyring) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, ok := parseListQuery(w, r)
+		if !ok {
+			return
+		}
+
+		// Запрашиваем на одну метрику больше, чтобы узнать, есть ли следующая страница
+		limit := query.Limit
+		query.Limit++
+		metrics, err := repository.List(tenantStorage(r, storage), query)
+		if err != nil {
+			logger.Log.Error("Failed to list metrics", zap.Error(err))
+			apierror.Write(w, http.StatusInternalServerError, apierror.New(apierror.CodeInternal, "failed to list metrics"))
+			return
+		}
+
+		list := MetricList{Metrics: metrics}
+		if len(metrics) > limit {
+			list.Metrics = metrics[:limit]
+			last := list.Metrics[limit-1]
+			list.NextCursor = encodeCursor(last.MType, last.ID)
+		}
+		if list.Metrics == nil {
+			list.Metrics = []models.Metrics{}
+		}
+
+		writeAPIResponse(w, keyring, http.StatusOK, list)
+	}
+}
+
+// parseListQuery разбирает параметры списка метрик, отвечая 400 на ошибку
+func parseListQuery(w http.ResponseWriter, r *http.Request) (repository.ListQuery, bool) {
+	params := r.URL.Query()
+	query := repository.ListQuery{
+		Type:   params.Get("type"),
+		Prefix: params.Get("prefix"),
+		Regex:  params.Get("regex"),
+		Limit:  defaultListLimit,
+	}
+
+	invalid := func(param, message string) (repository.ListQuery, bool) {
+		apierror.Write(w, http.StatusBadRequest, apierror.New(codeInvalidQuery, message).
+			WithDetails(map[string]string{"param": param}))
+		return query, false
+	}
+
+	if query.Type != "" && query.Type != models.Gauge && query.Type != models.Counter {
+		return invalid("type", "unsupported metric type, expected 'gauge' or 'counter'")
+	}
+	if query.Regex != "" {
+		if _, err := regexp.Compile(query.Regex); err != nil {
+			return invalid("regex", "invalid regular expression: "+err.Error())
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return invalid("limit", fmt.Sprintf("limit must be between 1 and %d", maxListLimit))
+		}
+		query.Limit = limit
+	}
+	if value := params.Get("cursor"); value != "" {
+		after, err := decodeCursor(value)
+		if err != nil {
+			return invalid("cursor", "invalid cursor")
+		}
+		query.After = after
+	}
+	return query, true
+}
+
+// encodeCursor кодирует позицию последней метрики страницы
+func encodeCursor(metricType, name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(metricType + "/" + name))
+}
+
+// decodeCursor разбирает значение, полученное от encodeCursor
+func decodeCursor(cursor string) (*repository.ListAfter, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	metricType, name, found := strings.Cut(string(data), "/")
+	if !found || (metricType != models.Gauge && metricType != models.Counter) {
+		return nil, errors.New("malformed cursor")
+	}
+	return &repository.ListAfter{Type: metricType, Name: name}, nil
+}
+
+// NewAPIGetMetricHandler создаёт обработчик GET /api/v1/metrics/{type}/{name}.
+func NewAPIGetMetricHandler(storage repository.Storage, keyring *crypto.Keyring) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricType, name, ok := apiMetricPath(w, r)
+		if !ok {
+			return
+		}
+
+		metric, found := readMetric(tenantStorage(r, storage), metricType, name)
+		if !found {
+			writeMetricNotFound(w, metricType, name)
+			return
+		}
+		writeAPIResponse(w, keyring, http.StatusOK, metric)
+	}
+}
+
+// NewAPIUpdateMetricHandler создаёт обработчик PUT /api/v1/metrics/{type}/{name}.
+// Тело — метрика в формате JSON API (id и type можно не указывать),
+// ответ — значение метрики после обновления (для counter — накопленная сумма).
+func NewAPIUpdateMetricHandler(metricsService *service.MetricsService, keyring *crypto.Keyring, auditPublisher *audit.AuditPublisher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricType, name, ok := apiMetricPath(w, r)
+		if !ok {
+			return
+		}
+
+		var metric models.Metrics
+		if err := json.NewDecoder(r.Body).Decode(&metric); err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.New(apierror.CodeBadRequest, "invalid JSON body"))
+			return
+		}
+		if (metric.ID != "" && metric.ID != name) || (metric.MType != "" && metric.MType != metricType) {
+			apierror.Write(w, http.StatusBadRequest, apierror.New(apierror.CodeBadRequest, "metric id and type in body must match the URL"))
+			return
+		}
+		metric.ID, metric.MType = name, metricType
+
+		stored, err := requestService(r, metricsService).UpdateSingleReturning(metric)
+		if err != nil {
+			logger.Log.Info("Failed to save metric",
+				zap.String("id", metric.ID),
+				zap.String("type", metric.MType),
+				zap.Error(err),
+			)
+			writeAPIServiceError(w, err)
+			return
+		}
+
+		if auditPublisher != nil && auditPublisher.HasObservers() {
+			auditPublisher.Publish(newAuditEvent(r, []string{metric.ID}))
+		}
+
+		writeAPIResponse(w, keyring, http.StatusOK, stored)
+	}
+}
+
+// NewAPIDeleteMetricHandler создаёт обработчик DELETE /api/v1/metrics/{type}/{name}.
+// Отвечает 204 после удаления и 404, если метрики не было.
+func NewAPIDeleteMetricHandler(storage repository.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metricType, name, ok := apiMetricPath(w, r)
+		if !ok {
+			return
+		}
+
+		deleted, err := repository.Delete(tenantStorage(r, storage), metricType, name)
+		switch {
+		case errors.Is(err, repository.ErrDeleteUnsupported):
+			apierror.Write(w, http.StatusNotImplemented, apierror.New(apierror.CodeInternal, err.Error()))
+			return
+		case err != nil:
+			logger.Log.Error("Failed to delete metric", zap.String("id", name), zap.String("type", metricType), zap.Error(err))
+			apierror.Write(w, http.StatusInternalServerError, apierror.New(apierror.CodeInternal, "failed to delete metric"))
+			return
+		case !deleted:
+			writeMetricNotFound(w, metricType, name)
+			return
+		}
+
+		logger.Log.Info("Metric deleted",
+			zap.String("id", name),
+			zap.String("type", metricType),
+			zap.String("client", clientName(r)),
+		)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// apiMetricPath возвращает тип и имя метрики из URL, отвечая 400 на неизвестный тип
+func apiMetricPath(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	metricType := chi.URLParam(r, "type")
+	name := chi.URLParam(r, "name")
+	if metricType != models.Gauge && metricType != models.Counter {
+		writeAPIServiceError(w, &service.ValidationError{
+			Code:    service.CodeUnsupportedType,
+			Message: "unsupported metric type, expected 'gauge' or 'counter'",
+			Metric:  name,
+			Field:   "type",
+		})
+		return "", "", false
+	}
+	return metricType, name, true
+}
+
+// readMetric читает метрику из хранилища в формате JSON API
+func readMetric(storage repository.Storage, metricType, name string) (models.Metrics, bool) {
+	metric := models.Metrics{ID: name, MType: metricType}
+	switch metricType {
+	case models.Gauge:
+		value, found := storage.GetGauge(name)
+		if !found {
+			return metric, false
+		}
+		v := float64(value)
+		metric.Value = &v
+	case models.Counter:
+		value, found := storage.GetCounter(name)
+		if !found {
+			return metric, false
+		}
+		delta := int64(value)
+		metric.Delta = &delta
+	default:
+		return metric, false
+	}
+	return metric, true
+}
+
+// writeMetricNotFound отвечает 404 с указанием метрики
+func writeMetricNotFound(w http.ResponseWriter, metricType, name string) {
+	apierror.Write(w, http.StatusNotFound, apierror.New(codeMetricNotFound, "metric not found").
+		WithDetails(map[string]string{"id": name, "type": metricType}))
+}
+
+// writeAPIServiceError отвечает на ошибку сервиса метрик в формате apierror:
+// ошибка валидации — 400 с её кодом, превышение квоты или лимита рядов
+// и отброшенный выборкой ряд — 403, остальные ошибки — 500.
+func writeAPIServiceError(w http.ResponseWriter, err error) {
+	var validationErr *service.ValidationError
+	var limitErr *service.SeriesLimitError
+	switch {
+	case errors.As(err, &validationErr):
+		apiErr := apierror.New(validationErr.Code, validationErr.Message)
+		if validationErr.Metric != "" || validationErr.Field != "" {
+			apiErr = apiErr.WithDetails(map[string]string{"metric": validationErr.Metric, "field": validationErr.Field})
+		}
+		apierror.Write(w, http.StatusBadRequest, apiErr)
+	case errors.As(err, &limitErr):
+		apierror.Write(w, http.StatusForbidden, apierror.New(service.CodeSeriesLimit, limitErr.Error()).
+			WithDetails(map[string]any{"prefix": limitErr.Prefix, "limit": limitErr.Limit, "series": limitErr.Series}))
+	case errors.Is(err, repository.ErrSeriesQuotaExceeded):
+		apierror.Write(w, http.StatusForbidden, apierror.New(service.CodeSeriesQuota, err.Error()))
+	case errors.Is(err, service.ErrSeriesSampled):
+		apierror.Write(w, http.StatusForbidden, apierror.New(service.CodeSeriesSampled, err.Error()))
+	default:
+		apierror.Write(w, http.StatusInternalServerError, apierror.New(apierror.CodeInternal, "failed to save metric"))
+	}
+}
+
+// writeAPIResponse отвечает JSON с подписью HashSHA256
+func writeAPIResponse(w http.ResponseWriter, keyring *crypto.Keyring, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.Log.Error("Failed to encode response JSON", zap.Error(err))
+		apierror.Write(w, http.StatusInternalServerError, apierror.New(apierror.CodeInternal, "failed to encode response"))
+		return
+	}
+	WriteResponseWithHash(w, data, keyring, status, "application/json")
+}
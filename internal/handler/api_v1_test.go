@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/service"
+)
+
+// apiErrorBody — тело ответа с ошибкой в формате apierror
+type apiErrorBody struct {
+	Error struct {
+		Code    string         `json:"code"`
+		Message string         `json:"message"`
+		Details map[string]any `json:"details"`
+	} `json:"error"`
+}
+
+func newAPIRouter(storage *repository.MemStorage) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/api/v1/metrics", NewAPIListMetricsHandler(storage, nil))
+	r.Get("/api/v1/metrics/{type}/{name}", NewAPIGetMetricHandler(storage, nil))
+	r.Put("/api/v1/metrics/{type}/{name}", NewAPIUpdateMetricHandler(service.NewMetricsService(storage), nil, nil))
+	r.Delete("/api/v1/metrics/{type}/{name}", NewAPIDeleteMetricHandler(storage))
+	return r
+}
+
+func serveAPI(t *testing.T, h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeAPIError(t *testing.T, rec *httptest.ResponseRecorder) apiErrorBody {
+	t.Helper()
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var body apiErrorBody
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return body
+}
+
+func TestAPIv1_MetricLifecycle(t *testing.T) {
+	storage := repository.NewMemStorage()
+	h := newAPIRouter(storage)
+
+	rec := serveAPI(t, h, http.MethodPut, "/api/v1/metrics/counter/PollCount", `{"delta":3}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = serveAPI(t, h, http.MethodPut, "/api/v1/metrics/counter/PollCount", `{"delta":2}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// Ответ на обновление — накопленное значение
+	var metric models.Metrics
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &metric))
+	assert.Equal(t, int64(5), *metric.Delta)
+
+	rec = serveAPI(t, h, http.MethodPut, "/api/v1/metrics/gauge/Alloc", `{"id":"Alloc","type":"gauge","value":1.5}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serveAPI(t, h, http.MethodGet, "/api/v1/metrics", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list MetricList
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list.Metrics, 2)
+	assert.Equal(t, "PollCount", list.Metrics[0].ID)
+	assert.Equal(t, "Alloc", list.Metrics[1].ID)
+
+	rec = serveAPI(t, h, http.MethodGet, "/api/v1/metrics/gauge/Alloc", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &metric))
+	assert.Equal(t, 1.5, *metric.Value)
+
+	rec = serveAPI(t, h, http.MethodDelete, "/api/v1/metrics/gauge/Alloc", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	_, ok := storage.GetGauge("Alloc")
+	assert.False(t, ok)
+
+	rec = serveAPI(t, h, http.MethodDelete, "/api/v1/metrics/gauge/Alloc", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, codeMetricNotFound, decodeAPIError(t, rec).Error.Code)
+}
+
+// racingStorage имитирует запись другого клиента сразу после каждой записи
+type racingStorage struct {
+	*repository.MemStorage
+}
+
+func (s racingStorage) UpdateBatchReturning(metrics []models.Metrics) ([]models.Metrics, error) {
+	committed, err := s.MemStorage.UpdateBatchReturning(metrics)
+	if err == nil {
+		err = s.MemStorage.Update(models.Counter, "PollCount", "100")
+	}
+	return committed, err
+}
+
+func (s racingStorage) UpdateReturning(metricType, name, value string) (models.Metrics, error) {
+	committed, err := s.MemStorage.UpdateReturning(metricType, name, value)
+	if err == nil {
+		err = s.MemStorage.Update(models.Counter, "PollCount", "100")
+	}
+	return committed, err
+}
+
+func TestAPIv1_UpdateReturnsWrittenValue(t *testing.T) {
+	storage := racingStorage{MemStorage: repository.NewMemStorage()}
+	svc := service.NewMetricsService(storage)
+	h := chi.NewRouter()
+	h.Put("/api/v1/metrics/{type}/{name}", NewAPIUpdateMetricHandler(svc, nil, nil))
+
+	// В ответе — сумма после своей записи, а не после чужой
+	rec := serveAPI(t, h, http.MethodPut, "/api/v1/metrics/counter/PollCount", `{"delta":3}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var metric models.Metrics
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &metric))
+	assert.Equal(t, int64(3), *metric.Delta)
+
+	// Новый ряд, отброшенный выборкой, не сохранён, и клиент об этом узнаёт
+	svc.SetCardinalityLimiter(service.NewCardinalityLimiter(service.CardinalityLimits{
+		MaxSeries: 1,
+		Policy:    service.CardinalitySample,
+	}))
+	rec = serveAPI(t, h, http.MethodPut, "/api/v1/metrics/gauge/Alloc", `{"value":1}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, service.CodeSeriesSampled, decodeAPIError(t, rec).Error.Code)
+	_, found := storage.GetGauge("Alloc")
+	assert.False(t, found)
+}
+
+func TestAPIv1_Errors(t *testing.T) {
+	h := newAPIRouter(repository.NewMemStorage())
+
+	rec := serveAPI(t, h, http.MethodGet, "/api/v1/metrics/gauge/Missing", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	body := decodeAPIError(t, rec)
+	assert.Equal(t, codeMetricNotFound, body.Error.Code)
+	assert.Equal(t, "Missing", body.Error.Details["id"])
+
+	rec = serveAPI(t, h, http.MethodGet, "/api/v1/metrics/histogram/Latency", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, service.CodeUnsupportedType, decodeAPIError(t, rec).Error.Code)
+
+	rec = serveAPI(t, h, http.MethodPut, "/api/v1/metrics/gauge/Alloc", `{`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "bad_request", decodeAPIError(t, rec).Error.Code)
+
+	rec = serveAPI(t, h, http.MethodPut, "/api/v1/metrics/gauge/Alloc", `{"id":"Other","value":1}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serveAPI(t, h, http.MethodPut, "/api/v1/metrics/gauge/Alloc", `{}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	body = decodeAPIError(t, rec)
+	assert.Equal(t, service.CodeMissingValue, body.Error.Code)
+	assert.Equal(t, "Alloc", body.Error.Details["metric"])
+}
+
+func TestAPIv1_ListPagination(t *testing.T) {
+	storage := repository.NewMemStorage()
+	for _, name := range []string{"req_a", "req_b", "req_c", "Alloc"} {
+		require.NoError(t, storage.Update(models.Gauge, name, "1"))
+	}
+	require.NoError(t, storage.Update(models.Counter, "req_total", "1"))
+	h := newAPIRouter(storage)
+
+	var names []string
+	target := "/api/v1/metrics?type=gauge&prefix=req_&limit=2"
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		rec := serveAPI(t, h, http.MethodGet, target, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var list MetricList
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+		for _, metric := range list.Metrics {
+			names = append(names, metric.ID)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		target = "/api/v1/metrics?type=gauge&prefix=req_&limit=2&cursor=" + list.NextCursor
+	}
+	assert.Equal(t, []string{"req_a", "req_b", "req_c"}, names)
+
+	rec := serveAPI(t, h, http.MethodGet, "/api/v1/metrics?regex=_[a-b]$", "")
+	var list MetricList
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Len(t, list.Metrics, 2)
+
+	for _, query := range []string{"type=histogram", "limit=0", "limit=5000", "regex=(", "cursor=%21%21"} {
+		rec := serveAPI(t, h, http.MethodGet, "/api/v1/metrics?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.Equal(t, codeInvalidQuery, decodeAPIError(t, rec).Error.Code, query)
+	}
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/Mihklz/metrixcollector/internal/audit"
+	"github.com/Mihklz/metrixcollector/internal/auth"
+	"github.com/Mihklz/metrixcollector/internal/middleware"
+)
+
+// newAuditEvent создает событие аудита о принятых метриках
+// с IP-адресом и именем токена клиента
+func newAuditEvent(r *http.Request, metrics []string) *audit.AuditEvent {
+	event := audit.NewAuditEvent(metrics, audit.GetIPAddress(r))
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+		event.Identity = identity.Name
+	}
+	return event
+}
+
+// clientName возвращает имя клиента для статистики: имя токена,
+// идентификатор агента с проверенной подписью или IP-адрес соединения.
+// Непроверенным заголовкам (X-Agent-ID, X-Forwarded-For) не доверяем:
+// меняя их, клиент раскидал бы созданные ряды по множеству имён.
+func clientName(r *http.Request) string {
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+		return identity.Name
+	}
+	if agentID, ok := middleware.AgentIDFromContext(r.Context()); ok {
+		return agentID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/middleware"
+)
+
+func TestClientName(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	registry := crypto.NewAgentRegistry(map[string]ed25519.PublicKey{"agent-1": pub})
+
+	var name string
+	handler := middleware.WithSignatureValidation(registry, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name = clientName(r)
+	}))
+	serve := func(agentID string, sign bool) string {
+		body := `[]`
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", "192.0.2.1")
+		req.Header.Set(crypto.AgentIDHeader, agentID)
+		if sign {
+			req.Header.Set(crypto.SignatureHeader, crypto.SignEd25519(crypto.SignedPayload("", "", []byte(body)), priv))
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return name
+	}
+
+	// Идентификатору агента верим только после проверки подписи
+	assert.Equal(t, "agent-1", serve("agent-1", true))
+	assert.Equal(t, "10.0.0.1", serve("agent-1", false))
+	assert.Equal(t, "10.0.0.1", serve("random-id", false))
+}
@@ -7,6 +7,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/Mihklz/metrixcollector/internal/audit"
+	"github.com/Mihklz/metrixcollector/internal/crypto"
 	"github.com/Mihklz/metrixcollector/internal/logger"
 	models "github.com/Mihklz/metrixcollector/internal/model"
 	"github.com/Mihklz/metrixcollector/internal/service"
@@ -15,15 +16,15 @@ import (
 // BatchUpdateHandler обрабатывает запросы для пакетного обновления метрик.
 type BatchUpdateHandler struct {
 	metricsService *service.MetricsService
-	key            string
+	keyring        *crypto.Keyring
 	auditPublisher *audit.AuditPublisher
 }
 
 // NewBatchUpdateHandler создает новый обработчик для пакетного обновления метрик.
-func NewBatchUpdateHandler(metricsService *service.MetricsService, key string, auditPublisher *audit.AuditPublisher) http.HandlerFunc {
+func NewBatchUpdateHandler(metricsService *service.MetricsService, keyring *crypto.Keyring, auditPublisher *audit.AuditPublisher) http.HandlerFunc {
 	handler := &BatchUpdateHandler{
 		metricsService: metricsService,
-		key:            key,
+		keyring:        keyring,
 		auditPublisher: auditPublisher,
 	}
 	return handler.Handle
@@ -51,28 +52,66 @@ func (h *BatchUpdateHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Header.Get(models.BatchModeHeader) == models.BatchModePartial {
+		h.handlePartial(w, r, metrics)
+		return
+	}
+
 	// Используем сервис для обновления метрик
-	if err := h.metricsService.UpdateBatch(metrics); err != nil {
-		// Проверяем тип ошибки - если это ошибка валидации, возвращаем 400
-		if service.IsValidationError(err) {
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
+	committed, err := requestService(r, h.metricsService).UpdateBatchReturning(metrics)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	// Публикуем событие аудита только о сохранённых метриках: новые ряды,
+	// отброшенные выборкой, не записаны
+	h.publishAudit(r, committed, nil)
+
+	// Отправляем пустой ответ с хешем
+	WriteResponseWithHash(w, []byte(""), h.keyring, http.StatusOK, "application/json")
+}
+
+// handlePartial сохраняет корректные метрики пакета и возвращает
+// ошибки остальных в теле ответа (режим X-Batch-Mode: partial)
+func (h *BatchUpdateHandler) handlePartial(w http.ResponseWriter, r *http.Request, metrics []models.Metrics) {
+	result, err := requestService(r, h.metricsService).UpdateBatchPartial(metrics)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if result.Accepted > 0 {
+		failed := make(map[int]struct{}, len(result.Errors))
+		for _, itemErr := range result.Errors {
+			failed[itemErr.Index] = struct{}{}
 		}
+		h.publishAudit(r, metrics, failed)
+	}
+
+	responseData, err := json.Marshal(result)
+	if err != nil {
+		logger.Log.Error("Failed to encode batch result", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	WriteResponseWithHash(w, responseData, h.keyring, http.StatusOK, "application/json")
+}
+
+// publishAudit публикует событие аудита с именами сохранённых метрик,
+// пропуская метрики с индексами из failed
+func (h *BatchUpdateHandler) publishAudit(r *http.Request, metrics []models.Metrics, failed map[int]struct{}) {
+	if h.auditPublisher == nil || !h.auditPublisher.HasObservers() {
 		return
 	}
 
-	// Публикуем событие аудита после успешной обработки
-	if h.auditPublisher != nil && h.auditPublisher.HasObservers() {
-		// Собираем имена всех метрик
-		metricNames := make([]string, 0, len(metrics))
-		for _, m := range metrics {
+	// Собираем имена всех метрик
+	metricNames := make([]string, 0, len(metrics))
+	for i, m := range metrics {
+		if _, ok := failed[i]; !ok {
 			metricNames = append(metricNames, m.ID)
 		}
-		event := audit.NewAuditEvent(metricNames, audit.GetIPAddress(r))
-		h.auditPublisher.Publish(event)
 	}
-
-	// Отправляем пустой ответ с хешем
-	WriteResponseWithHash(w, []byte(""), h.key, http.StatusOK, "application/json")
+	event := newAuditEvent(r, metricNames)
+	h.auditPublisher.Publish(event)
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Mihklz/metrixcollector/internal/audit"
+	models "github.com/Mihklz/metrixcollector/internal/model"
 	"github.com/Mihklz/metrixcollector/internal/repository"
 	"github.com/Mihklz/metrixcollector/internal/service"
 )
@@ -20,7 +21,7 @@ func TestBatchUpdateHandlerWithAudit(t *testing.T) {
 	observer := &mockAuditObserver{events: make([]*audit.AuditEvent, 0)}
 	publisher.Subscribe(observer)
 
-	handler := NewBatchUpdateHandler(metricsService, "", publisher)
+	handler := NewBatchUpdateHandler(metricsService, nil, publisher)
 
 	jsonBody := `[
 		{"id":"Metric1","type":"gauge","value":123.45},
@@ -75,11 +76,54 @@ func TestBatchUpdateHandlerWithAudit(t *testing.T) {
 	}
 }
 
+// TestBatchUpdateHandlerAuditSkipsSampled проверяет, что в аудит не попадают
+// новые ряды, отброшенные выборкой
+func TestBatchUpdateHandlerAuditSkipsSampled(t *testing.T) {
+	storage := repository.NewMemStorage()
+	metricsService := service.NewMetricsService(storage)
+	metricsService.SetCardinalityLimiter(service.NewCardinalityLimiter(service.CardinalityLimits{
+		MaxSeries: 1,
+		Policy:    service.CardinalitySample,
+	}))
+
+	for _, partial := range []bool{false, true} {
+		publisher := audit.NewAuditPublisher()
+		observer := &mockAuditObserver{events: make([]*audit.AuditEvent, 0)}
+		publisher.Subscribe(observer)
+		handler := NewBatchUpdateHandler(metricsService, nil, publisher)
+
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewBufferString(`[
+			{"id":"Metric1","type":"gauge","value":1},
+			{"id":"Sampled","type":"gauge","value":2}
+		]`))
+		req.Header.Set("Content-Type", "application/json")
+		if partial {
+			req.Header.Set(models.BatchModeHeader, models.BatchModePartial)
+		}
+		w := httptest.NewRecorder()
+
+		handler(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status OK, got %d", w.Code)
+		}
+
+		time.Sleep(150 * time.Millisecond)
+
+		if len(observer.events) != 1 {
+			t.Fatalf("Expected 1 audit event, got %d", len(observer.events))
+		}
+		if metrics := observer.events[0].Metrics; len(metrics) != 1 || metrics[0] != "Metric1" {
+			t.Errorf("Expected only Metric1 in audit event (partial=%v), got %v", partial, metrics)
+		}
+	}
+}
+
 // TestBatchUpdateHandlerWithoutAudit проверяет работу без аудита
 func TestBatchUpdateHandlerWithoutAudit(t *testing.T) {
 	storage := repository.NewMemStorage()
 	metricsService := service.NewMetricsService(storage)
-	handler := NewBatchUpdateHandler(metricsService, "", nil)
+	handler := NewBatchUpdateHandler(metricsService, nil, nil)
 
 	jsonBody := `[{"id":"Metric1","type":"gauge","value":1.0}]`
 
@@ -102,7 +146,7 @@ func TestBatchUpdateHandlerAuditOnlyOnSuccess(t *testing.T) {
 	observer := &mockAuditObserver{events: make([]*audit.AuditEvent, 0)}
 	publisher.Subscribe(observer)
 
-	handler := NewBatchUpdateHandler(metricsService, "", publisher)
+	handler := NewBatchUpdateHandler(metricsService, nil, publisher)
 
 	// Невалидный JSON
 	jsonBody := `[{"invalid": "data"`
@@ -132,7 +176,7 @@ func TestBatchUpdateHandlerEmptyBatch(t *testing.T) {
 	observer := &mockAuditObserver{events: make([]*audit.AuditEvent, 0)}
 	publisher.Subscribe(observer)
 
-	handler := NewBatchUpdateHandler(metricsService, "", publisher)
+	handler := NewBatchUpdateHandler(metricsService, nil, publisher)
 
 	jsonBody := `[]`
 
@@ -163,7 +207,7 @@ func TestBatchUpdateHandlerLargeBatch(t *testing.T) {
 	observer := &mockAuditObserver{events: make([]*audit.AuditEvent, 0)}
 	publisher.Subscribe(observer)
 
-	handler := NewBatchUpdateHandler(metricsService, "", publisher)
+	handler := NewBatchUpdateHandler(metricsService, nil, publisher)
 
 	// Создаем батч с 100 метриками
 	var jsonBody bytes.Buffer
@@ -26,7 +26,7 @@ func init() {
 func TestBatchUpdateHandler(t *testing.T) {
 	storage := repository.NewMemStorage()
 	metricsService := service.NewMetricsService(storage)
-	handler := NewBatchUpdateHandler(metricsService, "", nil)
+	handler := NewBatchUpdateHandler(metricsService, nil, nil)
 
 	tests := []struct {
 		name           string
@@ -132,7 +132,7 @@ func TestBatchUpdateHandler(t *testing.T) {
 func TestBatchUpdateHandlerMethods(t *testing.T) {
 	storage := repository.NewMemStorage()
 	metricsService := service.NewMetricsService(storage)
-	handler := NewBatchUpdateHandler(metricsService, "", nil)
+	handler := NewBatchUpdateHandler(metricsService, nil, nil)
 
 	tests := []struct {
 		name           string
@@ -172,7 +172,7 @@ func TestBatchUpdateHandlerMethods(t *testing.T) {
 func TestBatchUpdateHandlerContentType(t *testing.T) {
 	storage := repository.NewMemStorage()
 	metricsService := service.NewMetricsService(storage)
-	handler := NewBatchUpdateHandler(metricsService, "", nil)
+	handler := NewBatchUpdateHandler(metricsService, nil, nil)
 
 	tests := []struct {
 		name           string
@@ -210,3 +210,35 @@ func TestBatchUpdateHandlerContentType(t *testing.T) {
 		})
 	}
 }
+
+func TestBatchUpdateHandlerPartial(t *testing.T) {
+	storage := repository.NewMemStorage()
+	handler := NewBatchUpdateHandler(service.NewMetricsService(storage), nil, nil)
+
+	value := 1.5
+	body, err := json.Marshal([]models.Metrics{
+		{ID: "Alloc", MType: models.Gauge, Value: &value},
+		{ID: "PollCount", MType: models.Counter},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(models.BatchModeHeader, models.BatchModePartial)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	// Некорректная метрика не мешает сохранить остальные
+	require.Equal(t, http.StatusOK, w.Code)
+	var result models.BatchResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.Accepted)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, 1, result.Errors[0].Index)
+	assert.Equal(t, "PollCount", result.Errors[0].ID)
+	assert.Equal(t, service.CodeMissingValue, result.Errors[0].Code)
+
+	stored, ok := storage.GetGauge("Alloc")
+	assert.True(t, ok)
+	assert.Equal(t, value, float64(stored))
+}
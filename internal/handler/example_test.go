@@ -8,12 +8,13 @@ import (
 
 	models "github.com/Mihklz/metrixcollector/internal/model"
 	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/service"
 )
 
 // ExampleNewJSONUpdateHandler демонстрирует работу JSON-эндпоинта обновления метрик.
 func ExampleNewJSONUpdateHandler() {
 	storage := repository.NewMemStorage()
-	handler := NewJSONUpdateHandler(storage, "", nil)
+	handler := NewJSONUpdateHandler(service.NewMetricsService(storage), nil, nil)
 
 	body, _ := json.Marshal(models.Metrics{
 		ID:    "Alloc",
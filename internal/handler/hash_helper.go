@@ -6,12 +6,16 @@ import (
 	"github.com/Mihklz/metrixcollector/internal/crypto"
 )
 
-// WriteResponseWithHash записывает ответ с добавлением хеша в заголовок, если есть ключ
-func WriteResponseWithHash(w http.ResponseWriter, data []byte, key string, statusCode int, contentType string) {
+// WriteResponseWithHash записывает ответ с добавлением хеша в заголовок,
+// если заданы ключи. Ответ подписывается основным ключом связки.
+func WriteResponseWithHash(w http.ResponseWriter, data []byte, keyring *crypto.Keyring, statusCode int, contentType string) {
 	// Добавляем хеш в заголовок, если есть ключ
-	if key != "" && len(data) > 0 {
-		hash := crypto.CalculateHMAC(data, key)
+	if keyring.Enabled() && len(data) > 0 {
+		keyID, hash := keyring.Sign(data)
 		w.Header().Set("HashSHA256", hash)
+		if keyID != "" {
+			w.Header().Set(crypto.KeyIDHeader, keyID)
+		}
 	}
 
 	// Устанавливаем Content-Type, если указан
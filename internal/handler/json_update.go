@@ -2,15 +2,15 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 
 	"go.uber.org/zap"
 
 	"github.com/Mihklz/metrixcollector/internal/audit"
+	"github.com/Mihklz/metrixcollector/internal/crypto"
 	"github.com/Mihklz/metrixcollector/internal/logger"
 	models "github.com/Mihklz/metrixcollector/internal/model"
-	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/service"
 )
 
 // validateJSONRequest проверяет HTTP метод, Content-Type и декодирует JSON
@@ -60,8 +60,8 @@ func validateJSONRequest(w http.ResponseWriter, r *http.Request) (*models.Metric
 }
 
 // NewJSONUpdateHandler создаёт обработчик JSON API для обновления метрик.
-// Обработчик принимает POST /update и сохраняет значение в хранилище.
-func NewJSONUpdateHandler(storage repository.Storage, key string, auditPublisher *audit.AuditPublisher) http.HandlerFunc {
+// Обработчик принимает POST /update и сохраняет значение через сервис метрик.
+func NewJSONUpdateHandler(metricsService *service.MetricsService, keyring *crypto.Keyring, auditPublisher *audit.AuditPublisher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Общая валидация и декодирование
 		metric, ok := validateJSONRequest(w, r)
@@ -69,40 +69,14 @@ func NewJSONUpdateHandler(storage repository.Storage, key string, auditPublisher
 			return
 		}
 
-		// Валидируем тип метрики и наличие соответствующего значения
-		var valueStr string
-		switch metric.MType {
-		case models.Gauge:
-			if metric.Value == nil {
-				http.Error(w, "value is required for gauge metric", http.StatusBadRequest)
-				return
-			}
-			// Конвертируем float64 в строку для storage.Update
-			valueStr = fmt.Sprintf("%g", *metric.Value)
-
-		case models.Counter:
-			if metric.Delta == nil {
-				http.Error(w, "delta is required for counter metric", http.StatusBadRequest)
-				return
-			}
-			// Конвертируем int64 в строку для storage.Update
-			valueStr = fmt.Sprintf("%d", *metric.Delta)
-
-		default:
-			http.Error(w, "unsupported metric type, expected 'gauge' or 'counter'", http.StatusBadRequest)
-			return
-		}
-
-		// Сохраняем метрику через существующий интерфейс
-		err := storage.Update(metric.MType, metric.ID, valueStr)
-		if err != nil {
-			logger.Log.Error("Failed to save metric",
+		// Проверяем и сохраняем метрику через сервис
+		if err := requestService(r, metricsService).UpdateSingle(*metric); err != nil {
+			logger.Log.Info("Failed to save metric",
 				zap.String("id", metric.ID),
 				zap.String("type", metric.MType),
-				zap.String("value", valueStr),
 				zap.Error(err),
 			)
-			http.Error(w, "failed to save metric", http.StatusInternalServerError)
+			writeServiceError(w, err)
 			return
 		}
 
@@ -114,7 +88,7 @@ func NewJSONUpdateHandler(storage repository.Storage, key string, auditPublisher
 
 		// Публикуем событие аудита после успешной обработки
 		if auditPublisher != nil && auditPublisher.HasObservers() {
-			event := audit.NewAuditEvent([]string{metric.ID}, audit.GetIPAddress(r))
+			event := newAuditEvent(r, []string{metric.ID})
 			auditPublisher.Publish(event)
 		}
 
@@ -126,6 +100,6 @@ func NewJSONUpdateHandler(storage repository.Storage, key string, auditPublisher
 			return
 		}
 
-		WriteResponseWithHash(w, responseData, key, http.StatusOK, "application/json")
+		WriteResponseWithHash(w, responseData, keyring, http.StatusOK, "application/json")
 	}
 }
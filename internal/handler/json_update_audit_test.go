@@ -9,6 +9,7 @@ import (
 
 	"github.com/Mihklz/metrixcollector/internal/audit"
 	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/service"
 )
 
 // TestJSONUpdateHandlerWithAudit проверяет интеграцию аудита с JSON API
@@ -18,7 +19,7 @@ func TestJSONUpdateHandlerWithAudit(t *testing.T) {
 	observer := &mockAuditObserver{events: make([]*audit.AuditEvent, 0)}
 	publisher.Subscribe(observer)
 
-	handler := NewJSONUpdateHandler(storage, "", publisher)
+	handler := NewJSONUpdateHandler(service.NewMetricsService(storage), nil, publisher)
 
 	jsonBody := `{"id":"TestCounter","type":"counter","delta":100}`
 	req := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewBufferString(jsonBody))
@@ -55,7 +56,7 @@ func TestJSONUpdateHandlerWithAudit(t *testing.T) {
 // TestJSONUpdateHandlerWithoutAudit проверяет работу без аудита
 func TestJSONUpdateHandlerWithoutAudit(t *testing.T) {
 	storage := repository.NewMemStorage()
-	handler := NewJSONUpdateHandler(storage, "", nil)
+	handler := NewJSONUpdateHandler(service.NewMetricsService(storage), nil, nil)
 
 	jsonBody := `{"id":"TestGauge","type":"gauge","value":42.5}`
 	req := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewBufferString(jsonBody))
@@ -76,7 +77,7 @@ func TestJSONUpdateHandlerAuditOnlyOnSuccess(t *testing.T) {
 	observer := &mockAuditObserver{events: make([]*audit.AuditEvent, 0)}
 	publisher.Subscribe(observer)
 
-	handler := NewJSONUpdateHandler(storage, "", publisher)
+	handler := NewJSONUpdateHandler(service.NewMetricsService(storage), nil, publisher)
 
 	// Невалидный JSON
 	jsonBody := `{"invalid json`
@@ -104,7 +105,7 @@ func TestJSONUpdateHandlerAuditMultipleRequests(t *testing.T) {
 	observer := &mockAuditObserver{events: make([]*audit.AuditEvent, 0)}
 	publisher.Subscribe(observer)
 
-	handler := NewJSONUpdateHandler(storage, "", publisher)
+	handler := NewJSONUpdateHandler(service.NewMetricsService(storage), nil, publisher)
 
 	// Отправляем несколько запросов
 	requests := []string{
@@ -6,6 +6,7 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/Mihklz/metrixcollector/internal/crypto"
 	"github.com/Mihklz/metrixcollector/internal/logger"
 	models "github.com/Mihklz/metrixcollector/internal/model"
 	"github.com/Mihklz/metrixcollector/internal/repository"
@@ -13,7 +14,7 @@ import (
 
 // NewJSONValueHandler создаёт обработчик для POST /value (JSON API)
 // Принимает запрос с ID и типом метрики, возвращает её значение в JSON
-func NewJSONValueHandler(storage repository.Storage, key string) http.HandlerFunc {
+func NewJSONValueHandler(storage repository.Storage, keyring *crypto.Keyring) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Общая валидация и декодирование
 		request, ok := validateJSONRequest(w, r)
@@ -27,6 +28,8 @@ func NewJSONValueHandler(storage repository.Storage, key string) http.HandlerFun
 			MType: request.MType,
 		}
 
+		storage := tenantStorage(r, storage)
+
 		// Ищем метрику в зависимости от типа
 		switch request.MType {
 		case models.Gauge:
@@ -68,6 +71,6 @@ func NewJSONValueHandler(storage repository.Storage, key string) http.HandlerFun
 			return
 		}
 
-		WriteResponseWithHash(w, responseData, key, http.StatusOK, "application/json")
+		WriteResponseWithHash(w, responseData, keyring, http.StatusOK, "application/json")
 	}
 }
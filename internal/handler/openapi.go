@@ -0,0 +1,12 @@
+package handler
+
+import "net/http"
+
+// NewOpenAPIHandler создаёт обработчик GET /openapi.json, отдающий спецификацию API.
+func NewOpenAPIHandler(spec []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(spec)
+	}
+}
@@ -15,7 +15,8 @@ func NewRootHandler(storage repository.Storage) http.HandlerFunc {
 		// Начинаем HTML-страницу
 		_, _ = w.Write([]byte("<html><head><title>Metrics</title></head><body><h1>All Metrics</h1><ul>"))
 
-		// Получаем метрики
+		// Получаем метрики арендатора
+		storage := tenantStorage(r, storage)
 		gauges := storage.GetAllGauges()
 		counters := storage.GetAllCounters()
 
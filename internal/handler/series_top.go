@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	"github.com/Mihklz/metrixcollector/internal/service"
+)
+
+// defaultSeriesTop — сколько клиентов и префиксов возвращается по умолчанию
+const defaultSeriesTop = 10
+
+// NewSeriesTopHandler создаёт обработчик GET /series/top: клиенты и префиксы
+// имён, создавшие больше всего рядов с запуска сервера. Параметр limit
+// задаёт длину списков. Без лимитов рядов статистика не ведётся и списки пусты.
+func NewSeriesTopHandler(limiter *service.CardinalityLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := defaultSeriesTop
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			n = parsed
+		}
+
+		data, err := json.Marshal(limiter.Top(n))
+		if err != nil {
+			logger.Log.Error("Failed to encode series top", zap.Error(err))
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(data)
+	}
+}
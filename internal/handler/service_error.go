@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/service"
+)
+
+// writeServiceError отвечает на ошибку сервиса метрик: ошибка валидации —
+// 400 с подробностями в JSON, превышение квоты или лимита рядов и отброшенный
+// выборкой ряд — 403, остальные ошибки — 500.
+func writeServiceError(w http.ResponseWriter, err error) {
+	var validationErr *service.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		data, _ := json.Marshal(validationErr)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(data)
+	case errors.Is(err, repository.ErrSeriesQuotaExceeded) || service.IsSeriesLimitError(err) ||
+		errors.Is(err, service.ErrSeriesSampled):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, "failed to save metric", http.StatusInternalServerError)
+	}
+}
+
+// requestService возвращает сервис метрик для арендатора и клиента запроса
+func requestService(r *http.Request, metricsService *service.MetricsService) *service.MetricsService {
+	return metricsService.ForTenant(tenantFromRequest(r)).ForClient(clientName(r))
+}
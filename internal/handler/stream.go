@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/apierror"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/stream"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
+)
+
+// Параметры потока обновлений
+const (
+	streamHeartbeat    = 15 * time.Second // период проверки соединения
+	streamWriteTimeout = 10 * time.Second // ожидание записи клиенту
+)
+
+// streamSender — транспорт потока (SSE или WebSocket)
+type streamSender interface {
+	send(msg stream.Message) error
+	heartbeat() error
+	// gone закрывается, когда клиент отключился
+	gone() <-chan struct{}
+	// close завершает поток, сообщая клиенту причину отключения
+	// (nil — клиент отключился сам, stream.ErrClosed — остановка сервера)
+	close(reason error)
+}
+
+// NewAPIStreamHandler создаёт обработчик GET /api/v1/stream. Обновления
+// метрик арендатора отдаются по мере записи: по WebSocket, если клиент
+// запросил переход (Upgrade: websocket), иначе как Server-Sent Events.
+// Параметры: type — тип метрики, name — имя метрики, prefix — префикс имени.
+// Клиент, не успевающий читать, получает событие dropped с числом
+// пропущенных обновлений, а отставший больше чем на буфер — отключается.
+func NewAPIStreamHandler(hub *stream.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := stream.Filter{
+			Tenant: tenant.FromContext(r.Context()),
+			Type:   query.Get("type"),
+			Name:   query.Get("name"),
+			Prefix: query.Get("prefix"),
+		}
+		if filter.Type != "" && filter.Type != models.Gauge && filter.Type != models.Counter {
+			apierror.Write(w, http.StatusBadRequest, apierror.New(codeInvalidQuery,
+				fmt.Sprintf("unknown metric type %q", filter.Type)).WithDetails(map[string]any{"parameter": "type"}))
+			return
+		}
+
+		sub, err := hub.Subscribe(filter)
+		if err != nil {
+			apierror.WriteStatus(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		defer sub.Close()
+
+		var sender streamSender
+		if stream.IsWebSocketRequest(r) {
+			conn, err := stream.Upgrade(w, r, streamWriteTimeout)
+			if err != nil {
+				logger.Log.Info("WebSocket upgrade failed", zap.Error(err))
+				return
+			}
+			sender = &wsSender{conn: conn}
+		} else {
+			sse, err := newSSESender(w, r)
+			if err != nil {
+				logger.Log.Error("Streaming is not supported by response writer", zap.Error(err))
+				apierror.WriteStatus(w, http.StatusInternalServerError, "streaming is not supported")
+				return
+			}
+			sender = sse
+		}
+
+		logger.Log.Info("Stream subscriber connected",
+			zap.String("tenant", filter.Tenant),
+			zap.Bool("websocket", stream.IsWebSocketRequest(r)),
+			zap.Int("subscribers", hub.Len()),
+		)
+		reason := serveStream(sub, sender)
+		sender.close(reason)
+		logger.Log.Info("Stream subscriber disconnected", zap.NamedError("reason", reason))
+	}
+}
+
+// serveStream передаёт обновления подписки клиенту до его отключения.
+// Возвращает причину завершения (nil — клиент отключился сам).
+func serveStream(sub *stream.Subscription, sender streamSender) error {
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case u := <-sub.Updates():
+			// Сначала сообщаем о пропусках, чтобы клиент знал, что данные неполные
+			if dropped := sub.Dropped(); dropped > 0 {
+				if err := sender.send(stream.Message{Event: stream.EventDropped, Time: u.Time, Dropped: dropped}); err != nil {
+					return err
+				}
+			}
+			if err := sender.send(stream.NewMetricMessage(u)); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := sender.heartbeat(); err != nil {
+				return err
+			}
+		case <-sender.gone():
+			return nil
+		case <-sub.Done():
+			return sub.Err()
+		}
+	}
+}
+
+// sseSender передаёт поток как Server-Sent Events
+type sseSender struct {
+	w    http.ResponseWriter
+	rc   *http.ResponseController
+	done <-chan struct{}
+}
+
+// newSSESender отправляет заголовки потока SSE
+func newSSESender(w http.ResponseWriter, r *http.Request) (*sseSender, error) {
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // отключает буферизацию в nginx
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil, err
+	}
+	return &sseSender{w: w, rc: rc, done: r.Context().Done()}, nil
+}
+
+func (s *sseSender) send(msg stream.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if msg.Seq != 0 {
+		return s.write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", msg.Seq, msg.Event, data))
+	}
+	return s.write(fmt.Sprintf("event: %s\ndata: %s\n\n", msg.Event, data))
+}
+
+func (s *sseSender) heartbeat() error {
+	// Строка-комментарий не видна клиенту, но не даёт прокси закрыть соединение
+	return s.write(": ping\n\n")
+}
+
+func (s *sseSender) gone() <-chan struct{} {
+	return s.done
+}
+
+func (s *sseSender) close(reason error) {
+	// Поток SSE завершается вместе с обработчиком; клиенту сообщаем только об отключении за отставание
+	if errors.Is(reason, stream.ErrSlowConsumer) {
+		_ = s.send(stream.Message{Event: stream.EventDisconnect, Time: time.Now(), Reason: reason.Error()})
+	}
+}
+
+// write отправляет данные клиенту, не дожидаясь медленного соединения дольше streamWriteTimeout
+func (s *sseSender) write(data string) error {
+	_ = s.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if _, err := s.w.Write([]byte(data)); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// wsSender передаёт поток по WebSocket: каждое сообщение — JSON в текстовом кадре
+type wsSender struct {
+	conn *stream.WebSocketConn
+}
+
+func (s *wsSender) send(msg stream.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.conn.WriteText(data)
+}
+
+func (s *wsSender) heartbeat() error {
+	return s.conn.Ping()
+}
+
+func (s *wsSender) gone() <-chan struct{} {
+	return s.conn.Closed()
+}
+
+func (s *wsSender) close(reason error) {
+	switch {
+	case reason == nil:
+		_ = s.conn.Close(stream.CloseNormal, "")
+	case errors.Is(reason, stream.ErrClosed):
+		_ = s.conn.Close(stream.CloseGoingAway, "server shutdown")
+	default:
+		_ = s.send(stream.Message{Event: stream.EventDisconnect, Time: time.Now(), Reason: reason.Error()})
+		_ = s.conn.Close(stream.CloseTryAgain, reason.Error())
+	}
+}
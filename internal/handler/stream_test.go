@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	"github.com/Mihklz/metrixcollector/internal/middleware"
+	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/stream"
+)
+
+// newStreamServer поднимает поток за middleware, оборачивающими ResponseWriter
+func newStreamServer(t *testing.T, hub *stream.Hub) *httptest.Server {
+	t.Helper()
+	h := logger.WithLogging(middleware.WithJSONErrors("/api/")(middleware.WithGzip(NewAPIStreamHandler(hub))))
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// waitSubscribers ждёт, пока обработчик подпишется на хаб
+func waitSubscribers(t *testing.T, hub *stream.Hub, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return hub.Len() == n }, time.Second, 5*time.Millisecond)
+}
+
+// readSSEMessage читает событие SSE и возвращает его имя и данные
+func readSSEMessage(t *testing.T, r *bufio.Reader) (string, stream.Message) {
+	t.Helper()
+	var event string
+	var msg stream.Message
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if event != "" {
+				return event, msg
+			}
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &msg))
+		}
+	}
+}
+
+func TestAPIStream_SSE(t *testing.T) {
+	hub := stream.NewHub(16, 0)
+	storage := repository.WithUpdateListener(repository.NewMemStorage(), hub)
+	srv := newStreamServer(t, hub)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/stream?type=counter&prefix=Poll", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	waitSubscribers(t, hub, 1)
+
+	require.NoError(t, storage.Update(models.Gauge, "PollGauge", "1"))
+	require.NoError(t, storage.Update(models.Counter, "PollCount", "2"))
+	require.NoError(t, storage.Update(models.Counter, "PollCount", "3"))
+
+	reader := bufio.NewReader(resp.Body)
+	event, msg := readSSEMessage(t, reader)
+	assert.Equal(t, stream.EventMetric, event)
+	require.NotNil(t, msg.Metric)
+	assert.Equal(t, "PollCount", msg.Metric.ID)
+	assert.Equal(t, int64(2), *msg.Metric.Delta)
+
+	_, msg = readSSEMessage(t, reader)
+	assert.Equal(t, int64(5), *msg.Metric.Delta)
+
+	// Остановка сервера завершает поток
+	hub.Close()
+	_, err = io.ReadAll(reader)
+	assert.NoError(t, err)
+}
+
+func TestAPIStream_WebSocket(t *testing.T) {
+	hub := stream.NewHub(16, 0)
+	storage := repository.WithUpdateListener(repository.NewMemStorage(), hub)
+	srv := newStreamServer(t, hub)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET /api/v1/stream?name=Alloc HTTP/1.1\r\nHost: test\r\n"+
+		"Accept-Encoding: gzip\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	waitSubscribers(t, hub, 1)
+
+	require.NoError(t, storage.Update(models.Gauge, "HeapAlloc", "1"))
+	require.NoError(t, storage.Update(models.Gauge, "Alloc", "2.5"))
+
+	// Кадр сервера: FIN + text, длина до 125 байт, без маски
+	var head [2]byte
+	_, err = io.ReadFull(reader, head[:])
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x81), head[0])
+	payload := make([]byte, head[1])
+	_, err = io.ReadFull(reader, payload)
+	require.NoError(t, err)
+
+	var msg stream.Message
+	require.NoError(t, json.Unmarshal(payload, &msg))
+	assert.Equal(t, stream.EventMetric, msg.Event)
+	assert.Equal(t, "Alloc", msg.Metric.ID)
+	assert.Equal(t, 2.5, *msg.Metric.Value)
+
+	// Остановка сервера закрывает соединение кадром close с кодом 1001
+	hub.Close()
+	_, err = io.ReadFull(reader, head[:])
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x88), head[0])
+	payload = make([]byte, head[1])
+	_, err = io.ReadFull(reader, payload)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x03, 0xE9}, payload[:2])
+}
+
+func TestAPIStream_Errors(t *testing.T) {
+	hub := stream.NewHub(1, 1)
+	srv := newStreamServer(t, hub)
+
+	resp, err := http.Get(srv.URL + "/api/v1/stream?type=histogram")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	sub, err := hub.Subscribe(stream.Filter{})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	resp, err = http.Get(srv.URL + "/api/v1/stream")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
+)
+
+// tenantStorage возвращает хранилище арендатора, определённого middleware.WithTenant
+func tenantStorage(r *http.Request, storage repository.Storage) repository.Storage {
+	return storage.ForTenant(tenantFromRequest(r))
+}
+
+// tenantFromRequest возвращает арендатора запроса
+func tenantFromRequest(r *http.Request) string {
+	return tenant.FromContext(r.Context())
+}
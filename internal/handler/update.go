@@ -8,11 +8,11 @@ import (
 
 	"github.com/Mihklz/metrixcollector/internal/audit"
 	"github.com/Mihklz/metrixcollector/internal/logger"
-	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/service"
 )
 
 // NewUpdateHandler возвращает обработчик URL-based API для обновления метрик.
-func NewUpdateHandler(storage repository.Storage, auditPublisher *audit.AuditPublisher) http.HandlerFunc {
+func NewUpdateHandler(metricsService *service.MetricsService, auditPublisher *audit.AuditPublisher) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -27,9 +27,12 @@ func NewUpdateHandler(storage repository.Storage, auditPublisher *audit.AuditPub
 
 		metricType, name, value := parts[0], parts[1], parts[2]
 
-		err := storage.Update(metricType, name, value)
+		metric, err := service.ParseMetric(metricType, name, value)
+		if err == nil {
+			err = requestService(r, metricsService).UpdateSingle(metric)
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeServiceError(w, err)
 			return
 		}
 
@@ -41,7 +44,7 @@ func NewUpdateHandler(storage repository.Storage, auditPublisher *audit.AuditPub
 
 		// Публикуем событие аудита после успешной обработки
 		if auditPublisher != nil && auditPublisher.HasObservers() {
-			event := audit.NewAuditEvent([]string{name}, audit.GetIPAddress(r))
+			event := newAuditEvent(r, []string{name})
 			auditPublisher.Publish(event)
 		}
 
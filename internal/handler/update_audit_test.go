@@ -8,6 +8,7 @@ import (
 
 	"github.com/Mihklz/metrixcollector/internal/audit"
 	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/service"
 )
 
 // mockAuditObserver для тестирования аудита
@@ -27,7 +28,7 @@ func TestUpdateHandlerWithAudit(t *testing.T) {
 	observer := &mockAuditObserver{events: make([]*audit.AuditEvent, 0)}
 	publisher.Subscribe(observer)
 
-	handler := NewUpdateHandler(storage, publisher)
+	handler := NewUpdateHandler(service.NewMetricsService(storage), publisher)
 
 	req := httptest.NewRequest(http.MethodPost, "/update/gauge/TestMetric/42.5", nil)
 	req.RemoteAddr = "192.168.1.100:12345"
@@ -66,7 +67,7 @@ func TestUpdateHandlerWithoutAudit(t *testing.T) {
 	storage := repository.NewMemStorage()
 
 	// Передаем nil вместо publisher
-	handler := NewUpdateHandler(storage, nil)
+	handler := NewUpdateHandler(service.NewMetricsService(storage), nil)
 
 	req := httptest.NewRequest(http.MethodPost, "/update/gauge/TestMetric/42.5", nil)
 	w := httptest.NewRecorder()
@@ -86,7 +87,7 @@ func TestUpdateHandlerAuditOnlyOnSuccess(t *testing.T) {
 	observer := &mockAuditObserver{events: make([]*audit.AuditEvent, 0)}
 	publisher.Subscribe(observer)
 
-	handler := NewUpdateHandler(storage, publisher)
+	handler := NewUpdateHandler(service.NewMetricsService(storage), publisher)
 
 	// Отправляем невалидный запрос (некорректный тип метрики)
 	req := httptest.NewRequest(http.MethodPost, "/update/invalid/TestMetric/value", nil)
@@ -113,7 +114,7 @@ func TestUpdateHandlerAuditWithXForwardedFor(t *testing.T) {
 	observer := &mockAuditObserver{events: make([]*audit.AuditEvent, 0)}
 	publisher.Subscribe(observer)
 
-	handler := NewUpdateHandler(storage, publisher)
+	handler := NewUpdateHandler(service.NewMetricsService(storage), publisher)
 
 	req := httptest.NewRequest(http.MethodPost, "/update/gauge/TestMetric/42.5", nil)
 	req.RemoteAddr = "10.0.0.1:12345"
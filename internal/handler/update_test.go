@@ -1,12 +1,14 @@
 package handler
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/Mihklz/metrixcollector/internal/logger"
 	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/service"
 )
 
 func TestUpdateHandler_ValidGauge(t *testing.T) {
@@ -14,7 +16,7 @@ func TestUpdateHandler_ValidGauge(t *testing.T) {
 	_ = logger.Initialize()
 
 	store := repository.NewMemStorage()
-	handler := NewUpdateHandler(store, nil)
+	handler := NewUpdateHandler(service.NewMetricsService(store), nil)
 
 	req := httptest.NewRequest(http.MethodPost, "/update/gauge/TestGauge/123.4", nil)
 	w := httptest.NewRecorder()
@@ -37,7 +39,7 @@ func TestUpdateHandler_UnsupportedMethod(t *testing.T) {
 	_ = logger.Initialize()
 
 	store := repository.NewMemStorage()
-	handler := NewUpdateHandler(store, nil)
+	handler := NewUpdateHandler(service.NewMetricsService(store), nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/update/gauge/TestGauge/123.4", nil)
 	w := httptest.NewRecorder()
@@ -57,7 +59,7 @@ func TestUpdateHandler_InvalidPath(t *testing.T) {
 	_ = logger.Initialize()
 
 	store := repository.NewMemStorage()
-	handler := NewUpdateHandler(store, nil)
+	handler := NewUpdateHandler(service.NewMetricsService(store), nil)
 
 	req := httptest.NewRequest(http.MethodPost, "/update/gaugeonly", nil)
 	w := httptest.NewRecorder()
@@ -71,3 +73,34 @@ func TestUpdateHandler_InvalidPath(t *testing.T) {
 		t.Error("expected 404 Not Found")
 	}
 }
+
+func TestUpdateHandler_InvalidName(t *testing.T) {
+	// Инициализируем логгер для тестов
+	_ = logger.Initialize()
+
+	store := repository.NewMemStorage()
+	handler := NewUpdateHandler(service.NewMetricsService(store), nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/update/gauge/bad%20name/1", nil)
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 Bad Request, got %d", resp.StatusCode)
+	}
+
+	var validationErr service.ValidationError
+	if err := json.NewDecoder(resp.Body).Decode(&validationErr); err != nil {
+		t.Fatalf("expected JSON error details: %v", err)
+	}
+	if validationErr.Code != service.CodeInvalidName || validationErr.Field != "id" {
+		t.Errorf("unexpected error details: %+v", validationErr)
+	}
+	if len(store.GetAllGauges()) != 0 {
+		t.Error("invalid metric must not be stored")
+	}
+}
@@ -14,6 +14,7 @@ func NewValueHandler(storage repository.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		metricType := chi.URLParam(r, "type")
 		metricName := chi.URLParam(r, "name")
+		storage := tenantStorage(r, storage)
 
 		switch metricType {
 		case models.Gauge:
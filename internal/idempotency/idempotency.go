@@ -0,0 +1,76 @@
+// Package idempotency хранит результаты запросов с заголовком Idempotency-Key,
+// чтобы повтор уже обработанного запроса не применял его второй раз.
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Header — заголовок с ключом идемпотентности запроса.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader отмечает ответ, взятый из хранилища, а не полученный заново.
+const ReplayedHeader = "Idempotent-Replayed"
+
+// MaxKeyLength — максимальная длина ключа идемпотентности.
+const MaxKeyLength = 255
+
+// storedHeaders — заголовки ответа, которые сохраняются вместе с телом
+var storedHeaders = []string{"Content-Type", "HashSHA256"}
+
+// Response — сохранённый результат запроса.
+type Response struct {
+	RequestHash string      // SHA-256 тела запроса в hex: ключ нельзя переиспользовать для другого тела
+	Status      int         // код ответа
+	Header      http.Header // заголовки ответа (Content-Type, HashSHA256)
+	Body        []byte      // тело ответа
+	CreatedAt   time.Time
+}
+
+// Store хранит результаты запросов в пределах окна дедупликации.
+// Ключи разных арендаторов не пересекаются.
+type Store interface {
+	// Get возвращает сохранённый результат или nil, если ключ не встречался
+	// или его окно истекло.
+	Get(ctx context.Context, tenant, key string) (*Response, error)
+	// Put сохраняет результат. Если ключ уже сохранён, оставляет прежний результат.
+	Put(ctx context.Context, tenant, key string, resp *Response) error
+}
+
+// ValidateKey проверяет ключ: от 1 до MaxKeyLength видимых символов ASCII.
+func ValidateKey(key string) error {
+	if key == "" || len(key) > MaxKeyLength {
+		return fmt.Errorf("idempotency key must be 1 to %d characters long", MaxKeyLength)
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < '!' || key[i] > '~' {
+			return fmt.Errorf("idempotency key contains invalid character at position %d", i)
+		}
+	}
+	return nil
+}
+
+// filterHeader оставляет только сохраняемые заголовки ответа
+func filterHeader(header http.Header) http.Header {
+	filtered := http.Header{}
+	for _, name := range storedHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			filtered[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+	return filtered
+}
+
+// NewResponse создаёт результат запроса для сохранения.
+func NewResponse(requestHash string, status int, header http.Header, body []byte) *Response {
+	return &Response{
+		RequestHash: requestHash,
+		Status:      status,
+		Header:      filterHeader(header),
+		Body:        append([]byte(nil), body...),
+		CreatedAt:   time.Now(),
+	}
+}
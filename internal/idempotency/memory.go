@@ -0,0 +1,91 @@
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore — хранилище результатов в памяти процесса.
+// Размер ограничен: при переполнении вытесняются давно не использованные ключи (LRU).
+type MemoryStore struct {
+	window  time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[memoryKey]*list.Element
+	lru     *list.List // в начале — недавно использованные
+}
+
+type memoryKey struct {
+	tenant string
+	key    string
+}
+
+type memoryEntry struct {
+	key  memoryKey
+	resp *Response
+}
+
+// NewMemoryStore создаёт хранилище с окном дедупликации window
+// и не более maxSize ключей (0 — без ограничения).
+func NewMemoryStore(window time.Duration, maxSize int) *MemoryStore {
+	return &MemoryStore{
+		window:  window,
+		maxSize: maxSize,
+		entries: make(map[memoryKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get возвращает сохранённый результат.
+func (s *MemoryStore) Get(_ context.Context, tenant, key string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[memoryKey{tenant: tenant, key: key}]
+	if !ok {
+		return nil, nil
+	}
+	entry := elem.Value.(*memoryEntry)
+	if time.Since(entry.resp.CreatedAt) > s.window {
+		s.remove(elem)
+		return nil, nil
+	}
+	s.lru.MoveToFront(elem)
+	return entry.resp, nil
+}
+
+// Put сохраняет результат.
+func (s *MemoryStore) Put(_ context.Context, tenant, key string, resp *Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := memoryKey{tenant: tenant, key: key}
+	if elem, ok := s.entries[k]; ok {
+		if time.Since(elem.Value.(*memoryEntry).resp.CreatedAt) <= s.window {
+			return nil
+		}
+		s.remove(elem)
+	}
+
+	s.entries[k] = s.lru.PushFront(&memoryEntry{key: k, resp: resp})
+	for s.maxSize > 0 && s.lru.Len() > s.maxSize {
+		s.remove(s.lru.Back())
+	}
+	return nil
+}
+
+// Len возвращает число сохранённых ключей.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// remove удаляет запись; вызывается под s.mu
+func (s *MemoryStore) remove(elem *list.Element) {
+	s.lru.Remove(elem)
+	delete(s.entries, elem.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,60 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(time.Minute, 2)
+
+	first := NewResponse("hash-a", http.StatusOK, http.Header{"Content-Type": {"application/json"}, "Date": {"now"}}, []byte(`{}`))
+	require.NoError(t, store.Put(ctx, "", "a", first))
+
+	resp, err := store.Get(ctx, "", "a")
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, "hash-a", resp.RequestHash)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Date"))
+
+	// Повторное сохранение не заменяет первый результат
+	require.NoError(t, store.Put(ctx, "", "a", NewResponse("hash-b", http.StatusOK, nil, nil)))
+	resp, _ = store.Get(ctx, "", "a")
+	assert.Equal(t, "hash-a", resp.RequestHash)
+
+	// Ключи арендаторов не пересекаются
+	resp, err = store.Get(ctx, "team-a", "a")
+	require.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// При переполнении вытесняется давно не использованный ключ
+	require.NoError(t, store.Put(ctx, "", "b", NewResponse("hash-b", http.StatusOK, nil, nil)))
+	_, _ = store.Get(ctx, "", "a")
+	require.NoError(t, store.Put(ctx, "", "c", NewResponse("hash-c", http.StatusOK, nil, nil)))
+	assert.Equal(t, 2, store.Len())
+	resp, _ = store.Get(ctx, "", "b")
+	assert.Nil(t, resp)
+	resp, _ = store.Get(ctx, "", "a")
+	assert.NotNil(t, resp)
+
+	// Результат с истёкшим окном не возвращается
+	expired := NewResponse("hash-d", http.StatusOK, nil, nil)
+	expired.CreatedAt = time.Now().Add(-2 * time.Minute)
+	require.NoError(t, store.Put(ctx, "", "d", expired))
+	resp, _ = store.Get(ctx, "", "d")
+	assert.Nil(t, resp)
+}
+
+func TestValidateKey(t *testing.T) {
+	assert.NoError(t, ValidateKey("0f3a9c-report.1"))
+	assert.Error(t, ValidateKey(""))
+	assert.Error(t, ValidateKey("with space"))
+	assert.Error(t, ValidateKey(string(make([]byte, MaxKeyLength+1))))
+}
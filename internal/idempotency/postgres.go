@@ -0,0 +1,97 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// purgeInterval — как часто PostgresStore удаляет ключи с истёкшим окном
+const purgeInterval = time.Minute
+
+// PostgresStore — хранилище результатов в таблице idempotency_keys (миграция 000004).
+// Общее для всех экземпляров сервера, поэтому повтор дедуплицируется,
+// даже если попал на другой экземпляр.
+type PostgresStore struct {
+	db     *sql.DB
+	window time.Duration
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewPostgresStore создаёт хранилище с окном дедупликации window.
+func NewPostgresStore(db *sql.DB, window time.Duration) *PostgresStore {
+	return &PostgresStore{db: db, window: window}
+}
+
+// Get возвращает сохранённый результат.
+func (s *PostgresStore) Get(ctx context.Context, tenant, key string) (*Response, error) {
+	var resp Response
+	var header []byte
+	err := s.db.QueryRowContext(ctx,
+		`SELECT request_hash, status, header, body, created_at
+		 FROM idempotency_keys
+		 WHERE tenant = $1 AND key = $2 AND created_at > $3`,
+		tenant, key, time.Now().Add(-s.window),
+	).Scan(&resp.RequestHash, &resp.Status, &header, &resp.Body, &resp.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get idempotency key: %w", err)
+	}
+	if err := json.Unmarshal(header, &resp.Header); err != nil {
+		return nil, fmt.Errorf("decode stored response header: %w", err)
+	}
+	return &resp, nil
+}
+
+// Put сохраняет результат. Ключ с истёкшим окном перезаписывается.
+func (s *PostgresStore) Put(ctx context.Context, tenant, key string, resp *Response) error {
+	s.purgeExpired(ctx)
+
+	header, err := json.Marshal(resp.Header)
+	if err != nil {
+		return fmt.Errorf("encode response header: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO idempotency_keys (tenant, key, request_hash, status, header, body, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (tenant, key) DO UPDATE SET
+		     request_hash = EXCLUDED.request_hash,
+		     status = EXCLUDED.status,
+		     header = EXCLUDED.header,
+		     body = EXCLUDED.body,
+		     created_at = EXCLUDED.created_at
+		 WHERE idempotency_keys.created_at <= $8`,
+		tenant, key, resp.RequestHash, resp.Status, header, resp.Body, resp.CreatedAt,
+		resp.CreatedAt.Add(-s.window),
+	)
+	if err != nil {
+		return fmt.Errorf("put idempotency key: %w", err)
+	}
+	return nil
+}
+
+// purgeExpired удаляет ключи с истёкшим окном не чаще раза в purgeInterval
+func (s *PostgresStore) purgeExpired(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.lastPurge) < purgeInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPurge = time.Now()
+	s.mu.Unlock()
+
+	// Ошибка очистки не мешает сохранить результат: запрос Get
+	// всё равно не вернёт ключи с истёкшим окном
+	_, _ = s.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE created_at <= $1`,
+		time.Now().Add(-s.window),
+	)
+}
@@ -61,6 +61,12 @@ func (lw *loggingResponseWriter) WriteHeader(statusCode int) {
 	lw.responseData.status = statusCode
 }
 
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController
+// (нужен потоковым ответам: Flush, Hijack)
+func (lw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
 // WithLogging - middleware для логирования HTTP запросов и ответов
 // Оборачивает любой http.Handler и добавляет логирование
 func WithLogging(h http.Handler) http.Handler {
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/Mihklz/metrixcollector/internal/apierror"
+)
+
+// errorEnvelopeWriter откладывает ответы с ошибкой в виде текста,
+// чтобы переписать их в формате apierror
+type errorEnvelopeWriter struct {
+	http.ResponseWriter
+	status    int
+	intercept bool
+	body      bytes.Buffer
+}
+
+func (ew *errorEnvelopeWriter) WriteHeader(statusCode int) {
+	if ew.status != 0 {
+		return
+	}
+	ew.status = statusCode
+	contentType := ew.Header().Get("Content-Type")
+	if statusCode >= http.StatusBadRequest && !strings.HasPrefix(contentType, apierror.ContentType) {
+		ew.intercept = true
+		return
+	}
+	ew.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (ew *errorEnvelopeWriter) Write(b []byte) (int, error) {
+	if ew.status == 0 {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.intercept {
+		return ew.body.Write(b)
+	}
+	return ew.ResponseWriter.Write(b)
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController.
+func (ew *errorEnvelopeWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// finish отправляет отложенную ошибку в формате apierror
+func (ew *errorEnvelopeWriter) finish() {
+	if !ew.intercept {
+		return
+	}
+	ew.Header().Del("X-Content-Type-Options")
+	apierror.WriteStatus(ew.ResponseWriter, ew.status, ew.body.String())
+}
+
+// WithJSONErrors создает middleware, который для путей с префиксом prefix
+// переписывает текстовые ответы с ошибкой (http.Error, пустые ответы 4xx/5xx)
+// в единый JSON-формат apierror. Ответы в JSON не меняются.
+// Должен стоять первым после логирования, чтобы охватить ошибки всех middleware.
+func WithJSONErrors(prefix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ew := &errorEnvelopeWriter{ResponseWriter: w}
+			next.ServeHTTP(ew, r)
+			ew.finish()
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithJSONErrors(t *testing.T) {
+	handler := WithJSONErrors("/api/")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("case") {
+		case "text":
+			w.Header().Set("Retry-After", "3")
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		case "bare":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "json":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":"custom","message":"m"}}`))
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	decode := func(rec *httptest.ResponseRecorder) (string, string) {
+		var body struct {
+			Error struct{ Code, Message string } `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return body.Error.Code, body.Error.Message
+	}
+
+	// Текстовая ошибка переписывается в JSON, заголовки сохраняются
+	rec := serve("/api/v1/metrics?case=text")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "3", rec.Header().Get("Retry-After"))
+	code, message := decode(rec)
+	assert.Equal(t, "rate_limited", code)
+	assert.Equal(t, "Too many requests", message)
+
+	rec = serve("/api/v1/metrics?case=bare")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	code, message = decode(rec)
+	assert.Equal(t, "internal_error", code)
+	assert.Equal(t, "internal server error", message)
+
+	// Ответы в JSON и успешные ответы не меняются
+	rec = serve("/api/v1/metrics?case=json")
+	code, _ = decode(rec)
+	assert.Equal(t, "custom", code)
+	assert.Equal(t, "ok", serve("/api/v1/metrics").Body.String())
+
+	// Прежние эндпоинты отвечают как раньше
+	rec = serve("/update?case=text")
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+}
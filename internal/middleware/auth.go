@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/auth"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+)
+
+// WithRole создает middleware, пропускающий только клиентов с токеном,
+// у которого есть указанная роль. Токен передаётся в заголовке
+// "Authorization: Bearer <token>". Без токена или с неизвестным токеном
+// запрос получает 401, без нужной роли — 403.
+// Если хранилище токенов не задано, проверка выключена.
+func WithRole(store auth.TokenStore, role auth.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if store == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrix"`)
+				http.Error(w, "Authorization token required", http.StatusUnauthorized)
+				return
+			}
+
+			identity, err := store.Lookup(r.Context(), token)
+			if err != nil {
+				if !errors.Is(err, auth.ErrUnknownToken) {
+					logger.Log.Error("Failed to look up token", zap.Error(err))
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				logger.Log.Warn("Unknown token rejected", zap.String("url", r.URL.Path))
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrix", error="invalid_token"`)
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			if !identity.HasRole(role) {
+				logger.Log.Warn("Token lacks required role",
+					zap.String("identity", identity.Name),
+					zap.String("role", string(role)),
+					zap.String("url", r.URL.Path),
+				)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+		})
+	}
+}
+
+// bearerToken извлекает токен из заголовка Authorization
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
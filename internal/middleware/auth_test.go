@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Mihklz/metrixcollector/internal/auth"
+)
+
+// staticTokens — хранилище токенов для тестов
+type staticTokens map[string]*auth.Identity
+
+func (s staticTokens) Lookup(_ context.Context, token string) (*auth.Identity, error) {
+	if identity, ok := s[token]; ok {
+		return identity, nil
+	}
+	return nil, auth.ErrUnknownToken
+}
+
+func TestWithRole(t *testing.T) {
+	store := staticTokens{
+		"agent":   {Name: "agent-prod", Roles: []auth.Role{auth.RoleIngest}},
+		"grafana": {Name: "grafana", Roles: []auth.Role{auth.RoleRead}},
+	}
+
+	var identity string
+	handler := WithRole(store, auth.RoleIngest)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := auth.IdentityFromContext(r.Context()); ok {
+			identity = id.Name
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(authorization string) int {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("Bearer agent"))
+	assert.Equal(t, "agent-prod", identity)
+
+	assert.Equal(t, http.StatusForbidden, send("Bearer grafana"))
+	assert.Equal(t, http.StatusUnauthorized, send("Bearer unknown"))
+	assert.Equal(t, http.StatusUnauthorized, send("Basic YWdlbnQ6"))
+	assert.Equal(t, http.StatusUnauthorized, send(""))
+
+	// Без хранилища токенов проверка выключена
+	rec := httptest.NewRecorder()
+	WithRole(nil, auth.RoleAdmin)(handler).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEqual(t, http.StatusForbidden, rec.Code)
+}
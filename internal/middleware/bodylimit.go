@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/logger"
+)
+
+// WithBodyLimit создает middleware, отклоняющий тела запросов больше maxBytes
+// (до расшифровки и распаковки) с кодом 413. Тело читается целиком здесь,
+// поэтому последующие обработчики получают его уже в памяти.
+// При maxBytes <= 0 ограничение выключено.
+func WithBodyLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxBytes <= 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > maxBytes {
+				rejectTooLarge(w, r, r.ContentLength, maxBytes)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					rejectTooLarge(w, r, -1, maxBytes)
+					return
+				}
+				logger.Log.Error("Failed to read request body", zap.Error(err))
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rejectTooLarge отвечает 413 на слишком большое тело запроса
+func rejectTooLarge(w http.ResponseWriter, r *http.Request, size, limit int64) {
+	logger.Log.Warn("Request body too large",
+		zap.Int64("size", size),
+		zap.Int64("limit", limit),
+		zap.String("url", r.URL.Path),
+	)
+	http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+}
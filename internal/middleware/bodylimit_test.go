@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoHandler возвращает тело запроса
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, _ = w.Write(body)
+})
+
+func TestWithBodyLimit(t *testing.T) {
+	handler := WithBodyLimit(16)(echoHandler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/update", strings.NewReader("small body")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "small body", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/update", strings.NewReader(strings.Repeat("x", 17))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	// Размер без Content-Length проверяется при чтении
+	req := httptest.NewRequest(http.MethodPost, "/update", io.NopCloser(strings.NewReader(strings.Repeat("x", 17))))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestWithGzipLimit(t *testing.T) {
+	handler := WithGzipLimit(1024)(echoHandler)
+
+	compress := func(data string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte(data))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		return &buf
+	}
+
+	send := func(body *bytes.Buffer) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", body)
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(compress(`[{"id":"Alloc","type":"gauge","value":1}]`))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `[{"id":"Alloc","type":"gauge","value":1}]`, rec.Body.String())
+
+	// Маленькое сжатое тело, которое распаковывается в мегабайт
+	bomb := compress(strings.Repeat("0", 1<<20))
+	assert.Less(t, bomb.Len(), 4096)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(bomb).Code)
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+)
+
+// WithDecryption создает middleware для расшифровки тел запросов, зашифрованных
+// открытым ключом сервера. Должен стоять перед WithGzip и WithHashValidation:
+// агент сначала сжимает данные, а потом шифрует их.
+// Незашифрованные запросы пропускаются без изменений.
+func WithDecryption(key *rsa.PrivateKey) func(http.Handler) http.Handler {
+	var fingerprint string
+	if key != nil {
+		fingerprint = crypto.KeyFingerprint(&key.PublicKey)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme := r.Header.Get(crypto.EncryptionHeader)
+			if scheme == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if scheme != crypto.EncryptionScheme {
+				http.Error(w, fmt.Sprintf("Unsupported encryption scheme %q", scheme), http.StatusBadRequest)
+				return
+			}
+
+			if key == nil {
+				logger.Log.Warn("Encrypted request received but no private key configured",
+					zap.String("url", r.URL.Path),
+				)
+				http.Error(w, "Server has no private key configured, send payload unencrypted", http.StatusBadRequest)
+				return
+			}
+
+			// Отпечаток позволяет сразу сказать, каким ключом зашифрованы данные
+			if received := r.Header.Get(crypto.KeyFingerprintHeader); received != "" && received != fingerprint {
+				logger.Log.Warn("Encryption key mismatch",
+					zap.String("received_fingerprint", received),
+					zap.String("server_fingerprint", fingerprint),
+				)
+				http.Error(w, fmt.Sprintf("Payload is encrypted for key %s, server key is %s", received, fingerprint), http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				logger.Log.Error("Failed to read request body", zap.Error(err))
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body.Close()
+
+			plaintext, err := crypto.Decrypt(key, body)
+			if err != nil {
+				logger.Log.Warn("Failed to decrypt request body", zap.Error(err), zap.String("url", r.URL.Path))
+				if errors.Is(err, crypto.ErrKeyMismatch) {
+					http.Error(w, fmt.Sprintf("Payload is not encrypted for server key %s", fingerprint), http.StatusBadRequest)
+					return
+				}
+				http.Error(w, "Failed to decrypt request body", http.StatusBadRequest)
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(plaintext))
+			r.ContentLength = int64(len(plaintext))
+			r.Header.Del(crypto.EncryptionHeader)
+			r.Header.Del(crypto.KeyFingerprintHeader)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
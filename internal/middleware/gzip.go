@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"bytes"
 	"compress/gzip"
 	"io"
 	"net/http"
@@ -76,11 +77,18 @@ type gzipResponseWriter struct {
 	http.ResponseWriter
 	compressWriter *compressWriter
 	acceptsGzip    bool
+	wroteHeader    bool
 }
 
 func (g *gzipResponseWriter) WriteHeader(statusCode int) {
-	// Проверяем Content-Type только при первом вызове WriteHeader
-	if g.compressWriter == nil && g.acceptsGzip {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+
+	// Сжимаются только успешные ответы: для ошибок заголовок Content-Encoding
+	// не выставляется, и сжатое тело клиент не смог бы прочитать
+	if g.acceptsGzip && statusCode < 300 {
 		contentType := g.Header().Get("Content-Type")
 		shouldCompress := strings.Contains(contentType, "application/json") ||
 			strings.Contains(contentType, "text/html")
@@ -99,7 +107,7 @@ func (g *gzipResponseWriter) WriteHeader(statusCode int) {
 
 func (g *gzipResponseWriter) Write(data []byte) (int, error) {
 	// Если WriteHeader не был вызван, вызываем его с кодом 200
-	if g.compressWriter == nil && g.acceptsGzip {
+	if !g.wroteHeader {
 		g.WriteHeader(http.StatusOK)
 	}
 
@@ -109,6 +117,11 @@ func (g *gzipResponseWriter) Write(data []byte) (int, error) {
 	return g.ResponseWriter.Write(data)
 }
 
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
 func (g *gzipResponseWriter) Close() error {
 	if g.compressWriter != nil {
 		return g.compressWriter.Close()
@@ -118,6 +131,20 @@ func (g *gzipResponseWriter) Close() error {
 
 // WithGzip добавляет поддержку gzip сжатия/декомпрессии
 func WithGzip(next http.Handler) http.Handler {
+	return WithGzipLimit(0)(next)
+}
+
+// WithGzipLimit добавляет поддержку gzip сжатия/декомпрессии и отклоняет
+// сжатые тела, которые после распаковки больше maxDecompressed, с кодом 413.
+// При maxDecompressed <= 0 размер распакованного тела не ограничен.
+func WithGzipLimit(maxDecompressed int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return gzipHandler(next, maxDecompressed)
+	}
+}
+
+// gzipHandler реализует WithGzipLimit
+func gzipHandler(next http.Handler, maxDecompressed int64) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// по умолчанию устанавливаем оригинальный http.ResponseWriter как тот,
 		// который будем передавать следующей функции
@@ -149,6 +176,20 @@ func WithGzip(next http.Handler) http.Handler {
 			// меняем тело запроса на новое
 			r.Body = cr
 			defer cr.Close()
+
+			// распаковываем тело заранее, чтобы не пропустить дальше gzip-бомбу
+			if maxDecompressed > 0 {
+				body, err := io.ReadAll(io.LimitReader(cr, maxDecompressed+1))
+				if err != nil {
+					http.Error(w, "invalid gzip body", http.StatusBadRequest)
+					return
+				}
+				if int64(len(body)) > maxDecompressed {
+					rejectTooLarge(w, r, -1, maxDecompressed)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
 		}
 
 		// передаём управление хендлеру
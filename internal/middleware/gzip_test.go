@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// headerCountingRecorder считает вызовы WriteHeader исходного ResponseWriter
+type headerCountingRecorder struct {
+	*httptest.ResponseRecorder
+	writeHeaderCalls int
+}
+
+func (r *headerCountingRecorder) WriteHeader(statusCode int) {
+	r.writeHeaderCalls++
+	r.ResponseRecorder.WriteHeader(statusCode)
+}
+
+// jsonHandler отвечает JSON с кодом status
+func jsonHandler(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	})
+}
+
+// gzipRequest выполняет запрос клиента, принимающего gzip
+func gzipRequest(handler http.Handler) *headerCountingRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/value", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := &headerCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+	WithGzip(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWithGzip_CompressesSuccess(t *testing.T) {
+	rec := gzipRequest(jsonHandler(http.StatusOK))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	zr, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":"ok"}`, string(body))
+}
+
+func TestWithGzip_LeavesErrorsUncompressed(t *testing.T) {
+	// Тело ошибки без Content-Encoding должно читаться как есть
+	for _, status := range []int{http.StatusNotFound, http.StatusInternalServerError} {
+		rec := gzipRequest(jsonHandler(status))
+
+		assert.Equal(t, status, rec.Code)
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+	}
+}
+
+func TestWithGzip_WritesHeaderOnce(t *testing.T) {
+	rec := gzipRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	assert.Equal(t, 1, rec.writeHeaderCalls)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	// Write без WriteHeader отвечает 200 и тоже пишет заголовок один раз
+	rec = gzipRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	assert.Equal(t, 1, rec.writeHeaderCalls)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+}
@@ -2,25 +2,97 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/hex"
 	"io"
 	"net/http"
+	"strings"
 
 	"go.uber.org/zap"
 
+	"github.com/Mihklz/metrixcollector/internal/audit"
 	"github.com/Mihklz/metrixcollector/internal/crypto"
 	"github.com/Mihklz/metrixcollector/internal/logger"
 )
 
+// HashValidationOptions — настройки проверки хеша запросов.
+type HashValidationOptions struct {
+	Keyring *crypto.Keyring // ключи HMAC (nil — проверка выключена)
+
+	// Strict требует подпись у каждого запроса: без заголовка HashSHA256
+	// или с некорректным заголовком запрос отклоняется.
+	// Без Strict проверяется только присланный хеш.
+	Strict bool
+
+	// Exempt — пути, для которых подпись не требуется в режиме Strict.
+	// Путь, оканчивающийся на '*', задаёт префикс (например, "/debug/*").
+	Exempt []string
+
+	// Audit получает события об отклонённых запросах (nil — без аудита).
+	Audit *audit.AuditPublisher
+}
+
+// exempt проверяет, освобождён ли путь от обязательной подписи
+func (o HashValidationOptions) exempt(path string) bool {
+	for _, pattern := range o.Exempt {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == pattern {
+			return true
+		}
+	}
+	return false
+}
+
 // WithHashValidation создает middleware для проверки хеша данных
-func WithHashValidation(key string) func(http.Handler) http.Handler {
+// любым действующим ключом из связки
+func WithHashValidation(opts HashValidationOptions) func(http.Handler) http.Handler {
+	keyring := opts.Keyring
+
+	// reject отклоняет запрос и сообщает об этом в аудит
+	reject := func(w http.ResponseWriter, r *http.Request, status int, reason string) {
+		if opts.Audit != nil {
+			opts.Audit.Publish(audit.NewRejectionEvent(r, reason))
+		}
+		http.Error(w, reason, status)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Если ключ не задан, пропускаем проверку
-			if key == "" {
+			// Если ключи не заданы, пропускаем проверку
+			if !keyring.Enabled() {
 				next.ServeHTTP(w, r)
 				return
 			}
 
+			// Получаем хеш из заголовка
+			receivedHash := r.Header.Get("HashSHA256")
+			strict := opts.Strict && !opts.exempt(r.URL.Path)
+
+			if receivedHash == "" {
+				// Без строгого режима неподписанные запросы пропускаются
+				if strict {
+					logger.Log.Warn("Unsigned request rejected",
+						zap.String("method", r.Method),
+						zap.String("url", r.URL.Path),
+					)
+					reject(w, r, http.StatusUnauthorized, "Hash signature required")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !isValidHash(receivedHash) {
+				logger.Log.Warn("Malformed hash rejected",
+					zap.String("received_hash", receivedHash),
+					zap.String("url", r.URL.Path),
+				)
+				reject(w, r, http.StatusBadRequest, "Malformed hash signature")
+				return
+			}
+
 			// Читаем тело запроса
 			body, err := io.ReadAll(r.Body)
 			if err != nil {
@@ -33,23 +105,30 @@ func WithHashValidation(key string) func(http.Handler) http.Handler {
 			// Восстанавливаем тело запроса для последующих обработчиков
 			r.Body = io.NopCloser(bytes.NewBuffer(body))
 
-			// Получаем хеш из заголовка
-			receivedHash := r.Header.Get("HashSHA256")
-
-			// Проверяем хеш только если он присутствует в запросе
-			if receivedHash != "" {
-				if !crypto.ValidateHMAC(body, key, receivedHash) {
-					logger.Log.Warn("Hash validation failed",
-						zap.String("received_hash", receivedHash),
-						zap.String("method", r.Method),
-						zap.String("url", r.URL.Path),
-					)
-					http.Error(w, "Hash validation failed", http.StatusBadRequest)
-					return
-				}
+			keyID := r.Header.Get(crypto.KeyIDHeader)
+			payload := crypto.SignedPayload(r.Header.Get(crypto.TimestampHeader), r.Header.Get(crypto.NonceHeader), body)
+			if err := keyring.Verify(payload, keyID, receivedHash); err != nil {
+				logger.Log.Warn("Hash validation failed",
+					zap.Error(err),
+					zap.String("key_id", keyID),
+					zap.String("received_hash", receivedHash),
+					zap.String("method", r.Method),
+					zap.String("url", r.URL.Path),
+				)
+				reject(w, r, http.StatusBadRequest, "Hash validation failed")
+				return
 			}
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// isValidHash проверяет формат заголовка HashSHA256: 64 шестнадцатеричных символа
+func isValidHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mihklz/metrixcollector/internal/audit"
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+)
+
+// chanObserver передаёт события аудита в канал
+type chanObserver chan *audit.AuditEvent
+
+func (c chanObserver) Notify(event *audit.AuditEvent) error {
+	c <- event
+	return nil
+}
+
+func TestWithHashValidation_Strict(t *testing.T) {
+	const key = "secret"
+	events := make(chanObserver, 10)
+	publisher := audit.NewAuditPublisher()
+	publisher.Subscribe(events)
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := WithHashValidation(HashValidationOptions{
+		Keyring: crypto.NewStaticKeyring(key),
+		Strict:  true,
+		Exempt:  []string{"/ping", "/value/*"},
+		Audit:   publisher,
+	})(okHandler)
+
+	body := `{"id":"Alloc","type":"gauge","value":1}`
+	send := func(path, hash string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if hash != "" {
+			req.Header.Set("HashSHA256", hash)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("/update", crypto.CalculateHMAC([]byte(body), key)))
+	assert.Equal(t, http.StatusOK, send("/ping", ""))
+	assert.Equal(t, http.StatusOK, send("/value/gauge/Alloc", ""))
+
+	assert.Equal(t, http.StatusUnauthorized, send("/update", ""))
+	assert.Equal(t, http.StatusBadRequest, send("/update", "not-a-hash"))
+	assert.Equal(t, http.StatusBadRequest, send("/update", crypto.CalculateHMAC([]byte(body), "wrong")))
+
+	// Каждый отказ попадает в аудит
+	reasons := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		select {
+		case event := <-events:
+			assert.Equal(t, audit.EventRequestRejected, event.Event)
+			assert.Equal(t, "/update", event.Path)
+			reasons[event.Reason] = true
+		case <-time.After(time.Second):
+			require.FailNow(t, "audit event not published")
+		}
+	}
+	assert.Len(t, reasons, 3)
+}
+
+func TestWithHashValidation_NotStrict(t *testing.T) {
+	handler := WithHashValidation(HashValidationOptions{
+		Keyring: crypto.NewStaticKeyring("secret"),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Без строгого режима неподписанный запрос принимается, а неверная подпись — нет
+	req := httptest.NewRequest(http.MethodPost, "/update", strings.NewReader("{}"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/update", strings.NewReader("{}"))
+	req.Header.Set("HashSHA256", crypto.CalculateHMAC([]byte("{}"), "wrong"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
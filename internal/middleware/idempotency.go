@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/idempotency"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
+)
+
+// recordingWriter передаёт ответ клиенту и одновременно запоминает его
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(statusCode int) {
+	if rw.status == 0 {
+		rw.status = statusCode
+	}
+	rw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController.
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// WithIdempotency создает middleware для запросов с заголовком Idempotency-Key.
+// Ответ на первый запрос с ключом сохраняется в store (кроме ответов 5xx,
+// после которых запрос можно повторить), а повтор с тем же ключом и телом
+// получает сохранённый ответ без повторной обработки. Ключ с другим телом
+// отклоняется с кодом 422. Повтор, пришедший, пока первый запрос ещё
+// обрабатывается, дожидается его завершения и получает его ответ.
+// Запросы без заголовка и store == nil пропускаются без изменений.
+// Должен стоять после WithTenant: ключи разных арендаторов не пересекаются.
+func WithIdempotency(store idempotency.Store) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	inFlight := make(map[string]chan struct{}) // закрывается по завершении запроса
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotency.Header)
+			if store == nil || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := idempotency.ValidateKey(key); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+			requestHash := hex.EncodeToString(sum[:])
+
+			tenantName := tenant.FromContext(r.Context())
+			flightKey := tenantName + "\x00" + key
+
+			for {
+				mu.Lock()
+				done, busy := inFlight[flightKey]
+				if !busy {
+					inFlight[flightKey] = make(chan struct{})
+					mu.Unlock()
+					break
+				}
+				mu.Unlock()
+
+				select {
+				case <-done:
+				case <-r.Context().Done():
+					return
+				}
+			}
+			defer func() {
+				mu.Lock()
+				close(inFlight[flightKey])
+				delete(inFlight, flightKey)
+				mu.Unlock()
+			}()
+
+			stored, err := store.Get(r.Context(), tenantName, key)
+			if err != nil {
+				logger.Log.Error("Failed to look up idempotency key", zap.Error(err))
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if stored != nil {
+				if stored.RequestHash != requestHash {
+					http.Error(w, "Idempotency key was already used with a different request body", http.StatusUnprocessableEntity)
+					return
+				}
+				logger.Log.Info("Replaying stored response for idempotency key",
+					zap.String("key", key),
+					zap.String("tenant", tenantName),
+				)
+				for name, values := range stored.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set(idempotency.ReplayedHeader, "true")
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Body)
+				return
+			}
+
+			rw := &recordingWriter{ResponseWriter: w}
+			next.ServeHTTP(rw, r)
+
+			if rw.status == 0 || rw.status >= http.StatusInternalServerError {
+				return
+			}
+			// Клиент мог не дождаться ответа — именно тогда он повторит запрос,
+			// поэтому сохраняем результат и после отмены контекста запроса
+			resp := idempotency.NewResponse(requestHash, rw.status, rw.Header(), rw.body.Bytes())
+			if err := store.Put(context.WithoutCancel(r.Context()), tenantName, key, resp); err != nil {
+				logger.Log.Error("Failed to store idempotent response", zap.Error(err))
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mihklz/metrixcollector/internal/idempotency"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
+)
+
+func TestWithIdempotency(t *testing.T) {
+	calls := 0
+	handler := WithIdempotency(idempotency.NewMemoryStore(time.Minute, 100))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(body)
+		}),
+	)
+
+	send := func(key, tenantName, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(idempotency.Header, key)
+		}
+		req = req.WithContext(tenant.WithTenant(req.Context(), tenantName))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("k1", "", `[1]`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(idempotency.ReplayedHeader))
+
+	// Повтор получает сохранённый ответ без повторной обработки
+	rec = send("k1", "", `[1]`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `[1]`, rec.Body.String())
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "true", rec.Header().Get(idempotency.ReplayedHeader))
+	assert.Equal(t, 1, calls)
+
+	// Тот же ключ с другим телом
+	rec = send("k1", "", `[2]`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, 1, calls)
+
+	// У другого арендатора свой ключ, запросы без ключа не дедуплицируются
+	send("k1", "team-a", `[1]`)
+	send("", "", `[1]`)
+	send("", "", `[1]`)
+	assert.Equal(t, 4, calls)
+
+	rec = send("bad key", "", `[1]`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestWithIdempotency_DoesNotStoreServerErrors(t *testing.T) {
+	calls := 0
+	handler := WithIdempotency(idempotency.NewMemoryStore(time.Minute, 100))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				http.Error(w, "storage unavailable", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	for _, want := range []int{http.StatusInternalServerError, http.StatusOK, http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(`[]`))
+		req.Header.Set(idempotency.Header, "k1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, want, rec.Code)
+	}
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+)
+
+// rateLimiterMaxClients — наибольшее число корзин в памяти. При достижении
+// предела удаляются корзины с полным запасом токенов, а если их не хватило —
+// давно не обновлявшиеся корзины, пока не освободится десятая часть мест.
+const rateLimiterMaxClients = 10000
+
+// RateLimiter ограничивает частоту запросов каждого клиента алгоритмом
+// token bucket: корзина вмещает burst токенов и пополняется со скоростью
+// rate токенов в секунду, каждый запрос забирает один токен.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter создаёт ограничитель на rate запросов в секунду с запасом burst.
+// Если burst не задан, запас равен одной секунде запросов.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow забирает токен из корзины клиента. Если токенов нет, возвращает false
+// и время, через которое появится следующий токен.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	bucket, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= rateLimiterMaxClients {
+			l.sweep(now)
+		}
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[client] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// Ready сообщает, есть ли в корзине клиента токен, не забирая его.
+// Если токенов нет, возвращает время до появления следующего.
+func (l *RateLimiter) Ready(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		return true, 0
+	}
+	tokens := math.Min(l.burst, bucket.tokens+l.now().Sub(bucket.updated).Seconds()*l.rate)
+	if tokens < 1 {
+		return false, time.Duration((1 - tokens) / l.rate * float64(time.Second))
+	}
+	return true, 0
+}
+
+// sweep удаляет корзины, успевшие наполниться: они не отличаются от новых.
+// Если после этого места всё ещё мало, удаляются самые старые корзины.
+func (l *RateLimiter) sweep(now time.Time) {
+	for client, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+
+	keep := rateLimiterMaxClients * 9 / 10
+	if len(l.buckets) <= keep {
+		return
+	}
+	clients := make([]string, 0, len(l.buckets))
+	for client := range l.buckets {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return l.buckets[clients[i]].updated.Before(l.buckets[clients[j]].updated)
+	})
+	for _, client := range clients[:len(clients)-keep] {
+		delete(l.buckets, client)
+	}
+}
+
+type rateLimitKey struct{}
+
+// rateLimitState — запрос с подписью агента, который ограничивается
+// после проверки подписи (см. WithAgentRateLimit)
+type rateLimitState struct {
+	ip      string
+	charged bool // токен уже списан в WithAgentRateLimit
+}
+
+// WithRateLimit создает middleware, ограничивающий частоту запросов клиента.
+// Стоит первым, до чтения тела запроса, поэтому заголовкам запроса здесь
+// доверять нельзя: запросы без подписи агента ограничиваются сразу по IP-адресу
+// соединения. Запросы с подписью агента ограничиваются по идентификатору
+// агента в WithAgentRateLimit, после проверки подписи; если запрос до него
+// не дошёл (например, подпись неверна), токен списывается с корзины IP,
+// а при пустой корзине IP такие запросы отклоняются сразу.
+// Запросы сверх лимита получают 429 с заголовком Retry-After.
+// Если ограничитель не задан, проверка выключена.
+func WithRateLimit(limiter *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ip := rateLimitClient(r)
+			if r.Header.Get(crypto.SignatureHeader) == "" {
+				if allowed, wait := limiter.Allow(ip); !allowed {
+					rejectRateLimited(w, r, ip, wait)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if ready, wait := limiter.Ready(ip); !ready {
+				rejectRateLimited(w, r, ip, wait)
+				return
+			}
+			state := &rateLimitState{ip: ip}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rateLimitKey{}, state)))
+			if !state.charged {
+				limiter.Allow(ip)
+			}
+		})
+	}
+}
+
+// WithAgentRateLimit ограничивает запросы с подписью агента по идентификатору
+// агента, чья подпись проверена, а без проверенной подписи — по IP-адресу.
+// Агенты за одним NAT получают отдельные корзины, а агент, сменивший адрес,
+// остаётся в своей. Должен стоять после WithSignatureValidation и работать
+// с тем же ограничителем, что и WithRateLimit.
+func WithAgentRateLimit(limiter *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state, ok := r.Context().Value(rateLimitKey{}).(*rateLimitState)
+			if limiter == nil || !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			state.charged = true
+
+			client := state.ip
+			if agentID, ok := AgentIDFromContext(r.Context()); ok {
+				client = "agent:" + agentID
+			}
+			if allowed, wait := limiter.Allow(client); !allowed {
+				rejectRateLimited(w, r, client, wait)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rejectRateLimited отвечает 429 с временем до появления токена
+func rejectRateLimited(w http.ResponseWriter, r *http.Request, client string, wait time.Duration) {
+	logger.Log.Warn("Rate limit exceeded",
+		zap.String("client", client),
+		zap.String("url", r.URL.Path),
+	)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
+
+// rateLimitClient возвращает ключ клиента для ограничения частоты.
+// Адреса IPv6 объединяются по сети /64: клиенту обычно выдаётся вся сеть,
+// и смена адреса внутри неё не должна давать новую корзину.
+func rateLimitClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.To4() != nil {
+		return host
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow("agent-1")
+		assert.True(t, allowed)
+	}
+	allowed, wait := limiter.Allow("agent-1")
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// У другого клиента своя корзина
+	allowed, _ = limiter.Allow("agent-2")
+	assert.True(t, allowed)
+
+	// Корзина пополняется со скоростью rate
+	now = now.Add(500 * time.Millisecond)
+	allowed, _ = limiter.Allow("agent-1")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("agent-1")
+	assert.False(t, allowed)
+}
+
+func TestWithRateLimit(t *testing.T) {
+	handler := WithRateLimit(NewRateLimiter(1, 1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(agentID, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.RemoteAddr = remoteAddr
+		if agentID != "" {
+			req.Header.Set(crypto.AgentIDHeader, agentID)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, send("", "10.0.0.1:1000").Code)
+	rec := send("", "10.0.0.1:2000")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	// Непроверенный X-Agent-ID не даёт новой корзины
+	assert.Equal(t, http.StatusTooManyRequests, send("agent-1", "10.0.0.1:3000").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("agent-2", "10.0.0.1:3000").Code)
+	assert.Equal(t, http.StatusOK, send("agent-1", "10.0.0.2:3000").Code)
+
+	// Адреса одной сети IPv6 /64 делят корзину
+	assert.Equal(t, http.StatusOK, send("", "[2001:db8::1]:1000").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("", "[2001:db8::2]:1000").Code)
+	assert.Equal(t, http.StatusOK, send("", "[2001:db8:0:1::1]:1000").Code)
+}
+
+func TestWithAgentRateLimit(t *testing.T) {
+	pub1, priv1, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pub2, priv2, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	registry := crypto.NewAgentRegistry(map[string]ed25519.PublicKey{"agent-1": pub1, "agent-2": pub2})
+
+	limiter := NewRateLimiter(0.001, 1)
+	handler := WithRateLimit(limiter)(WithSignatureValidation(registry, false)(WithAgentRateLimit(limiter)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))))
+
+	send := func(agentID string, key ed25519.PrivateKey, remoteAddr string) int {
+		body := `[]`
+		req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(crypto.AgentIDHeader, agentID)
+		req.Header.Set(crypto.SignatureHeader, crypto.SignEd25519(crypto.SignedPayload("", "", []byte(body)), key))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Агенты за одним адресом получают свои корзины, а корзина агента
+	// не зависит от адреса
+	assert.Equal(t, http.StatusOK, send("agent-1", priv1, "10.0.0.1:1000"))
+	assert.Equal(t, http.StatusOK, send("agent-2", priv2, "10.0.0.1:1000"))
+	assert.Equal(t, http.StatusTooManyRequests, send("agent-1", priv1, "10.0.0.2:1000"))
+
+	// Неверная подпись списывается с корзины IP, и перебор подписей упирается в лимит
+	assert.Equal(t, http.StatusBadRequest, send("agent-1", priv2, "10.0.0.3:1000"))
+	assert.Equal(t, http.StatusTooManyRequests, send("agent-1", priv2, "10.0.0.3:1000"))
+	assert.Equal(t, http.StatusTooManyRequests, send("agent-2", priv2, "10.0.0.3:1000"))
+}
+
+func TestRateLimiterBoundsClients(t *testing.T) {
+	now := time.Now()
+	limiter := NewRateLimiter(0.001, 1)
+	limiter.now = func() time.Time { return now }
+
+	// Корзины пусты и не наполняются, но число клиентов всё равно ограничено
+	for i := 0; i < 3*rateLimiterMaxClients; i++ {
+		now = now.Add(time.Millisecond)
+		allowed, _ := limiter.Allow(fmt.Sprintf("client-%d", i))
+		assert.True(t, allowed)
+	}
+	assert.LessOrEqual(t, len(limiter.buckets), rateLimiterMaxClients)
+
+	// Недавние клиенты сохраняют свои корзины
+	allowed, _ := limiter.Allow(fmt.Sprintf("client-%d", 3*rateLimiterMaxClients-1))
+	assert.False(t, allowed)
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+)
+
+// Ошибки NonceCache.Add
+var (
+	// ErrNonceReused — nonce уже встречался.
+	ErrNonceReused = errors.New("nonce has already been used")
+	// ErrNonceCacheFull — в кэше нет места, а записи ещё не устарели.
+	ErrNonceCacheFull = errors.New("nonce cache is full")
+)
+
+// NonceCache запоминает nonce принятых запросов на время окна приёма.
+// Размер ограничен, но неустаревшие записи не вытесняются: иначе, заполнив
+// кэш, можно было бы повторить перехваченный запрос. Пока кэш полон,
+// новые nonce не принимаются.
+type NonceCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	order []nonceEntry // в порядке добавления
+}
+
+type nonceEntry struct {
+	nonce string
+	added time.Time
+}
+
+// NewNonceCache создаёт кэш nonce со временем жизни ttl и не более maxSize записей.
+func NewNonceCache(ttl time.Duration, maxSize int) *NonceCache {
+	return &NonceCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		seen:    make(map[string]struct{}),
+	}
+}
+
+// Add запоминает nonce. Возвращает ErrNonceReused, если nonce уже встречался,
+// и ErrNonceCacheFull, если места для него нет.
+func (c *NonceCache) Add(nonce string, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evict(now)
+	if _, ok := c.seen[nonce]; ok {
+		return ErrNonceReused
+	}
+	if c.maxSize > 0 && len(c.order) >= c.maxSize {
+		return ErrNonceCacheFull
+	}
+
+	c.seen[nonce] = struct{}{}
+	c.order = append(c.order, nonceEntry{nonce: nonce, added: now})
+	return nil
+}
+
+// retryAfter возвращает время до устаревания самой старой записи
+func (c *NonceCache) retryAfter(now time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.order) == 0 {
+		return 0
+	}
+	return c.order[0].added.Add(c.ttl).Sub(now)
+}
+
+// Len возвращает число записей в кэше.
+func (c *NonceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.seen)
+}
+
+// evict удаляет устаревшие записи
+func (c *NonceCache) evict(now time.Time) {
+	drop := 0
+	for drop < len(c.order) && now.Sub(c.order[drop].added) > c.ttl {
+		delete(c.seen, c.order[drop].nonce)
+		drop++
+	}
+	if drop > 0 {
+		c.order = append(c.order[:0], c.order[drop:]...)
+	}
+}
+
+// WithReplayProtection создает middleware, отклоняющий повтор подписанных запросов.
+// Подписанный запрос должен содержать время и nonce (они входят в подпись):
+// без них или со временем вне окна window запрос отклоняется с кодом 400,
+// повтор уже принятого nonce — с кодом 409, а при переполненном кэше nonce
+// запрос отклоняется с кодом 503 и заголовком Retry-After.
+// Должен стоять после WithHashValidation и WithSignatureValidation.
+func WithReplayProtection(window time.Duration, cache *NonceCache) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Защита выключена или запрос не подписан
+			if window <= 0 || !isSignedRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			timestamp := r.Header.Get(crypto.TimestampHeader)
+			nonce := r.Header.Get(crypto.NonceHeader)
+			if timestamp == "" || nonce == "" {
+				http.Error(w, "Signed request must include timestamp and nonce", http.StatusBadRequest)
+				return
+			}
+
+			unix, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid request timestamp", http.StatusBadRequest)
+				return
+			}
+
+			now := time.Now()
+			skew := now.Sub(time.Unix(unix, 0))
+			if skew > window || skew < -window {
+				logger.Log.Warn("Request timestamp outside of replay window",
+					zap.Duration("skew", skew),
+					zap.String("url", r.URL.Path),
+				)
+				http.Error(w, "Request timestamp outside of acceptance window", http.StatusBadRequest)
+				return
+			}
+
+			switch err := cache.Add(nonce, now); {
+			case errors.Is(err, ErrNonceReused):
+				logger.Log.Warn("Replayed request rejected",
+					zap.String("nonce", nonce),
+					zap.String("url", r.URL.Path),
+				)
+				http.Error(w, "Request has already been processed", http.StatusConflict)
+				return
+			case errors.Is(err, ErrNonceCacheFull):
+				logger.Log.Warn("Nonce cache is full, request rejected",
+					zap.String("url", r.URL.Path),
+				)
+				retryAfter := math.Max(1, math.Ceil(cache.retryAfter(now).Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+				http.Error(w, "Too many signed requests, try again later", http.StatusServiceUnavailable)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isSignedRequest сообщает, что запрос подписан ключом HMAC или ключом агента
+func isSignedRequest(r *http.Request) bool {
+	return r.Header.Get("HashSHA256") != "" || r.Header.Get(crypto.SignatureHeader) != ""
+}
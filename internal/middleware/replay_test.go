@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+)
+
+func init() {
+	logger.Log = zap.NewNop()
+}
+
+func TestNonceCache(t *testing.T) {
+	now := time.Now()
+	cache := NewNonceCache(time.Minute, 2)
+
+	assert.NoError(t, cache.Add("a", now))
+	assert.ErrorIs(t, cache.Add("a", now), ErrNonceReused)
+	assert.NoError(t, cache.Add("b", now))
+
+	// Переполненный кэш не вытесняет неустаревшие записи
+	assert.ErrorIs(t, cache.Add("c", now), ErrNonceCacheFull)
+	assert.Equal(t, 2, cache.Len())
+	assert.ErrorIs(t, cache.Add("a", now), ErrNonceReused)
+	assert.Equal(t, time.Minute, cache.retryAfter(now))
+
+	// Устаревшие записи удаляются
+	assert.NoError(t, cache.Add("d", now.Add(2*time.Minute)))
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestWithReplayProtection_FullCache(t *testing.T) {
+	const key = "secret"
+	keyring := crypto.NewStaticKeyring(key)
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := WithHashValidation(HashValidationOptions{Keyring: keyring})(
+		WithReplayProtection(time.Minute, NewNonceCache(2*time.Minute, 3))(okHandler),
+	)
+
+	body := `{"id":"PollCount","type":"counter","delta":1}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	send := func(nonce string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/update", strings.NewReader(body))
+		req.Header.Set(crypto.TimestampHeader, now)
+		req.Header.Set(crypto.NonceHeader, nonce)
+		req.Header.Set("HashSHA256", crypto.CalculateHMAC(crypto.SignedPayload(now, nonce, []byte(body)), key))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Перехваченный запрос, затем поток новых nonce, заполняющий кэш
+	assert.Equal(t, http.StatusOK, send("captured").Code)
+	assert.Equal(t, http.StatusOK, send("flood-1").Code)
+	assert.Equal(t, http.StatusOK, send("flood-2").Code)
+	rec := send("flood-3")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	// Повтор перехваченного запроса по-прежнему отклоняется
+	assert.Equal(t, http.StatusConflict, send("captured").Code)
+}
+
+func TestWithReplayProtection(t *testing.T) {
+	const key = "secret"
+	keyring := crypto.NewStaticKeyring(key)
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := WithHashValidation(HashValidationOptions{Keyring: keyring})(
+		WithReplayProtection(time.Minute, NewNonceCache(2*time.Minute, 100))(okHandler),
+	)
+
+	body := `{"id":"PollCount","type":"counter","delta":1}`
+	send := func(timestamp, nonce string) int {
+		req := httptest.NewRequest(http.MethodPost, "/update", strings.NewReader(body))
+		if timestamp != "" {
+			req.Header.Set(crypto.TimestampHeader, timestamp)
+		}
+		if nonce != "" {
+			req.Header.Set(crypto.NonceHeader, nonce)
+		}
+		req.Header.Set("HashSHA256", crypto.CalculateHMAC(crypto.SignedPayload(timestamp, nonce, []byte(body)), key))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	assert.Equal(t, http.StatusOK, send(now, "n1"))
+	assert.Equal(t, http.StatusConflict, send(now, "n1"))
+	assert.Equal(t, http.StatusOK, send(now, "n2"))
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	assert.Equal(t, http.StatusBadRequest, send(old, "n3"))
+	assert.Equal(t, http.StatusBadRequest, send("", ""))
+	assert.Equal(t, http.StatusBadRequest, send("yesterday", "n4"))
+
+	// Подменить время при повторе нельзя: оно входит в подпись
+	req := httptest.NewRequest(http.MethodPost, "/update", strings.NewReader(body))
+	req.Header.Set(crypto.TimestampHeader, strconv.FormatInt(time.Now().Unix()+1, 10))
+	req.Header.Set(crypto.NonceHeader, "n5")
+	req.Header.Set("HashSHA256", crypto.CalculateHMAC(crypto.SignedPayload(now, "n5", []byte(body)), key))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
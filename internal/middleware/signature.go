@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+)
+
+type agentIDKey struct{}
+
+// AgentIDFromContext возвращает идентификатор агента, чья подпись проверена.
+func AgentIDFromContext(ctx context.Context) (string, bool) {
+	agentID, ok := ctx.Value(agentIDKey{}).(string)
+	return agentID, ok
+}
+
+// WithSignatureValidation создает middleware для проверки подписи Ed25519
+// по реестру ключей агентов. Работает вместе с WithHashValidation:
+// запрос может быть подписан общим ключом HMAC, ключом агента или обоими.
+// Если requireSignature включён, запросы без подписи агента отклоняются
+// для всех методов, кроме чтения (GET, HEAD, OPTIONS).
+func WithSignatureValidation(registry *crypto.AgentRegistry, requireSignature bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Если реестр не задан, пропускаем проверку
+			if registry == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			agentID := r.Header.Get(crypto.AgentIDHeader)
+			signature := r.Header.Get(crypto.SignatureHeader)
+
+			if signature == "" {
+				if requireSignature && !isReadOnly(r.Method) {
+					logger.Log.Warn("Unsigned request rejected",
+						zap.String("agent_id", agentID),
+						zap.String("url", r.URL.Path),
+					)
+					http.Error(w, "Agent signature required", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			publicKey, ok := registry.PublicKey(agentID)
+			if !ok {
+				logger.Log.Warn("Unknown agent",
+					zap.String("agent_id", agentID),
+					zap.String("url", r.URL.Path),
+				)
+				http.Error(w, "Unknown agent", http.StatusUnauthorized)
+				return
+			}
+
+			// Читаем тело запроса
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				logger.Log.Error("Failed to read request body", zap.Error(err))
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body.Close()
+
+			// Восстанавливаем тело запроса для последующих обработчиков
+			r.Body = io.NopCloser(bytes.NewBuffer(body))
+
+			payload := crypto.SignedPayload(r.Header.Get(crypto.TimestampHeader), r.Header.Get(crypto.NonceHeader), body)
+			if !crypto.VerifyEd25519(payload, publicKey, signature) {
+				logger.Log.Warn("Signature validation failed",
+					zap.String("agent_id", agentID),
+					zap.String("method", r.Method),
+					zap.String("url", r.URL.Path),
+				)
+				http.Error(w, "Signature validation failed", http.StatusBadRequest)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), agentIDKey{}, agentID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// isReadOnly сообщает, что метод только читает данные
+func isReadOnly(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+)
+
+func TestWithSignatureValidation_RequiresSignatureForWrites(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	registry := crypto.NewAgentRegistry(map[string]ed25519.PublicKey{"agent-1": pub})
+
+	handler := WithSignatureValidation(registry, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(method string, sign bool) int {
+		body := `{"value":1}`
+		req := httptest.NewRequest(method, "/api/v1/metrics/gauge/Alloc", strings.NewReader(body))
+		if sign {
+			req.Header.Set(crypto.AgentIDHeader, "agent-1")
+			req.Header.Set(crypto.SignatureHeader, crypto.SignEd25519(crypto.SignedPayload("", "", []byte(body)), priv))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Запись любым методом требует подписи агента
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		assert.Equal(t, http.StatusUnauthorized, serve(method, false), method)
+		assert.Equal(t, http.StatusOK, serve(method, true), method)
+	}
+
+	// Чтение доступно без подписи
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodOptions} {
+		assert.Equal(t, http.StatusOK, serve(method, false), method)
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/logger"
+)
+
+// ParseSubnets разбирает список подсетей в нотации CIDR (например, "10.0.0.0/8").
+func ParseSubnets(cidrs []string) ([]*net.IPNet, error) {
+	subnets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, subnet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted subnet %q: %w", cidr, err)
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+// WithTrustedSubnet создает middleware, пропускающий только запросы агентов
+// из доверенных подсетей. Адрес агента берётся из заголовка X-Real-IP,
+// который агент заполняет своим исходящим IP. Остальные запросы получают 403.
+// Пустой список подсетей выключает проверку.
+func WithTrustedSubnet(subnets []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(subnets) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			realIP := r.Header.Get("X-Real-IP")
+			ip := net.ParseIP(strings.TrimSpace(realIP))
+			if ip == nil || !inSubnets(ip, subnets) {
+				logger.Log.Warn("Request from untrusted address rejected",
+					zap.String("real_ip", realIP),
+					zap.String("remote_addr", r.RemoteAddr),
+					zap.String("url", r.URL.Path),
+				)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// inSubnets проверяет, входит ли адрес хотя бы в одну подсеть
+func inSubnets(ip net.IP, subnets []*net.IPNet) bool {
+	for _, subnet := range subnets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
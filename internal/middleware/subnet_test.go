@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTrustedSubnet(t *testing.T) {
+	subnets, err := ParseSubnets([]string{"10.0.0.0/8", " 192.168.1.0/24"})
+	require.NoError(t, err)
+
+	handler := WithTrustedSubnet(subnets)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := map[string]int{
+		"10.1.2.3":    http.StatusOK,
+		"192.168.1.5": http.StatusOK,
+		"192.168.2.5": http.StatusForbidden,
+		"not-an-ip":   http.StatusForbidden,
+		"":            http.StatusForbidden,
+	}
+	for realIP, want := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/update", nil)
+		if realIP != "" {
+			req.Header.Set("X-Real-IP", realIP)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, want, rec.Code, "X-Real-IP %q", realIP)
+	}
+
+	// Без подсетей проверка выключена
+	rec := httptest.NewRecorder()
+	open := WithTrustedSubnet(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	open.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/update", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	_, err = ParseSubnets([]string{"10.0.0.0"})
+	assert.Error(t, err)
+}
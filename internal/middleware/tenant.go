@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/auth"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
+)
+
+// WithTenant определяет арендатора запроса и сохраняет его в контексте.
+// Арендатор, привязанный к токену, имеет приоритет: запрос с другим
+// арендатором в заголовке X-Tenant-ID получает 403. Без привязки к токену
+// арендатор берётся из заголовка, а без заголовка используется tenant.Default.
+// Должен стоять после WithRole.
+func WithTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(tenant.Header)
+
+		if identity, ok := auth.IdentityFromContext(r.Context()); ok && identity.Tenant != "" {
+			if name != "" && name != identity.Tenant {
+				logger.Log.Warn("Token used for a foreign tenant",
+					zap.String("identity", identity.Name),
+					zap.String("tenant", name),
+					zap.String("url", r.URL.Path),
+				)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			name = identity.Tenant
+		}
+
+		if name != tenant.Default {
+			if err := tenant.Validate(name); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), name)))
+	})
+}
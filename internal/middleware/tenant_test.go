@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Mihklz/metrixcollector/internal/auth"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
+)
+
+func TestWithTenant(t *testing.T) {
+	var got string
+	handler := WithTenant(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = tenant.FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(identity *auth.Identity, header string) int {
+		got = "unset"
+		req := httptest.NewRequest(http.MethodPost, "/update", nil)
+		if header != "" {
+			req.Header.Set(tenant.Header, header)
+		}
+		if identity != nil {
+			req = req.WithContext(auth.WithIdentity(req.Context(), identity))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	bound := &auth.Identity{Name: "team-a-agent", Tenant: "team-a"}
+	unbound := &auth.Identity{Name: "shared-agent"}
+
+	assert.Equal(t, http.StatusOK, send(nil, ""))
+	assert.Equal(t, tenant.Default, got)
+
+	assert.Equal(t, http.StatusOK, send(nil, "team-b"))
+	assert.Equal(t, "team-b", got)
+
+	assert.Equal(t, http.StatusOK, send(unbound, "team-b"))
+	assert.Equal(t, "team-b", got)
+
+	// Арендатор токена имеет приоритет над заголовком
+	assert.Equal(t, http.StatusOK, send(bound, ""))
+	assert.Equal(t, "team-a", got)
+	assert.Equal(t, http.StatusOK, send(bound, "team-a"))
+	assert.Equal(t, http.StatusForbidden, send(bound, "team-b"))
+
+	assert.Equal(t, http.StatusBadRequest, send(nil, "../team-a"))
+}
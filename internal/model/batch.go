@@ -0,0 +1,25 @@
+package models
+
+// BatchModeHeader — заголовок, которым клиент включает режим частичного
+// успеха для пакета метрик.
+const BatchModeHeader = "X-Batch-Mode"
+
+// BatchModePartial — режим частичного успеха: корректные метрики пакета
+// сохраняются, а ошибки остальных перечисляются в ответе.
+const BatchModePartial = "partial"
+
+// BatchResult — ответ на пакет метрик в режиме частичного успеха.
+type BatchResult struct {
+	Accepted int              `json:"accepted"`
+	Errors   []BatchItemError `json:"errors,omitempty"`
+}
+
+// BatchItemError — ошибка метрики пакета с её индексом.
+// Retriable означает, что ту же метрику можно отправить повторно.
+type BatchItemError struct {
+	Index     int    `json:"index"`
+	ID        string `json:"id"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retriable bool   `json:"retriable"`
+}
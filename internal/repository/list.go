@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+// ListQuery — фильтр и страница списка метрик. Метрики упорядочены
+// по типу, затем по имени (побайтово), поэтому страницы стабильны.
+type ListQuery struct {
+	Type   string     // gauge, counter или пусто — все типы
+	Prefix string     // префикс имени
+	Regex  string     // регулярное выражение для имени (пусто — любое)
+	After  *ListAfter // вернуть метрики после этой (nil — с начала)
+	Limit  int        // максимальное число метрик (0 — без ограничения)
+}
+
+// ListAfter — позиция в упорядоченном списке метрик.
+type ListAfter struct {
+	Type string
+	Name string
+}
+
+// ListStorage расширяет Storage выборкой метрик с фильтрами на стороне хранилища.
+type ListStorage interface {
+	Storage
+	// List возвращает метрики, подходящие под запрос.
+	List(query ListQuery) ([]models.Metrics, error)
+}
+
+// List возвращает метрики, подходящие под запрос. Хранилища без ListStorage
+// фильтруются в памяти после чтения всех метрик.
+func List(storage Storage, query ListQuery) ([]models.Metrics, error) {
+	if listStorage, ok := storage.(ListStorage); ok {
+		return listStorage.List(query)
+	}
+
+	pattern, err := nameRegex(query)
+	if err != nil {
+		return nil, err
+	}
+	match := func(metricType, name string) bool {
+		if query.Type != "" && metricType != query.Type {
+			return false
+		}
+		if !strings.HasPrefix(name, query.Prefix) {
+			return false
+		}
+		if pattern != nil && !pattern.MatchString(name) {
+			return false
+		}
+		if after := query.After; after != nil {
+			return metricType > after.Type || (metricType == after.Type && name > after.Name)
+		}
+		return true
+	}
+
+	var metrics []models.Metrics
+	if query.Type == "" || query.Type == models.Counter {
+		for name, value := range storage.GetAllCounters() {
+			if match(models.Counter, name) {
+				delta := int64(value)
+				metrics = append(metrics, models.Metrics{ID: name, MType: models.Counter, Delta: &delta})
+			}
+		}
+	}
+	if query.Type == "" || query.Type == models.Gauge {
+		for name, value := range storage.GetAllGauges() {
+			if match(models.Gauge, name) {
+				v := float64(value)
+				metrics = append(metrics, models.Metrics{ID: name, MType: models.Gauge, Value: &v})
+			}
+		}
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].MType != metrics[j].MType {
+			return metrics[i].MType < metrics[j].MType
+		}
+		return metrics[i].ID < metrics[j].ID
+	})
+	if query.Limit > 0 && len(metrics) > query.Limit {
+		metrics = metrics[:query.Limit]
+	}
+	return metrics, nil
+}
+
+// nameRegex компилирует регулярное выражение запроса (nil, если его нет).
+// Все хранилища проверяют имена одним диалектом — регулярными выражениями Go.
+func nameRegex(query ListQuery) (*regexp.Regexp, error) {
+	if query.Regex == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(query.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name regex: %w", err)
+	}
+	return pattern, nil
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+func metricIDs(metrics []models.Metrics) []string {
+	ids := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		ids = append(ids, metric.MType+"/"+metric.ID)
+	}
+	return ids
+}
+
+func TestList(t *testing.T) {
+	storage := NewMemStorage()
+	for _, name := range []string{"http_requests", "http_errors", "Alloc", "HeapAlloc"} {
+		require.NoError(t, storage.Update(models.Gauge, name, "1"))
+	}
+	require.NoError(t, storage.Update(models.Counter, "PollCount", "1"))
+	require.NoError(t, storage.Update(models.Counter, "http_total", "1"))
+
+	// Порядок: тип, затем имя побайтово
+	metrics, err := List(storage, ListQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"counter/PollCount", "counter/http_total",
+		"gauge/Alloc", "gauge/HeapAlloc", "gauge/http_errors", "gauge/http_requests",
+	}, metricIDs(metrics))
+
+	metrics, err = List(storage, ListQuery{Type: models.Gauge, Prefix: "http_"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gauge/http_errors", "gauge/http_requests"}, metricIDs(metrics))
+
+	metrics, err = List(storage, ListQuery{Regex: "Alloc$"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gauge/Alloc", "gauge/HeapAlloc"}, metricIDs(metrics))
+
+	// Страница после позиции курсора
+	metrics, err = List(storage, ListQuery{After: &ListAfter{Type: models.Counter, Name: "http_total"}, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gauge/Alloc", "gauge/HeapAlloc"}, metricIDs(metrics))
+
+	_, err = List(storage, ListQuery{Regex: "("})
+	assert.Error(t, err)
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
 )
 
 // Gauge представляет значение метрики gauge.
@@ -18,10 +19,22 @@ type Gauge float64
 type Counter int64
 
 // MemStorage хранит метрики в памяти и обеспечивает потокобезопасный доступ.
+// Метрики каждого арендатора лежат в отдельных картах (см. ForTenant).
 type MemStorage struct {
 	mu       sync.RWMutex
 	Gauges   map[string]Gauge
 	Counters map[string]Counter
+
+	root      *MemStorage // хранилище по умолчанию, если это хранилище арендатора
+	tenantsMu sync.Mutex
+	tenants   map[string]*MemStorage
+}
+
+// storedMetric — метрика в файле хранилища. Метрики арендатора по умолчанию
+// сохраняются без поля tenant, поэтому старые файлы читаются без изменений.
+type storedMetric struct {
+	Tenant string `json:"tenant,omitempty"`
+	models.Metrics
 }
 
 // NewMemStorage создает новое in-memory хранилище метрик.
@@ -32,8 +45,44 @@ func NewMemStorage() *MemStorage {
 	}
 }
 
+// ForTenant возвращает хранилище арендатора, создавая его при первом обращении.
+func (m *MemStorage) ForTenant(name string) Storage {
+	return m.tenant(name)
+}
+
+// tenant возвращает хранилище арендатора
+func (m *MemStorage) tenant(name string) *MemStorage {
+	if m.root != nil {
+		return m.root.tenant(name)
+	}
+	if name == tenant.Default {
+		return m
+	}
+
+	m.tenantsMu.Lock()
+	defer m.tenantsMu.Unlock()
+
+	if m.tenants == nil {
+		m.tenants = make(map[string]*MemStorage)
+	}
+	storage, ok := m.tenants[name]
+	if !ok {
+		storage = NewMemStorage()
+		storage.root = m
+		m.tenants[name] = storage
+	}
+	return storage
+}
+
 // Update обновляет значение одной метрики по ее типу и имени.
 func (m *MemStorage) Update(metricType, name, value string) error {
+	_, err := m.UpdateReturning(metricType, name, value)
+	return err
+}
+
+// UpdateReturning обновляет метрику и возвращает её значение после записи,
+// вычисленное под той же блокировкой.
+func (m *MemStorage) UpdateReturning(metricType, name, value string) (models.Metrics, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -41,20 +90,21 @@ func (m *MemStorage) Update(metricType, name, value string) error {
 	case models.Gauge:
 		v, err := strconv.ParseFloat(value, 64)
 		if err != nil {
-			return fmt.Errorf("invalid gauge value: %w", err)
+			return models.Metrics{}, fmt.Errorf("invalid gauge value: %w", err)
 		}
 		m.Gauges[name] = Gauge(v)
+		return models.Metrics{ID: name, MType: models.Gauge, Value: &v}, nil
 	case models.Counter:
 		v, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
-			return fmt.Errorf("invalid counter value: %w", err)
+			return models.Metrics{}, fmt.Errorf("invalid counter value: %w", err)
 		}
 		m.Counters[name] += Counter(v)
+		total := int64(m.Counters[name])
+		return models.Metrics{ID: name, MType: models.Counter, Delta: &total}, nil
 	default:
-		return errors.New("unsupported metric type")
+		return models.Metrics{}, errors.New("unsupported metric type")
 	}
-
-	return nil
 }
 
 // GetGauge возвращает значение gauge-метрики по имени.
@@ -97,32 +147,38 @@ func (m *MemStorage) GetAllCounters() map[string]Counter {
 	return copyMap
 }
 
-// SaveToFile сохраняет все метрики в файл в JSON формате.
-func (m *MemStorage) SaveToFile(filename string) error {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// Delete удаляет метрику по типу и имени.
+func (m *MemStorage) Delete(metricType, name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	metrics := make([]models.Metrics, 0, len(m.Gauges)+len(m.Counters))
+	var found bool
+	switch metricType {
+	case models.Gauge:
+		_, found = m.Gauges[name]
+		delete(m.Gauges, name)
+	case models.Counter:
+		_, found = m.Counters[name]
+		delete(m.Counters, name)
+	default:
+		return false, errors.New("unsupported metric type")
+	}
+	return found, nil
+}
 
-	// Добавляем все gauge метрики
-	for name, value := range m.Gauges {
-		val := float64(value)
-		metrics = append(metrics, models.Metrics{
-			ID:    name,
-			MType: models.Gauge,
-			Value: &val,
-		})
+// SaveToFile сохраняет все метрики, включая метрики арендаторов, в файл в JSON формате.
+func (m *MemStorage) SaveToFile(filename string) error {
+	if m.root != nil {
+		return m.root.SaveToFile(filename)
 	}
 
-	// Добавляем все counter метрики
-	for name, value := range m.Counters {
-		val := int64(value)
-		metrics = append(metrics, models.Metrics{
-			ID:    name,
-			MType: models.Counter,
-			Delta: &val,
-		})
+	metrics := m.snapshot(tenant.Default, nil)
+
+	m.tenantsMu.Lock()
+	for name, storage := range m.tenants {
+		metrics = storage.snapshot(name, metrics)
 	}
+	m.tenantsMu.Unlock()
 
 	// Сериализуем в JSON с красивым форматированием
 	data, err := json.MarshalIndent(metrics, "", "  ")
@@ -139,8 +195,40 @@ func (m *MemStorage) SaveToFile(filename string) error {
 	return nil
 }
 
+// snapshot добавляет к dst копию метрик хранилища с пометкой арендатора
+func (m *MemStorage) snapshot(name string, dst []storedMetric) []storedMetric {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Добавляем все gauge метрики
+	for id, value := range m.Gauges {
+		val := float64(value)
+		dst = append(dst, storedMetric{Tenant: name, Metrics: models.Metrics{
+			ID:    id,
+			MType: models.Gauge,
+			Value: &val,
+		}})
+	}
+
+	// Добавляем все counter метрики
+	for id, value := range m.Counters {
+		val := int64(value)
+		dst = append(dst, storedMetric{Tenant: name, Metrics: models.Metrics{
+			ID:    id,
+			MType: models.Counter,
+			Delta: &val,
+		}})
+	}
+
+	return dst
+}
+
 // LoadFromFile загружает метрики из файла в JSON формате.
 func (m *MemStorage) LoadFromFile(filename string) error {
+	if m.root != nil {
+		return m.root.LoadFromFile(filename)
+	}
+
 	// Проверяем, существует ли файл
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		// Файл не существует - это нормально для первого запуска
@@ -158,36 +246,103 @@ func (m *MemStorage) LoadFromFile(filename string) error {
 		return nil
 	}
 
-	var metrics []models.Metrics
+	var metrics []storedMetric
 	err = json.Unmarshal(data, &metrics)
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal metrics: %w", err)
 	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// Загружаем метрики в storage
+	// Загружаем метрики в хранилища арендаторов
 	for _, metric := range metrics {
-		switch metric.MType {
+		m.tenant(metric.Tenant).load(metric.Metrics)
+	}
+
+	return nil
+}
+
+// SeriesCount возвращает число рядов метрик.
+func (m *MemStorage) SeriesCount() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.Gauges) + len(m.Counters), nil
+}
+
+// TotalSeriesCount возвращает число рядов метрик всех арендаторов.
+func (m *MemStorage) TotalSeriesCount() (int, error) {
+	if m.root != nil {
+		return m.root.TotalSeriesCount()
+	}
+
+	total, _ := m.SeriesCount()
+
+	m.tenantsMu.Lock()
+	defer m.tenantsMu.Unlock()
+	for _, storage := range m.tenants {
+		count, _ := storage.SeriesCount()
+		total += count
+	}
+	return total, nil
+}
+
+// ExistingSeries возвращает те ряды из keys, которые уже есть в хранилище.
+func (m *MemStorage) ExistingSeries(keys []SeriesKey) (map[SeriesKey]bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	existing := make(map[SeriesKey]bool)
+	for _, key := range keys {
+		var exists bool
+		switch key.Type {
 		case models.Gauge:
-			if metric.Value != nil {
-				m.Gauges[metric.ID] = Gauge(*metric.Value)
-			}
+			_, exists = m.Gauges[key.Name]
 		case models.Counter:
-			if metric.Delta != nil {
-				m.Counters[metric.ID] = Counter(*metric.Delta)
-			}
+			_, exists = m.Counters[key.Name]
+		}
+		if exists {
+			existing[key] = true
 		}
 	}
+	return existing, nil
+}
 
-	return nil
+// load записывает сохранённое значение метрики
+func (m *MemStorage) load(metric models.Metrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch metric.MType {
+	case models.Gauge:
+		if metric.Value != nil {
+			m.Gauges[metric.ID] = Gauge(*metric.Value)
+		}
+	case models.Counter:
+		if metric.Delta != nil {
+			m.Counters[metric.ID] = Counter(*metric.Delta)
+		}
+	}
 }
 
 // UpdateBatch обновляет множество метрик в рамках одной операции с блокировкой.
 func (m *MemStorage) UpdateBatch(metrics []models.Metrics) error {
+	_, err := m.updateBatch(metrics, false)
+	return err
+}
+
+// UpdateBatchReturning обновляет пакет как UpdateBatch и возвращает значения
+// метрик после записи, вычисленные под той же блокировкой.
+func (m *MemStorage) UpdateBatchReturning(metrics []models.Metrics) ([]models.Metrics, error) {
+	return m.updateBatch(metrics, true)
+}
+
+// updateBatch обновляет пакет метрик; если returning, собирает их новые значения
+func (m *MemStorage) updateBatch(metrics []models.Metrics, returning bool) ([]models.Metrics, error) {
 	if len(metrics) == 0 {
-		return nil
+		return nil, nil
+	}
+
+	var committed []models.Metrics
+	if returning {
+		committed = make([]models.Metrics, 0, len(metrics))
 	}
 
 	// Блокируем мьютекс на время всей batch операции
@@ -199,21 +354,29 @@ func (m *MemStorage) UpdateBatch(metrics []models.Metrics) error {
 		switch metric.MType {
 		case models.Gauge:
 			if metric.Value == nil {
-				return fmt.Errorf("gauge metric %s missing value", metric.ID)
+				return nil, fmt.Errorf("gauge metric %s missing value", metric.ID)
 			}
 			m.Gauges[metric.ID] = Gauge(*metric.Value)
+			if returning {
+				v := *metric.Value
+				committed = append(committed, models.Metrics{ID: metric.ID, MType: models.Gauge, Value: &v})
+			}
 
 		case models.Counter:
 			if metric.Delta == nil {
-				return fmt.Errorf("counter metric %s missing delta", metric.ID)
+				return nil, fmt.Errorf("counter metric %s missing delta", metric.ID)
 			}
 			// Для counter добавляем к существующему значению
 			m.Counters[metric.ID] += Counter(*metric.Delta)
+			if returning {
+				total := int64(m.Counters[metric.ID])
+				committed = append(committed, models.Metrics{ID: metric.ID, MType: models.Counter, Delta: &total})
+			}
 
 		default:
-			return fmt.Errorf("unsupported metric type: %s", metric.MType)
+			return nil, fmt.Errorf("unsupported metric type: %s", metric.MType)
 		}
 	}
 
-	return nil
+	return committed, nil
 }
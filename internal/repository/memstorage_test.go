@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"path/filepath"
 	"testing"
 )
 
@@ -40,3 +41,47 @@ func TestMemStorage_UpdateInvalidValue(t *testing.T) {
 		t.Error("expected error for invalid float, got nil")
 	}
 }
+
+func TestMemStorage_TenantsAreIsolated(t *testing.T) {
+	s := NewMemStorage()
+	teamA := s.ForTenant("team-a")
+
+	_ = s.Update("counter", "PollCount", "1")
+	_ = teamA.Update("counter", "PollCount", "10")
+	_ = teamA.Update("gauge", "Alloc", "5")
+
+	if got, _ := s.GetCounter("PollCount"); got != 1 {
+		t.Errorf("default tenant: expected 1, got %v", got)
+	}
+	if got, _ := teamA.GetCounter("PollCount"); got != 10 {
+		t.Errorf("team-a: expected 10, got %v", got)
+	}
+	if _, ok := s.GetGauge("Alloc"); ok {
+		t.Error("gauge of team-a is visible to the default tenant")
+	}
+	if s.ForTenant("team-a") != teamA {
+		t.Error("ForTenant must return the same storage for the same tenant")
+	}
+}
+
+func TestMemStorage_SaveAndLoadTenants(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.json")
+
+	s := NewMemStorage()
+	_ = s.Update("gauge", "Alloc", "1.5")
+	_ = s.ForTenant("team-a").Update("gauge", "Alloc", "2.5")
+	if err := s.ForTenant("team-a").SaveToFile(filename); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	loaded := NewMemStorage()
+	if err := loaded.LoadFromFile(filename); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got, _ := loaded.GetGauge("Alloc"); got != 1.5 {
+		t.Errorf("default tenant: expected 1.5, got %v", got)
+	}
+	if got, _ := loaded.ForTenant("team-a").GetGauge("Alloc"); got != 2.5 {
+		t.Errorf("team-a: expected 2.5, got %v", got)
+	}
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
+)
+
+// UpdateListener получает метрики после успешной записи в хранилище.
+type UpdateListener interface {
+	// Active сообщает, нужны ли сейчас обновления. Пока обновления
+	// не нужны, хранилище не собирает значения после записи.
+	Active() bool
+	// MetricsUpdated получает записанные метрики арендатора со значениями
+	// после записи: для counter — накопленную сумму, а не приращение.
+	MetricsUpdated(tenant string, metrics []models.Metrics)
+}
+
+// NotifyStorage сообщает слушателю о каждой успешной записи метрик,
+// в том числе о записи мимо сервиса метрик.
+type NotifyStorage struct {
+	Storage
+	listener UpdateListener
+	tenant   string
+}
+
+// WithUpdateListener оборачивает хранилище уведомлениями listener.
+// При listener == nil хранилище возвращается без изменений.
+func WithUpdateListener(storage Storage, listener UpdateListener) Storage {
+	if listener == nil {
+		return storage
+	}
+	return &NotifyStorage{Storage: storage, listener: listener, tenant: tenant.Default}
+}
+
+// ForTenant возвращает хранилище арендатора с тем же слушателем.
+func (n *NotifyStorage) ForTenant(name string) Storage {
+	return &NotifyStorage{
+		Storage:  n.Storage.ForTenant(name),
+		listener: n.listener,
+		tenant:   name,
+	}
+}
+
+// Update обновляет метрику и сообщает её новое значение.
+func (n *NotifyStorage) Update(metricType, name, value string) error {
+	if !n.listener.Active() {
+		return n.Storage.Update(metricType, name, value)
+	}
+	_, err := n.UpdateReturning(metricType, name, value)
+	return err
+}
+
+// UpdateReturning обновляет метрику, сообщает и возвращает её новое значение.
+func (n *NotifyStorage) UpdateReturning(metricType, name, value string) (models.Metrics, error) {
+	committed, err := UpdateReturning(n.Storage, metricType, name, value)
+	if err != nil {
+		return models.Metrics{}, err
+	}
+	n.notify([]models.Metrics{committed})
+	return committed, nil
+}
+
+// UpdateBatch обновляет пакет метрик и сообщает их новые значения.
+func (n *NotifyStorage) UpdateBatch(metrics []models.Metrics) error {
+	if !n.listener.Active() {
+		return updateBatch(n.Storage, metrics)
+	}
+	_, err := n.UpdateBatchReturning(metrics)
+	return err
+}
+
+// UpdateBatchReturning обновляет пакет метрик, сообщает и возвращает
+// их новые значения.
+func (n *NotifyStorage) UpdateBatchReturning(metrics []models.Metrics) ([]models.Metrics, error) {
+	committed, err := UpdateBatchReturning(n.Storage, metrics)
+	if err != nil {
+		return nil, err
+	}
+	n.notify(committed)
+	return committed, nil
+}
+
+// Delete удаляет метрику средствами исходного хранилища.
+func (n *NotifyStorage) Delete(metricType, name string) (bool, error) {
+	return Delete(n.Storage, metricType, name)
+}
+
+// List выбирает метрики средствами исходного хранилища.
+func (n *NotifyStorage) List(query ListQuery) ([]models.Metrics, error) {
+	return List(n.Storage, query)
+}
+
+// SeriesCount считает ряды средствами исходного хранилища.
+func (n *NotifyStorage) SeriesCount() (int, error) {
+	return SeriesCount(n.Storage)
+}
+
+// TotalSeriesCount считает ряды всех арендаторов средствами исходного хранилища.
+func (n *NotifyStorage) TotalSeriesCount() (int, error) {
+	return TotalSeriesCount(n.Storage)
+}
+
+// ExistingSeries проверяет ряды средствами исходного хранилища.
+func (n *NotifyStorage) ExistingSeries(keys []SeriesKey) (map[SeriesKey]bool, error) {
+	return ExistingSeries(n.Storage, keys)
+}
+
+// notify передаёт слушателю значения метрик после записи. Повторы одной
+// метрики в пакете сообщаются один раз — на месте первой записи
+// со значением последней.
+func (n *NotifyStorage) notify(committed []models.Metrics) {
+	if !n.listener.Active() {
+		return
+	}
+
+	positions := make(map[string]int, len(committed))
+	updates := make([]models.Metrics, 0, len(committed))
+	for _, metric := range committed {
+		if metric.Value == nil && metric.Delta == nil {
+			continue
+		}
+		key := metric.MType + "/" + metric.ID
+		if i, ok := positions[key]; ok {
+			updates[i] = metric
+			continue
+		}
+		positions[key] = len(updates)
+		updates = append(updates, metric)
+	}
+
+	if len(updates) > 0 {
+		n.listener.MetricsUpdated(n.tenant, updates)
+	}
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+// recordingListener запоминает полученные обновления
+type recordingListener struct {
+	active  bool
+	tenants []string
+	updates []models.Metrics
+}
+
+func (l *recordingListener) Active() bool { return l.active }
+
+func (l *recordingListener) MetricsUpdated(tenant string, metrics []models.Metrics) {
+	for range metrics {
+		l.tenants = append(l.tenants, tenant)
+	}
+	l.updates = append(l.updates, metrics...)
+}
+
+func TestWithUpdateListener(t *testing.T) {
+	listener := &recordingListener{active: true}
+	storage := WithUpdateListener(NewMemStorage(), listener)
+
+	// Для counter сообщается накопленная сумма, а не приращение
+	require.NoError(t, storage.Update(models.Counter, "PollCount", "2"))
+	require.NoError(t, storage.Update(models.Counter, "PollCount", "3"))
+
+	// Повторы в пакете сообщаются один раз со значением после записи
+	one, two, gauge := int64(1), int64(2), 1.5
+	require.NoError(t, storage.ForTenant("team-a").(BatchStorage).UpdateBatch([]models.Metrics{
+		{ID: "Requests", MType: models.Counter, Delta: &one},
+		{ID: "Alloc", MType: models.Gauge, Value: &gauge},
+		{ID: "Requests", MType: models.Counter, Delta: &two},
+	}))
+
+	require.Len(t, listener.updates, 4)
+	assert.Equal(t, int64(2), *listener.updates[0].Delta)
+	assert.Equal(t, int64(5), *listener.updates[1].Delta)
+	assert.Equal(t, "Requests", listener.updates[2].ID)
+	assert.Equal(t, int64(3), *listener.updates[2].Delta)
+	assert.Equal(t, 1.5, *listener.updates[3].Value)
+	assert.Equal(t, []string{"", "", "team-a", "team-a"}, listener.tenants)
+
+	// Ошибки записи и записи без подписчиков не сообщаются
+	require.Error(t, storage.Update(models.Gauge, "Alloc", "abc"))
+	listener.active = false
+	require.NoError(t, storage.Update(models.Gauge, "Alloc", "2"))
+	assert.Len(t, listener.updates, 4)
+
+	// Удаление и список работают через обёртку
+	deleted, err := Delete(storage, models.Gauge, "Alloc")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	metrics, err := List(storage, ListQuery{})
+	require.NoError(t, err)
+	assert.Len(t, metrics, 1)
+}
+
+// readCountingStorage считает чтения отдельных метрик
+type readCountingStorage struct {
+	*MemStorage
+	reads int
+}
+
+func (s *readCountingStorage) GetGauge(name string) (Gauge, bool) {
+	s.reads++
+	return s.MemStorage.GetGauge(name)
+}
+
+func (s *readCountingStorage) GetCounter(name string) (Counter, bool) {
+	s.reads++
+	return s.MemStorage.GetCounter(name)
+}
+
+func TestWithUpdateListener_UsesReturnedValues(t *testing.T) {
+	listener := &recordingListener{active: true}
+	inner := &readCountingStorage{MemStorage: NewMemStorage()}
+	storage := WithUpdateListener(WithSeriesQuota(inner, 10), listener)
+
+	one, gauge := int64(1), 2.5
+	require.NoError(t, storage.Update(models.Counter, "PollCount", "4"))
+	require.NoError(t, storage.(BatchStorage).UpdateBatch([]models.Metrics{
+		{ID: "PollCount", MType: models.Counter, Delta: &one},
+		{ID: "Alloc", MType: models.Gauge, Value: &gauge},
+	}))
+
+	// Значения берутся из самой записи, а не перечитываются
+	assert.Zero(t, inner.reads)
+	require.Len(t, listener.updates, 3)
+	assert.Equal(t, int64(4), *listener.updates[0].Delta)
+	assert.Equal(t, int64(5), *listener.updates[1].Delta)
+	assert.Equal(t, 2.5, *listener.updates[2].Value)
+}
+
+func TestWithUpdateListener_Nil(t *testing.T) {
+	storage := NewMemStorage()
+	assert.Same(t, storage, WithUpdateListener(storage, nil))
+}
@@ -3,13 +3,16 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 
 	"github.com/Mihklz/metrixcollector/internal/logger"
@@ -17,10 +20,12 @@ import (
 	"github.com/Mihklz/metrixcollector/internal/retry"
 )
 
-// PostgresStorage реализует интерфейс Storage для PostgreSQL
+// PostgresStorage реализует интерфейс Storage для PostgreSQL.
+// Метрики арендаторов различаются столбцом tenant (миграция 000003).
 type PostgresStorage struct {
 	db          *sql.DB
 	retryConfig *retry.RetryConfig
+	tenant      string
 }
 
 // NewPostgresStorage создает новое PostgreSQL хранилище
@@ -64,71 +69,93 @@ func (ps *PostgresStorage) runMigrations(migrationsPath string) error {
 	return nil
 }
 
+// ForTenant возвращает хранилище, все запросы которого ограничены арендатором.
+func (ps *PostgresStorage) ForTenant(name string) Storage {
+	return &PostgresStorage{
+		db:          ps.db,
+		retryConfig: ps.retryConfig,
+		tenant:      name,
+	}
+}
+
 // Update обновляет или создает метрику
 func (ps *PostgresStorage) Update(metricType, name, value string) error {
+	_, err := ps.UpdateReturning(metricType, name, value)
+	return err
+}
+
+// UpdateReturning обновляет или создает метрику и возвращает её значение
+// после записи (RETURNING того же запроса).
+func (ps *PostgresStorage) UpdateReturning(metricType, name, value string) (models.Metrics, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	return retry.Execute(ctx, ps.retryConfig, func() error {
+	var metric models.Metrics
+	err := retry.Execute(ctx, ps.retryConfig, func() error {
+		var err error
 		switch metricType {
 		case "gauge":
-			return ps.updateGauge(ctx, name, value)
+			metric, err = ps.updateGauge(ctx, name, value)
 		case "counter":
-			return ps.updateCounter(ctx, name, value)
+			metric, err = ps.updateCounter(ctx, name, value)
 		default:
-			return fmt.Errorf("unsupported metric type: %s", metricType)
+			err = fmt.Errorf("unsupported metric type: %s", metricType)
 		}
+		return err
 	})
+	return metric, err
 }
 
 // updateGauge обновляет gauge метрику
-func (ps *PostgresStorage) updateGauge(ctx context.Context, name, value string) error {
+func (ps *PostgresStorage) updateGauge(ctx context.Context, name, value string) (models.Metrics, error) {
 	floatValue, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return fmt.Errorf("invalid gauge value: %w", err)
+		return models.Metrics{}, fmt.Errorf("invalid gauge value: %w", err)
 	}
 
 	query := `
-		INSERT INTO metrics (name, type, value, updated_at) 
-		VALUES ($1, 'gauge', $2, CURRENT_TIMESTAMP)
-		ON CONFLICT (name, type) 
-		DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP`
-
-	_, err = ps.db.ExecContext(ctx, query, name, floatValue)
-	if err != nil {
-		return fmt.Errorf("failed to update gauge metric: %w", err)
+		INSERT INTO metrics (tenant, name, type, value, updated_at) 
+		VALUES ($1, $2, 'gauge', $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (tenant, name, type) 
+		DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP
+		RETURNING value`
+
+	var stored float64
+	if err := ps.db.QueryRowContext(ctx, query, ps.tenant, name, floatValue).Scan(&stored); err != nil {
+		return models.Metrics{}, fmt.Errorf("failed to update gauge metric: %w", err)
 	}
 
 	logger.Log.Debug("Gauge metric updated",
 		zap.String("name", name),
 		zap.Float64("value", floatValue),
 	)
-	return nil
+	return models.Metrics{ID: name, MType: models.Gauge, Value: &stored}, nil
 }
 
 // updateCounter обновляет counter метрику (добавляет к существующему значению)
-func (ps *PostgresStorage) updateCounter(ctx context.Context, name, value string) error {
+func (ps *PostgresStorage) updateCounter(ctx context.Context, name, value string) (models.Metrics, error) {
 	intValue, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
-		return fmt.Errorf("invalid counter value: %w", err)
+		return models.Metrics{}, fmt.Errorf("invalid counter value: %w", err)
 	}
 
 	query := `
-		INSERT INTO metrics (name, type, delta, updated_at) 
-		VALUES ($1, 'counter', $2, CURRENT_TIMESTAMP)
-		ON CONFLICT (name, type) 
-		DO UPDATE SET delta = metrics.delta + EXCLUDED.delta, updated_at = CURRENT_TIMESTAMP`
-
-	_, err = ps.db.ExecContext(ctx, query, name, intValue)
-	if err != nil {
-		return fmt.Errorf("failed to update counter metric: %w", err)
+		INSERT INTO metrics (tenant, name, type, delta, updated_at) 
+		VALUES ($1, $2, 'counter', $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (tenant, name, type) 
+		DO UPDATE SET delta = metrics.delta + EXCLUDED.delta, updated_at = CURRENT_TIMESTAMP
+		RETURNING delta`
+
+	var total int64
+	if err := ps.db.QueryRowContext(ctx, query, ps.tenant, name, intValue).Scan(&total); err != nil {
+		return models.Metrics{}, fmt.Errorf("failed to update counter metric: %w", err)
 	}
 
 	logger.Log.Debug("Counter metric updated",
 		zap.String("name", name),
 		zap.Int64("delta", intValue),
 	)
-	return nil
+	return models.Metrics{ID: name, MType: models.Counter, Delta: &total}, nil
 }
 
 // GetGauge возвращает gauge метрику
@@ -137,9 +164,9 @@ func (ps *PostgresStorage) GetGauge(name string) (Gauge, bool) {
 	defer cancel()
 
 	var value float64
-	query := `SELECT value FROM metrics WHERE name = $1 AND type = 'gauge'`
+	query := `SELECT value FROM metrics WHERE tenant = $1 AND name = $2 AND type = 'gauge'`
 
-	err := ps.db.QueryRowContext(ctx, query, name).Scan(&value)
+	err := ps.db.QueryRowContext(ctx, query, ps.tenant, name).Scan(&value)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, false
@@ -157,9 +184,9 @@ func (ps *PostgresStorage) GetCounter(name string) (Counter, bool) {
 	defer cancel()
 
 	var delta int64
-	query := `SELECT delta FROM metrics WHERE name = $1 AND type = 'counter'`
+	query := `SELECT delta FROM metrics WHERE tenant = $1 AND name = $2 AND type = 'counter'`
 
-	err := ps.db.QueryRowContext(ctx, query, name).Scan(&delta)
+	err := ps.db.QueryRowContext(ctx, query, ps.tenant, name).Scan(&delta)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return 0, false
@@ -177,9 +204,9 @@ func (ps *PostgresStorage) GetAllGauges() map[string]Gauge {
 	defer cancel()
 
 	gauges := make(map[string]Gauge)
-	query := `SELECT name, value FROM metrics WHERE type = 'gauge'`
+	query := `SELECT name, value FROM metrics WHERE tenant = $1 AND type = 'gauge'`
 
-	rows, err := ps.db.QueryContext(ctx, query)
+	rows, err := ps.db.QueryContext(ctx, query, ps.tenant)
 	if err != nil {
 		logger.Log.Error("Failed to get all gauge metrics", zap.Error(err))
 		return gauges
@@ -209,9 +236,9 @@ func (ps *PostgresStorage) GetAllCounters() map[string]Counter {
 	defer cancel()
 
 	counters := make(map[string]Counter)
-	query := `SELECT name, delta FROM metrics WHERE type = 'counter'`
+	query := `SELECT name, delta FROM metrics WHERE tenant = $1 AND type = 'counter'`
 
-	rows, err := ps.db.QueryContext(ctx, query)
+	rows, err := ps.db.QueryContext(ctx, query, ps.tenant)
 	if err != nil {
 		logger.Log.Error("Failed to get all counter metrics", zap.Error(err))
 		return counters
@@ -235,6 +262,173 @@ func (ps *PostgresStorage) GetAllCounters() map[string]Counter {
 	return counters
 }
 
+// Delete удаляет метрику арендатора
+func (ps *PostgresStorage) Delete(metricType, name string) (bool, error) {
+	if metricType != models.Gauge && metricType != models.Counter {
+		return false, errors.New("unsupported metric type")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM metrics WHERE tenant = $1 AND name = $2 AND type = $3`
+	result, err := ps.db.ExecContext(ctx, query, ps.tenant, name, metricType)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete metric: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete metric: %w", err)
+	}
+
+	logger.Log.Debug("Metric deleted",
+		zap.String("name", name),
+		zap.String("type", metricType),
+		zap.Bool("found", deleted > 0),
+	)
+	return deleted > 0, nil
+}
+
+// SeriesCount возвращает число рядов метрик арендатора.
+func (ps *PostgresStorage) SeriesCount() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := ps.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM metrics WHERE tenant = $1`, ps.tenant).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count series: %w", err)
+	}
+	return count, nil
+}
+
+// TotalSeriesCount возвращает число рядов метрик всех арендаторов.
+func (ps *PostgresStorage) TotalSeriesCount() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	if err := ps.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM metrics`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count series: %w", err)
+	}
+	return count, nil
+}
+
+// ExistingSeries возвращает те ряды из keys, которые уже есть у арендатора.
+// Ряды проверяются одним запросом по индексу (tenant, name, type).
+func (ps *PostgresStorage) ExistingSeries(keys []SeriesKey) (map[SeriesKey]bool, error) {
+	existing := make(map[SeriesKey]bool)
+	if len(keys) == 0 {
+		return existing, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	names := make([]string, len(keys))
+	types := make([]string, len(keys))
+	for i, key := range keys {
+		names[i], types[i] = key.Name, key.Type
+	}
+
+	rows, err := ps.db.QueryContext(ctx, `
+		SELECT m.name, m.type FROM metrics m
+		JOIN unnest($2::text[], $3::text[]) AS k(name, type) ON m.name = k.name AND m.type = k.type
+		WHERE m.tenant = $1`,
+		ps.tenant, pq.Array(names), pq.Array(types))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check series: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key SeriesKey
+		if err := rows.Scan(&key.Name, &key.Type); err != nil {
+			return nil, fmt.Errorf("failed to scan series: %w", err)
+		}
+		existing[key] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check series: %w", err)
+	}
+	return existing, nil
+}
+
+// List выбирает метрики арендатора с фильтрами и пагинацией на стороне БД.
+// Имена сравниваются побайтово (COLLATE "C"), как в остальных хранилищах.
+// Регулярное выражение проверяется в Go по строкам, уже отобранным
+// по типу, префиксу и позиции, — так же, как в MemStorage.
+func (ps *PostgresStorage) List(query ListQuery) ([]models.Metrics, error) {
+	pattern, err := nameRegex(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var sqlQuery strings.Builder
+	args := []any{ps.tenant}
+	sqlQuery.WriteString(`SELECT name, type, value, delta FROM metrics WHERE tenant = $1`)
+	if query.Type != "" {
+		args = append(args, query.Type)
+		fmt.Fprintf(&sqlQuery, ` AND type = $%d`, len(args))
+	}
+	if query.Prefix != "" {
+		args = append(args, escapeLike(query.Prefix)+"%")
+		fmt.Fprintf(&sqlQuery, ` AND name LIKE $%d ESCAPE '\'`, len(args))
+	}
+	if query.After != nil {
+		args = append(args, query.After.Type, query.After.Name)
+		fmt.Fprintf(&sqlQuery, ` AND (type, name COLLATE "C") > ($%d, $%d)`, len(args)-1, len(args))
+	}
+	sqlQuery.WriteString(` ORDER BY type, name COLLATE "C"`)
+	// Диалекты регулярных выражений Go и PostgreSQL различаются, поэтому
+	// с регулярным выражением LIMIT применяется при чтении строк
+	if query.Limit > 0 && pattern == nil {
+		args = append(args, query.Limit)
+		fmt.Fprintf(&sqlQuery, ` LIMIT $%d`, len(args))
+	}
+
+	rows, err := ps.db.QueryContext(ctx, sqlQuery.String(), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var metrics []models.Metrics
+	for rows.Next() {
+		var metric models.Metrics
+		var value sql.NullFloat64
+		var delta sql.NullInt64
+		if err := rows.Scan(&metric.ID, &metric.MType, &value, &delta); err != nil {
+			return nil, fmt.Errorf("failed to scan metric: %w", err)
+		}
+		if value.Valid {
+			metric.Value = &value.Float64
+		}
+		if delta.Valid {
+			metric.Delta = &delta.Int64
+		}
+		if pattern != nil && !pattern.MatchString(metric.ID) {
+			continue
+		}
+		metrics = append(metrics, metric)
+		if query.Limit > 0 && len(metrics) == query.Limit {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list metrics: %w", err)
+	}
+	return metrics, nil
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
 // SaveToFile не поддерживается для PostgreSQL хранилища
 func (ps *PostgresStorage) SaveToFile(filename string) error {
 	return fmt.Errorf("SaveToFile not supported for PostgreSQL storage")
@@ -257,14 +451,24 @@ func (ps *PostgresStorage) GetConnection() *sql.DB {
 
 // UpdateBatch обновляет множество метрик в рамках одной транзакции
 func (ps *PostgresStorage) UpdateBatch(metrics []models.Metrics) error {
+	_, err := ps.UpdateBatchReturning(metrics)
+	return err
+}
+
+// UpdateBatchReturning обновляет пакет как UpdateBatch и возвращает значения
+// метрик после записи (RETURNING тех же запросов).
+func (ps *PostgresStorage) UpdateBatchReturning(metrics []models.Metrics) ([]models.Metrics, error) {
 	if len(metrics) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	return retry.Execute(ctx, ps.retryConfig, func() error {
+	var committed []models.Metrics
+	err := retry.Execute(ctx, ps.retryConfig, func() error {
+		committed = make([]models.Metrics, 0, len(metrics))
+
 		// Начинаем транзакцию
 		tx, err := ps.db.BeginTx(ctx, nil)
 		if err != nil {
@@ -280,20 +484,22 @@ func (ps *PostgresStorage) UpdateBatch(metrics []models.Metrics) error {
 
 		// Подготавливаем запросы для batch операций
 		gaugeStmt, err := tx.PrepareContext(ctx, `
-			INSERT INTO metrics (name, type, value, updated_at) 
-			VALUES ($1, 'gauge', $2, CURRENT_TIMESTAMP)
-			ON CONFLICT (name, type) 
-			DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP`)
+			INSERT INTO metrics (tenant, name, type, value, updated_at) 
+			VALUES ($1, $2, 'gauge', $3, CURRENT_TIMESTAMP)
+			ON CONFLICT (tenant, name, type) 
+			DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP
+			RETURNING value`)
 		if err != nil {
 			return fmt.Errorf("failed to prepare gauge statement: %w", err)
 		}
 		defer gaugeStmt.Close()
 
 		counterStmt, err := tx.PrepareContext(ctx, `
-			INSERT INTO metrics (name, type, delta, updated_at) 
-			VALUES ($1, 'counter', $2, CURRENT_TIMESTAMP)
-			ON CONFLICT (name, type) 
-			DO UPDATE SET delta = metrics.delta + EXCLUDED.delta, updated_at = CURRENT_TIMESTAMP`)
+			INSERT INTO metrics (tenant, name, type, delta, updated_at) 
+			VALUES ($1, $2, 'counter', $3, CURRENT_TIMESTAMP)
+			ON CONFLICT (tenant, name, type) 
+			DO UPDATE SET delta = metrics.delta + EXCLUDED.delta, updated_at = CURRENT_TIMESTAMP
+			RETURNING delta`)
 		if err != nil {
 			return fmt.Errorf("failed to prepare counter statement: %w", err)
 		}
@@ -304,24 +510,29 @@ func (ps *PostgresStorage) UpdateBatch(metrics []models.Metrics) error {
 			switch metric.MType {
 			case "gauge":
 				if metric.Value == nil {
-					return fmt.Errorf("gauge metric %s missing value", metric.ID)
+					err = fmt.Errorf("gauge metric %s missing value", metric.ID)
+					return err
 				}
-				_, err = gaugeStmt.ExecContext(ctx, metric.ID, *metric.Value)
-				if err != nil {
+				var stored float64
+				if err = gaugeStmt.QueryRowContext(ctx, ps.tenant, metric.ID, *metric.Value).Scan(&stored); err != nil {
 					return fmt.Errorf("failed to update gauge metric %s: %w", metric.ID, err)
 				}
+				committed = append(committed, models.Metrics{ID: metric.ID, MType: models.Gauge, Value: &stored})
 
 			case "counter":
 				if metric.Delta == nil {
-					return fmt.Errorf("counter metric %s missing delta", metric.ID)
+					err = fmt.Errorf("counter metric %s missing delta", metric.ID)
+					return err
 				}
-				_, err = counterStmt.ExecContext(ctx, metric.ID, *metric.Delta)
-				if err != nil {
+				var total int64
+				if err = counterStmt.QueryRowContext(ctx, ps.tenant, metric.ID, *metric.Delta).Scan(&total); err != nil {
 					return fmt.Errorf("failed to update counter metric %s: %w", metric.ID, err)
 				}
+				committed = append(committed, models.Metrics{ID: metric.ID, MType: models.Counter, Delta: &total})
 
 			default:
-				return fmt.Errorf("unsupported metric type: %s", metric.MType)
+				err = fmt.Errorf("unsupported metric type: %s", metric.MType)
+				return err
 			}
 		}
 
@@ -336,4 +547,8 @@ func (ps *PostgresStorage) UpdateBatch(metrics []models.Metrics) error {
 
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return committed, nil
 }
@@ -10,6 +10,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/Mihklz/metrixcollector/internal/logger"
+	models "github.com/Mihklz/metrixcollector/internal/model"
 	_ "github.com/lib/pq"
 )
 
@@ -107,6 +108,99 @@ func TestPostgresStorage_Integration(t *testing.T) {
 		assert.Equal(t, Counter(200), counters["counter2"])
 	})
 
+	t.Run("ListWithFilters", func(t *testing.T) {
+		require.NoError(t, storage.Update("gauge", "list_a", "1"))
+		require.NoError(t, storage.Update("gauge", "list_b", "2"))
+		require.NoError(t, storage.Update("gauge", "list%c", "3"))
+
+		// Спецсимволы LIKE в префиксе экранируются
+		metrics, err := storage.List(ListQuery{Type: "gauge", Prefix: "list_", Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, metrics, 1)
+		assert.Equal(t, "list_a", metrics[0].ID)
+
+		metrics, err = storage.List(ListQuery{Type: "gauge", Prefix: "list_", After: &ListAfter{Type: "gauge", Name: "list_a"}})
+		require.NoError(t, err)
+		require.Len(t, metrics, 1)
+		assert.Equal(t, "list_b", metrics[0].ID)
+
+		deleted, err := storage.Delete("gauge", "list%c")
+		require.NoError(t, err)
+		assert.True(t, deleted)
+	})
+
+	t.Run("RegexMatchesMemStorage", func(t *testing.T) {
+		teamStorage := storage.ForTenant("regex-test").(*PostgresStorage)
+		mem := NewMemStorage()
+		for _, name := range []string{"req_a", "req_b1", "http.get", "Alloc", "alloc_total"} {
+			require.NoError(t, teamStorage.Update("gauge", name, "1"))
+			require.NoError(t, mem.Update("gauge", name, "1"))
+		}
+
+		// Конструкции, которые PostgreSQL понимает иначе или не понимает вовсе
+		for _, query := range []ListQuery{
+			{Regex: `(?P<kind>req)_\w+`},
+			{Regex: `_a\z`},
+			{Regex: `(?i)^alloc`},
+			{Regex: `[[:digit:]]$`},
+			{Regex: `\.`, Limit: 1},
+			{Prefix: "req_", Regex: `b`},
+		} {
+			fromPostgres, err := teamStorage.List(query)
+			require.NoError(t, err, query.Regex)
+			fromMemory, err := List(mem, query)
+			require.NoError(t, err, query.Regex)
+			assert.Equal(t, metricIDs(fromMemory), metricIDs(fromPostgres), query.Regex)
+		}
+
+		_, err := teamStorage.List(ListQuery{Regex: `(`})
+		assert.Error(t, err)
+	})
+
+	t.Run("Series", func(t *testing.T) {
+		teamStorage := storage.ForTenant("series-test").(*PostgresStorage)
+		require.NoError(t, teamStorage.Update("gauge", "series_gauge", "1"))
+		require.NoError(t, teamStorage.Update("counter", "series_counter", "1"))
+
+		count, err := teamStorage.SeriesCount()
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		// В общее число входят и ряды арендатора по умолчанию из предыдущих подтестов
+		total, err := teamStorage.TotalSeriesCount()
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, total, count+2)
+
+		existing, err := teamStorage.ExistingSeries([]SeriesKey{
+			{Type: "gauge", Name: "series_gauge"},
+			{Type: "counter", Name: "series_gauge"},
+			{Type: "counter", Name: "series_counter"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[SeriesKey]bool{
+			{Type: "gauge", Name: "series_gauge"}:     true,
+			{Type: "counter", Name: "series_counter"}: true,
+		}, existing)
+	})
+
+	t.Run("Returning", func(t *testing.T) {
+		teamStorage := storage.ForTenant("returning-test").(*PostgresStorage)
+
+		metric, err := teamStorage.UpdateReturning("counter", "returning_counter", "2")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), *metric.Delta)
+
+		one, gauge := int64(1), 1.5
+		committed, err := teamStorage.UpdateBatchReturning([]models.Metrics{
+			{ID: "returning_counter", MType: "counter", Delta: &one},
+			{ID: "returning_gauge", MType: "gauge", Value: &gauge},
+		})
+		require.NoError(t, err)
+		require.Len(t, committed, 2)
+		assert.Equal(t, int64(3), *committed[0].Delta)
+		assert.Equal(t, 1.5, *committed[1].Value)
+	})
+
 	t.Run("GetNonExistentMetric", func(t *testing.T) {
 		// Проверяем получение несуществующей gauge метрики
 		_, exists := storage.GetGauge("non_existent_gauge")
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
+)
+
+// ErrSeriesQuotaExceeded — запись создала бы у арендатора больше рядов метрик,
+// чем разрешено квотой.
+var ErrSeriesQuotaExceeded = errors.New("series quota exceeded")
+
+// seriesQuota — квота, общая для всех арендаторов хранилища
+type seriesQuota struct {
+	limit int
+
+	mu      sync.Mutex
+	tenants map[string]*tenantQuota
+}
+
+// tenantQuota — состояние квоты арендатора. Создание рядов и запись арендатора
+// идут под mu, под ним же читается и меняется число рядов.
+type tenantQuota struct {
+	mu      sync.Mutex
+	count   int  // число рядов арендатора
+	counted bool // count известен
+}
+
+// tenant возвращает состояние квоты арендатора
+func (q *seriesQuota) tenant(name string) *tenantQuota {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	state, ok := q.tenants[name]
+	if !ok {
+		state = &tenantQuota{}
+		q.tenants[name] = state
+	}
+	return state
+}
+
+// QuotaStorage ограничивает число рядов метрик (пар имя + тип) у каждого
+// арендатора. Обновление существующих рядов разрешено всегда, а запись,
+// создающая ряды сверх квоты, отклоняется целиком с ErrSeriesQuotaExceeded.
+//
+// Число рядов арендатора запрашивается у хранилища один раз и дальше ведётся
+// в памяти; при каждой записи хранилище только проверяет, какие ряды уже есть.
+// Ряды, созданные в обход обёртки (например, другим экземпляром сервера),
+// учитываются, когда запись упирается в квоту: тогда число рядов пересчитывается.
+type QuotaStorage struct {
+	Storage
+	quota  *seriesQuota
+	tenant string
+}
+
+// WithSeriesQuota оборачивает хранилище квотой limit рядов на арендатора.
+// При limit <= 0 хранилище возвращается без изменений.
+func WithSeriesQuota(storage Storage, limit int) Storage {
+	if limit <= 0 {
+		return storage
+	}
+	return &QuotaStorage{
+		Storage: storage,
+		quota: &seriesQuota{
+			limit:   limit,
+			tenants: make(map[string]*tenantQuota),
+		},
+		tenant: tenant.Default,
+	}
+}
+
+// ForTenant возвращает хранилище арендатора с той же квотой.
+func (q *QuotaStorage) ForTenant(name string) Storage {
+	return &QuotaStorage{
+		Storage: q.Storage.ForTenant(name),
+		quota:   q.quota,
+		tenant:  name,
+	}
+}
+
+// Update обновляет метрику, если это не превышает квоту.
+func (q *QuotaStorage) Update(metricType, name, value string) error {
+	return q.write([]models.Metrics{{ID: name, MType: metricType}}, func() error {
+		return q.Storage.Update(metricType, name, value)
+	})
+}
+
+// UpdateBatch обновляет пакет метрик, если новые ряды помещаются в квоту.
+func (q *QuotaStorage) UpdateBatch(metrics []models.Metrics) error {
+	return q.write(metrics, func() error {
+		return updateBatch(q.Storage, metrics)
+	})
+}
+
+// UpdateReturning обновляет метрику, если это не превышает квоту,
+// и возвращает её значение после записи.
+func (q *QuotaStorage) UpdateReturning(metricType, name, value string) (models.Metrics, error) {
+	var committed models.Metrics
+	err := q.write([]models.Metrics{{ID: name, MType: metricType}}, func() error {
+		var err error
+		committed, err = UpdateReturning(q.Storage, metricType, name, value)
+		return err
+	})
+	return committed, err
+}
+
+// UpdateBatchReturning обновляет пакет метрик, если новые ряды помещаются
+// в квоту, и возвращает их значения после записи.
+func (q *QuotaStorage) UpdateBatchReturning(metrics []models.Metrics) ([]models.Metrics, error) {
+	var committed []models.Metrics
+	err := q.write(metrics, func() error {
+		var err error
+		committed, err = UpdateBatchReturning(q.Storage, metrics)
+		return err
+	})
+	return committed, err
+}
+
+// Delete удаляет метрику, освобождая место в квоте.
+func (q *QuotaStorage) Delete(metricType, name string) (bool, error) {
+	state := q.quota.tenant(q.tenant)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	deleted, err := Delete(q.Storage, metricType, name)
+	if deleted && state.counted {
+		state.count--
+	}
+	return deleted, err
+}
+
+// List выбирает метрики средствами исходного хранилища.
+func (q *QuotaStorage) List(query ListQuery) ([]models.Metrics, error) {
+	return List(q.Storage, query)
+}
+
+// SeriesCount считает ряды средствами исходного хранилища.
+func (q *QuotaStorage) SeriesCount() (int, error) {
+	return SeriesCount(q.Storage)
+}
+
+// TotalSeriesCount считает ряды всех арендаторов средствами исходного хранилища.
+func (q *QuotaStorage) TotalSeriesCount() (int, error) {
+	return TotalSeriesCount(q.Storage)
+}
+
+// ExistingSeries проверяет ряды средствами исходного хранилища.
+func (q *QuotaStorage) ExistingSeries(keys []SeriesKey) (map[SeriesKey]bool, error) {
+	return ExistingSeries(q.Storage, keys)
+}
+
+// write выполняет запись metrics функцией update, если новые ряды помещаются
+// в квоту. Запись только существующих рядов не ждёт блокировки арендатора.
+func (q *QuotaStorage) write(metrics []models.Metrics, update func() error) error {
+	keys := seriesKeys(metrics)
+	existing, err := ExistingSeries(q.Storage, keys)
+	if err != nil {
+		return err
+	}
+	if len(existing) == len(keys) {
+		return update()
+	}
+
+	state := q.quota.tenant(q.tenant)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	// Пока ждали блокировку, часть рядов могли создать другие запросы
+	if existing, err = ExistingSeries(q.Storage, keys); err != nil {
+		return err
+	}
+	created := len(keys) - len(existing)
+	if created > 0 {
+		if err := q.reserve(state, created); err != nil {
+			return err
+		}
+	}
+
+	if err := update(); err != nil {
+		// Неизвестно, какие ряды успели появиться, — пересчитаем при следующей записи
+		state.counted = false
+		return err
+	}
+	state.count += created
+	return nil
+}
+
+// reserve проверяет, что created новых рядов помещаются в квоту
+// (вызывается под state.mu)
+func (q *QuotaStorage) reserve(state *tenantQuota, created int) error {
+	if !state.counted || state.count+created > q.quota.limit {
+		// Перед отказом уточняем число рядов: их могли удалить в обход обёртки
+		count, err := SeriesCount(q.Storage)
+		if err != nil {
+			return err
+		}
+		state.count, state.counted = count, true
+	}
+
+	if state.count+created > q.quota.limit {
+		return fmt.Errorf("%w: tenant %q is limited to %d series", ErrSeriesQuotaExceeded, q.tenant, q.quota.limit)
+	}
+	return nil
+}
+
+// updateBatch обновляет пакет метрик; хранилище без пакетных операций
+// обновляется по одной метрике
+func updateBatch(storage Storage, metrics []models.Metrics) error {
+	if batchStorage, ok := storage.(BatchStorage); ok {
+		return batchStorage.UpdateBatch(metrics)
+	}
+
+	for _, metric := range metrics {
+		value, err := metricValue(metric)
+		if err != nil {
+			return err
+		}
+		if err := storage.Update(metric.MType, metric.ID, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metricValue возвращает значение метрики в текстовом виде для Storage.Update
+func metricValue(metric models.Metrics) (string, error) {
+	switch {
+	case metric.MType == models.Counter && metric.Delta != nil:
+		return strconv.FormatInt(*metric.Delta, 10), nil
+	case metric.MType == models.Gauge && metric.Value != nil:
+		return strconv.FormatFloat(*metric.Value, 'g', -1, 64), nil
+	}
+	return "", fmt.Errorf("%s metric %s missing value", metric.MType, metric.ID)
+}
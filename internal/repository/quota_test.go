@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+func TestWithSeriesQuota(t *testing.T) {
+	storage := WithSeriesQuota(NewMemStorage(), 2)
+	teamA := storage.ForTenant("team-a")
+
+	require.NoError(t, teamA.Update(models.Gauge, "Alloc", "1"))
+	require.NoError(t, teamA.Update(models.Counter, "PollCount", "1"))
+
+	// Существующие ряды обновляются, новые сверх квоты — нет
+	require.NoError(t, teamA.Update(models.Counter, "PollCount", "1"))
+	err := teamA.Update(models.Gauge, "HeapAlloc", "1")
+	assert.ErrorIs(t, err, ErrSeriesQuotaExceeded)
+
+	// Квота у каждого арендатора своя
+	require.NoError(t, storage.Update(models.Gauge, "HeapAlloc", "1"))
+
+	// Пакет, выходящий за квоту, отклоняется целиком
+	value := 1.0
+	err = storage.(BatchStorage).UpdateBatch([]models.Metrics{
+		{ID: "Alloc", MType: models.Gauge, Value: &value},
+		{ID: "Frees", MType: models.Gauge, Value: &value},
+	})
+	assert.ErrorIs(t, err, ErrSeriesQuotaExceeded)
+	_, exists := storage.GetGauge("Alloc")
+	assert.False(t, exists)
+}
+
+func TestWithSeriesQuota_Disabled(t *testing.T) {
+	storage := NewMemStorage()
+	assert.Same(t, storage, WithSeriesQuota(storage, 0))
+}
+
+func TestQuotaStorage_DeleteFreesQuota(t *testing.T) {
+	storage := WithSeriesQuota(NewMemStorage(), 1)
+
+	require.NoError(t, storage.Update(models.Gauge, "Alloc", "1"))
+	assert.ErrorIs(t, storage.Update(models.Gauge, "HeapAlloc", "1"), ErrSeriesQuotaExceeded)
+
+	deleted, err := Delete(storage, models.Gauge, "Alloc")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	require.NoError(t, storage.Update(models.Gauge, "HeapAlloc", "1"))
+
+	// Удаление отсутствующей метрики — не ошибка
+	deleted, err = Delete(storage, models.Counter, "HeapAlloc")
+	require.NoError(t, err)
+	assert.False(t, deleted)
+}
+
+// scanCountingStorage считает полные чтения и подсчёты рядов хранилища
+type scanCountingStorage struct {
+	*MemStorage
+	scans  int
+	counts int
+}
+
+func (s *scanCountingStorage) GetAllGauges() map[string]Gauge {
+	s.scans++
+	return s.MemStorage.GetAllGauges()
+}
+
+func (s *scanCountingStorage) GetAllCounters() map[string]Counter {
+	s.scans++
+	return s.MemStorage.GetAllCounters()
+}
+
+func (s *scanCountingStorage) SeriesCount() (int, error) {
+	s.counts++
+	return s.MemStorage.SeriesCount()
+}
+
+func TestQuotaStorage_CountsSeriesOnce(t *testing.T) {
+	inner := &scanCountingStorage{MemStorage: NewMemStorage()}
+	storage := WithSeriesQuota(inner, 100)
+
+	value := 1.0
+	for i := 0; i < 10; i++ {
+		require.NoError(t, storage.Update(models.Gauge, fmt.Sprintf("Gauge%d", i), "1"))
+		require.NoError(t, storage.(BatchStorage).UpdateBatch([]models.Metrics{
+			{ID: fmt.Sprintf("Batch%d", i), MType: models.Gauge, Value: &value},
+		}))
+	}
+
+	assert.Zero(t, inner.scans)
+	assert.Equal(t, 1, inner.counts)
+}
+
+func TestQuotaStorage_RecountsBeforeRejecting(t *testing.T) {
+	inner := NewMemStorage()
+	storage := WithSeriesQuota(inner, 1)
+
+	require.NoError(t, storage.Update(models.Gauge, "Alloc", "1"))
+	assert.ErrorIs(t, storage.Update(models.Gauge, "HeapAlloc", "1"), ErrSeriesQuotaExceeded)
+
+	// Ряд удалён в обход квоты — место освобождается
+	_, err := inner.Delete(models.Gauge, "Alloc")
+	require.NoError(t, err)
+	require.NoError(t, storage.Update(models.Gauge, "HeapAlloc", "1"))
+}
+
+func TestQuotaStorage_ConcurrentTenants(t *testing.T) {
+	storage := WithSeriesQuota(NewMemStorage(), 50)
+
+	// Арендаторы создают и удаляют ряды одновременно (проверяется с -race)
+	var wg sync.WaitGroup
+	for _, name := range []string{"team-a", "team-b"} {
+		teamStorage := storage.ForTenant(name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				err := teamStorage.Update(models.Gauge, fmt.Sprintf("Gauge%d", i), "1")
+				if i < 50 {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorIs(t, err, ErrSeriesQuotaExceeded)
+				}
+			}
+			_, err := Delete(teamStorage, models.Gauge, "Gauge0")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	for _, name := range []string{"team-a", "team-b"} {
+		count, err := SeriesCount(storage.ForTenant(name))
+		require.NoError(t, err)
+		assert.Equal(t, 49, count)
+	}
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+// SeriesKey — ряд метрик: пара тип + имя.
+type SeriesKey struct {
+	Type string
+	Name string
+}
+
+// SeriesStorage расширяет Storage подсчётом рядов без чтения значений метрик.
+type SeriesStorage interface {
+	Storage
+	// SeriesCount возвращает число рядов метрик.
+	SeriesCount() (int, error)
+	// ExistingSeries возвращает те ряды из keys, которые уже есть в хранилище.
+	ExistingSeries(keys []SeriesKey) (map[SeriesKey]bool, error)
+}
+
+// SeriesCount возвращает число рядов метрик. Хранилища без SeriesStorage
+// считаются чтением всех метрик.
+func SeriesCount(storage Storage) (int, error) {
+	if seriesStorage, ok := storage.(SeriesStorage); ok {
+		return seriesStorage.SeriesCount()
+	}
+	return len(storage.GetAllGauges()) + len(storage.GetAllCounters()), nil
+}
+
+// TotalSeriesStorage расширяет Storage подсчётом рядов всех арендаторов.
+type TotalSeriesStorage interface {
+	Storage
+	// TotalSeriesCount возвращает число рядов метрик всех арендаторов.
+	TotalSeriesCount() (int, error)
+}
+
+// TotalSeriesCount возвращает число рядов метрик всех арендаторов.
+// Хранилища без TotalSeriesStorage считаются одним пространством имён.
+func TotalSeriesCount(storage Storage) (int, error) {
+	if totalStorage, ok := storage.(TotalSeriesStorage); ok {
+		return totalStorage.TotalSeriesCount()
+	}
+	return SeriesCount(storage)
+}
+
+// ExistingSeries возвращает те ряды из keys, которые уже есть в хранилище.
+// Хранилища без SeriesStorage проверяются чтением каждой метрики.
+func ExistingSeries(storage Storage, keys []SeriesKey) (map[SeriesKey]bool, error) {
+	if seriesStorage, ok := storage.(SeriesStorage); ok {
+		return seriesStorage.ExistingSeries(keys)
+	}
+
+	existing := make(map[SeriesKey]bool)
+	for _, key := range keys {
+		var exists bool
+		switch key.Type {
+		case models.Gauge:
+			_, exists = storage.GetGauge(key.Name)
+		case models.Counter:
+			_, exists = storage.GetCounter(key.Name)
+		}
+		if exists {
+			existing[key] = true
+		}
+	}
+	return existing, nil
+}
+
+// seriesKeys возвращает ряды метрик без повторов, пропуская неизвестные типы
+func seriesKeys(metrics []models.Metrics) []SeriesKey {
+	seen := make(map[SeriesKey]struct{}, len(metrics))
+	keys := make([]SeriesKey, 0, len(metrics))
+	for _, metric := range metrics {
+		if metric.MType != models.Gauge && metric.MType != models.Counter {
+			continue
+		}
+		key := SeriesKey{Type: metric.MType, Name: metric.ID}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -1,6 +1,10 @@
 package repository
 
-import models "github.com/Mihklz/metrixcollector/internal/model"
+import (
+	"errors"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
 
 // Storage описывает базовые операции хранилища метрик.
 type Storage interface {
@@ -12,6 +16,28 @@ type Storage interface {
 	// Новые методы для файлового хранения
 	SaveToFile(filename string) error
 	LoadFromFile(filename string) error
+	// ForTenant возвращает хранилище с метриками арендатора.
+	// Для tenant.Default возвращается само хранилище.
+	ForTenant(name string) Storage
+}
+
+// ErrDeleteUnsupported — хранилище не умеет удалять метрики.
+var ErrDeleteUnsupported = errors.New("storage does not support deleting metrics")
+
+// DeleteStorage расширяет Storage удалением метрик.
+type DeleteStorage interface {
+	Storage
+	// Delete удаляет метрику. Возвращает false, если метрики не было.
+	Delete(metricType, name string) (bool, error)
+}
+
+// Delete удаляет метрику из хранилища или возвращает ErrDeleteUnsupported.
+func Delete(storage Storage, metricType, name string) (bool, error) {
+	deleteStorage, ok := storage.(DeleteStorage)
+	if !ok {
+		return false, ErrDeleteUnsupported
+	}
+	return deleteStorage.Delete(metricType, name)
 }
 
 // BatchStorage расширяет Storage поддержкой пакетных операций.
@@ -20,3 +46,88 @@ type BatchStorage interface {
 	// UpdateBatch обновляет множество метрик в рамках одной транзакции
 	UpdateBatch(metrics []models.Metrics) error
 }
+
+// ReturningStorage расширяет Storage записью, которая сразу возвращает
+// значения метрик после записи: для counter — накопленную сумму.
+type ReturningStorage interface {
+	BatchStorage
+	// UpdateReturning обновляет метрику и возвращает её новое значение.
+	UpdateReturning(metricType, name, value string) (models.Metrics, error)
+	// UpdateBatchReturning обновляет пакет и возвращает новые значения
+	// метрик в порядке пакета.
+	UpdateBatchReturning(metrics []models.Metrics) ([]models.Metrics, error)
+}
+
+// UpdateReturning обновляет метрику и возвращает её значение после записи.
+// Хранилища без ReturningStorage перечитывают метрику после записи.
+func UpdateReturning(storage Storage, metricType, name, value string) (models.Metrics, error) {
+	if returningStorage, ok := storage.(ReturningStorage); ok {
+		return returningStorage.UpdateReturning(metricType, name, value)
+	}
+
+	if err := storage.Update(metricType, name, value); err != nil {
+		return models.Metrics{}, err
+	}
+	current, _ := readBack(storage, models.Metrics{ID: name, MType: metricType})
+	return current, nil
+}
+
+// UpdateBatchReturning обновляет пакет метрик и возвращает их значения после
+// записи в порядке пакета. Хранилища без ReturningStorage перечитывают метрики;
+// метрики, удалённые до перечитывания, возвращаются без значения.
+func UpdateBatchReturning(storage Storage, metrics []models.Metrics) ([]models.Metrics, error) {
+	if returningStorage, ok := storage.(ReturningStorage); ok {
+		return returningStorage.UpdateBatchReturning(metrics)
+	}
+
+	committed := make([]models.Metrics, 0, len(metrics))
+	if batchStorage, ok := storage.(BatchStorage); ok {
+		if err := batchStorage.UpdateBatch(metrics); err != nil {
+			return nil, err
+		}
+		for _, metric := range metrics {
+			current, _ := readBack(storage, metric)
+			committed = append(committed, current)
+		}
+		return committed, nil
+	}
+
+	// Хранилище без пакетных операций обновляем по одной метрике
+	for _, metric := range metrics {
+		value, err := metricValue(metric)
+		if err != nil {
+			return nil, err
+		}
+		current, err := UpdateReturning(storage, metric.MType, metric.ID, value)
+		if err != nil {
+			return nil, err
+		}
+		committed = append(committed, current)
+	}
+	return committed, nil
+}
+
+// readBack читает значение только что записанной метрики. Если метрики уже
+// нет, возвращает её без значения и false.
+func readBack(storage Storage, metric models.Metrics) (models.Metrics, bool) {
+	current := models.Metrics{ID: metric.ID, MType: metric.MType}
+	switch metric.MType {
+	case models.Gauge:
+		value, ok := storage.GetGauge(metric.ID)
+		if !ok {
+			return current, false
+		}
+		v := float64(value)
+		current.Value = &v
+	case models.Counter:
+		value, ok := storage.GetCounter(metric.ID)
+		if !ok {
+			return current, false
+		}
+		d := int64(value)
+		current.Delta = &d
+	default:
+		return current, false
+	}
+	return current, true
+}
@@ -61,9 +61,9 @@ func (c *DefaultErrorClassifier) Classify(err error) ErrorClassification {
 // isNetworkError проверяет, является ли ошибка сетевой (retriable)
 func isNetworkError(err error) bool {
 	var netErr net.Error
-	if errors.As(err, &netErr) {
+	if errors.As(err, &netErr) && netErr.Timeout() {
 		// Сетевые ошибки с таймаутом можно повторить
-		return netErr.Timeout()
+		return true
 	}
 
 	// Проверяем по тексту ошибки
@@ -3,6 +3,7 @@ package retry
 import (
 	"errors"
 	"net"
+	"net/url"
 	"testing"
 
 	"github.com/jackc/pgerrcode"
@@ -33,6 +34,13 @@ func TestDefaultErrorClassifier_Classify(t *testing.T) {
 			err:            errors.New("dial tcp 127.0.0.1:8080: connect: connection refused"),
 			expectedResult: Retriable,
 		},
+		{
+			name: "connection refused from http client",
+			err: &url.Error{Op: "Post", URL: "http://127.0.0.1:8080/updates/", Err: &net.OpError{
+				Op: "dial", Net: "tcp", Err: errors.New("connect: connection refused"),
+			}},
+			expectedResult: Retriable,
+		},
 		{
 			name:           "postgres connection exception",
 			err:            &pgconn.PgError{Code: pgerrcode.ConnectionException},
@@ -2,22 +2,33 @@ package server
 
 import (
 	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 
+	"github.com/Mihklz/metrixcollector/api"
+	"github.com/Mihklz/metrixcollector/internal/apierror"
 	"github.com/Mihklz/metrixcollector/internal/audit"
+	"github.com/Mihklz/metrixcollector/internal/auth"
 	"github.com/Mihklz/metrixcollector/internal/config"
+	"github.com/Mihklz/metrixcollector/internal/crypto"
 	"github.com/Mihklz/metrixcollector/internal/handler"
+	"github.com/Mihklz/metrixcollector/internal/idempotency"
 	"github.com/Mihklz/metrixcollector/internal/logger"
 	"github.com/Mihklz/metrixcollector/internal/middleware"
 	"github.com/Mihklz/metrixcollector/internal/repository"
 	"github.com/Mihklz/metrixcollector/internal/service"
+	"github.com/Mihklz/metrixcollector/internal/stream"
 )
 
 // Server представляет HTTP сервер для сбора метрик
@@ -30,10 +41,22 @@ type Server struct {
 	httpServer     *http.Server
 	router         *chi.Mux
 	auditPublisher *audit.AuditPublisher
+	privateKey     *rsa.PrivateKey       // ключ для расшифровки тел запросов (nil — без шифрования)
+	agentRegistry  *crypto.AgentRegistry // ключи агентов для проверки подписи (nil — без проверки)
+	keyring        *crypto.Keyring       // ключи HMAC (nil — без подписи)
+	trustedNets    []*net.IPNet          // подсети агентов, из которых принимаются обновления
+	tokens         auth.TokenStore       // токены API (nil — доступ без аутентификации)
+	idempotency    idempotency.Store     // результаты пакетов с Idempotency-Key (nil — без дедупликации)
+	stream         *stream.Hub           // подписчики потока обновлений /api/v1/stream
 }
 
 // NewServer создает новый экземпляр сервера
-func NewServer(cfg *config.ServerConfig, storage repository.Storage, fileService *service.FileStorageService, db repository.Database) *Server {
+func NewServer(cfg *config.ServerConfig, storage repository.Storage, fileService *service.FileStorageService, db repository.Database) (*Server, error) {
+	// Квота рядов проверяется при любой записи, в том числе мимо сервиса метрик
+	storage = repository.WithSeriesQuota(storage, cfg.TenantMaxSeries)
+	// Подписчики потока получают каждую запись, прошедшую квоту
+	hub := stream.NewHub(cfg.StreamBuffer, cfg.StreamMaxSubs)
+	storage = repository.WithUpdateListener(storage, hub)
 	metricsService := service.NewMetricsService(storage)
 
 	server := &Server{
@@ -43,15 +66,170 @@ func NewServer(cfg *config.ServerConfig, storage repository.Storage, fileService
 		metricsService: metricsService,
 		db:             db,
 		auditPublisher: audit.NewAuditPublisher(),
+		stream:         hub,
 	}
 
 	// Инициализируем систему аудита
 	server.setupAudit()
 
+	// Загружаем ключи
+	if err := server.setupKeys(); err != nil {
+		return nil, err
+	}
+
+	trustedNets, err := middleware.ParseSubnets(cfg.TrustedSubnets)
+	if err != nil {
+		return nil, err
+	}
+	server.trustedNets = trustedNets
+
+	if err := server.setupAuth(); err != nil {
+		return nil, err
+	}
+
+	if err := server.setupCardinality(); err != nil {
+		return nil, err
+	}
+
+	if err := server.setupValidation(); err != nil {
+		return nil, err
+	}
+
+	server.setupIdempotency()
+
 	server.setupRouter()
 	server.setupHTTPServer()
 
-	return server
+	return server, nil
+}
+
+// setupKeys загружает ключи сервера из файлов, указанных в конфигурации
+func (s *Server) setupKeys() error {
+	// Связка ключей HMAC: из файла или из одного ключа -k
+	if s.config.KeyringFile != "" {
+		keyring, err := crypto.LoadKeyring(s.config.KeyringFile)
+		if err != nil {
+			return fmt.Errorf("load keyring: %w", err)
+		}
+		if s.config.Key != "" {
+			logger.Log.Warn("Both keyring and key are configured, key is ignored")
+		}
+		s.keyring = keyring
+		logger.Log.Info("HMAC keyring loaded", zap.String("file", s.config.KeyringFile))
+	} else {
+		s.keyring = crypto.NewStaticKeyring(s.config.Key)
+	}
+
+	if s.config.CryptoKey != "" {
+		key, err := crypto.LoadPrivateKey(s.config.CryptoKey)
+		if err != nil {
+			return fmt.Errorf("load crypto key: %w", err)
+		}
+		s.privateKey = key
+		logger.Log.Info("Payload decryption enabled",
+			zap.String("key_fingerprint", crypto.KeyFingerprint(&key.PublicKey)),
+		)
+	}
+
+	if s.config.AgentKeysFile != "" {
+		registry, err := crypto.LoadAgentRegistry(s.config.AgentKeysFile)
+		if err != nil {
+			return fmt.Errorf("load agent keys: %w", err)
+		}
+		s.agentRegistry = registry
+		logger.Log.Info("Agent signature validation enabled",
+			zap.Int("agents", registry.Len()),
+			zap.Bool("required", s.config.RequireAgentSig),
+		)
+	} else if s.config.RequireAgentSig {
+		return errors.New("agent signatures are required but no agent keys file is configured")
+	}
+	return nil
+}
+
+// setupAuth настраивает хранилище токенов API: файл или таблица api_tokens
+func (s *Server) setupAuth() error {
+	switch {
+	case s.config.AuthTokensFile != "":
+		store, err := auth.LoadTokenFile(s.config.AuthTokensFile)
+		if err != nil {
+			return fmt.Errorf("load API tokens: %w", err)
+		}
+		s.tokens = store
+		logger.Log.Info("API token authentication enabled", zap.String("file", s.config.AuthTokensFile))
+	case s.config.AuthFromDB:
+		postgresStorage, isPostgres := s.postgresStorage()
+		if !isPostgres || postgresStorage.GetConnection() == nil {
+			return errors.New("API tokens from database require PostgreSQL storage")
+		}
+		s.tokens = auth.NewPostgresTokenStore(postgresStorage.GetConnection())
+		logger.Log.Info("API token authentication enabled", zap.String("source", "database"))
+	}
+	return nil
+}
+
+// setupCardinality включает лимиты числа рядов метрик
+func (s *Server) setupCardinality() error {
+	prefixLimits, err := service.ParsePrefixLimits(s.config.SeriesPrefixes)
+	if err != nil {
+		return err
+	}
+	policy, err := service.ParseCardinalityPolicy(s.config.SeriesPolicy)
+	if err != nil {
+		return err
+	}
+
+	limiter := service.NewCardinalityLimiter(service.CardinalityLimits{
+		MaxSeries:    s.config.SeriesLimit,
+		PrefixLimits: prefixLimits,
+		Policy:       policy,
+		SampleRate:   s.config.SeriesSample,
+	})
+	if limiter != nil {
+		logger.Log.Info("Series limits enabled",
+			zap.Int("max_series", s.config.SeriesLimit),
+			zap.Strings("prefix_limits", s.config.SeriesPrefixes),
+			zap.String("policy", string(policy)),
+		)
+	}
+	s.metricsService.SetCardinalityLimiter(limiter)
+	return nil
+}
+
+// setupValidation задаёт правила проверки метрик
+func (s *Server) setupValidation() error {
+	policy := service.DefaultValidationPolicy()
+	if s.config.NamePattern != "" {
+		pattern, err := regexp.Compile(s.config.NamePattern)
+		if err != nil {
+			return fmt.Errorf("invalid metric name pattern: %w", err)
+		}
+		policy.NamePattern = pattern
+	}
+	policy.MaxNameLength = s.config.MaxNameLength
+	policy.ReservedPrefixes = s.config.ReservedNames
+	policy.AllowNonFinite = s.config.AllowNonFinite
+	policy.MaxCounterDelta = s.config.MaxCounterDelta
+	policy.RejectNegative = s.config.RejectNegative
+
+	s.metricsService.SetValidationPolicy(policy)
+	return nil
+}
+
+// setupIdempotency выбирает хранилище ключей идемпотентности: таблица
+// idempotency_keys при работе с PostgreSQL, иначе память процесса
+func (s *Server) setupIdempotency() {
+	if s.config.IdempotencyTTL <= 0 {
+		return
+	}
+	window := time.Duration(s.config.IdempotencyTTL) * time.Second
+	if postgresStorage, isPostgres := s.postgresStorage(); isPostgres && postgresStorage.GetConnection() != nil {
+		s.idempotency = idempotency.NewPostgresStore(postgresStorage.GetConnection(), window)
+		logger.Log.Info("Batch deduplication enabled", zap.String("source", "database"), zap.Duration("window", window))
+		return
+	}
+	s.idempotency = idempotency.NewMemoryStore(window, s.config.IdempotencySize)
+	logger.Log.Info("Batch deduplication enabled", zap.String("source", "memory"), zap.Duration("window", window))
 }
 
 // setupAudit настраивает систему аудита на основе конфигурации
@@ -88,27 +266,68 @@ func (s *Server) setupRouter() {
 	r.Use(func(next http.Handler) http.Handler {
 		return logger.WithLogging(next)
 	})
-	r.Use(middleware.WithGzip)
-	r.Use(middleware.WithHashValidation(s.config.Key))
+	r.Use(middleware.WithJSONErrors("/api/"))
+	rateLimiter := s.rateLimiter()
+	r.Use(middleware.WithRateLimit(rateLimiter))
+	r.Use(middleware.WithBodyLimit(s.config.MaxBodySize))
+	r.Use(middleware.WithDecryption(s.privateKey))
+	r.Use(middleware.WithGzipLimit(s.config.MaxUnzippedSize))
+	r.Use(middleware.WithHashValidation(middleware.HashValidationOptions{
+		Keyring: s.keyring,
+		Strict:  s.config.StrictHash,
+		Exempt:  s.config.HashExempt,
+		Audit:   s.auditPublisher,
+	}))
+	r.Use(middleware.WithSignatureValidation(s.agentRegistry, s.config.RequireAgentSig))
+	r.Use(middleware.WithAgentRateLimit(rateLimiter))
+	replayWindow := time.Duration(s.config.ReplayWindow) * time.Second
+	r.Use(middleware.WithReplayProtection(replayWindow, middleware.NewNonceCache(2*replayWindow, s.config.ReplayCacheSize)))
+
+	r.Route("/api/v1", s.setupAPIv1)
+
+	// Эндпоинты ниже — прежний API, сохранённый для совместимости
+	// с агентами и скриптами. Новые возможности добавляются в /api/v1.
+
+	// === Эндпоинты обновления: только из доверенных подсетей и с ролью ingest ===
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.WithTrustedSubnet(s.trustedNets))
+		r.Use(middleware.WithRole(s.tokens, auth.RoleIngest))
+		r.Use(middleware.WithTenant)
+
+		// Старый URL-based эндпоинт (для совместимости)
+		r.Post("/update/{type}/{name}/{value}", handler.NewUpdateHandler(s.metricsService, s.auditPublisher))
+
+		// JSON API
+		r.Post("/update", handler.NewJSONUpdateHandler(s.metricsService, s.keyring, s.auditPublisher))
+		r.Post("/update/", handler.NewJSONUpdateHandler(s.metricsService, s.keyring, s.auditPublisher))
+
+		// Batch API
+		r.With(middleware.WithIdempotency(s.idempotency)).
+			Post("/updates/", handler.NewBatchUpdateHandler(s.metricsService, s.keyring, s.auditPublisher))
+	})
 
-	// === Старые URL-based эндпоинты (для совместимости) ===
-	r.Post("/update/{type}/{name}/{value}", handler.NewUpdateHandler(s.storage, s.auditPublisher))
-	r.Get("/value/{type}/{name}", handler.NewValueHandler(s.storage))
-	r.Get("/", handler.NewRootHandler(s.storage))
+	// === Эндпоинты чтения: роль read ===
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.WithRole(s.tokens, auth.RoleRead))
+		r.Use(middleware.WithTenant)
 
-	// === Новые JSON API эндпоинты ===
-	r.Post("/update", handler.NewJSONUpdateHandler(s.storage, s.config.Key, s.auditPublisher))
-	r.Post("/update/", handler.NewJSONUpdateHandler(s.storage, s.config.Key, s.auditPublisher))
-	r.Post("/value", handler.NewJSONValueHandler(s.storage, s.config.Key))
-	r.Post("/value/", handler.NewJSONValueHandler(s.storage, s.config.Key))
+		r.Get("/value/{type}/{name}", handler.NewValueHandler(s.storage))
+		r.Get("/", handler.NewRootHandler(s.storage))
+		r.Post("/value", handler.NewJSONValueHandler(s.storage, s.keyring))
+		r.Post("/value/", handler.NewJSONValueHandler(s.storage, s.keyring))
+	})
+
+	// === Административные эндпоинты: роль admin ===
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.WithRole(s.tokens, auth.RoleAdmin))
 
-	// === Batch API эндпоинт ===
-	r.Post("/updates/", handler.NewBatchUpdateHandler(s.metricsService, s.config.Key, s.auditPublisher))
+		r.Get("/series/top", handler.NewSeriesTopHandler(s.metricsService.CardinalityLimiter()))
+	})
 
 	// === Эндпоинт для проверки соединения с БД ===
 	// Если используется PostgreSQL хранилище, создаем новый Database объект для ping
 	var pingDB repository.Database = s.db
-	if postgresStorage, isPostgres := s.storage.(*repository.PostgresStorage); isPostgres {
+	if postgresStorage, isPostgres := s.postgresStorage(); isPostgres {
 		// Для PostgreSQL хранилища создаем Database объект из соединения
 		if conn := postgresStorage.GetConnection(); conn != nil {
 			pingDB = &repository.PostgresDB{DB: conn}
@@ -116,9 +335,75 @@ func (s *Server) setupRouter() {
 	}
 	r.Get("/ping", handler.NewPingHandler(pingDB))
 
+	// === Спецификация API ===
+	r.Get("/openapi.json", handler.NewOpenAPIHandler(api.OpenAPI))
+
 	s.router = r
 }
 
+// setupAPIv1 настраивает маршруты версии API v1. Все ошибки возвращаются
+// в формате apierror (см. middleware.WithJSONErrors).
+func (s *Server) setupAPIv1(r chi.Router) {
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		apierror.WriteStatus(w, http.StatusNotFound, "endpoint not found")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		apierror.WriteStatus(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
+
+	// Чтение: роль read
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.WithRole(s.tokens, auth.RoleRead))
+		r.Use(middleware.WithTenant)
+
+		r.Get("/metrics", handler.NewAPIListMetricsHandler(s.storage, s.keyring))
+		r.Get("/metrics/{type}/{name}", handler.NewAPIGetMetricHandler(s.storage, s.keyring))
+		r.Get("/stream", handler.NewAPIStreamHandler(s.stream))
+	})
+
+	// Запись: из доверенных подсетей и с ролью ingest
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.WithTrustedSubnet(s.trustedNets))
+		r.Use(middleware.WithRole(s.tokens, auth.RoleIngest))
+		r.Use(middleware.WithTenant)
+
+		r.Put("/metrics/{type}/{name}", handler.NewAPIUpdateMetricHandler(s.metricsService, s.keyring, s.auditPublisher))
+	})
+
+	// Удаление: роль admin
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.WithRole(s.tokens, auth.RoleAdmin))
+		r.Use(middleware.WithTenant)
+
+		r.Delete("/metrics/{type}/{name}", handler.NewAPIDeleteMetricHandler(s.storage))
+	})
+}
+
+// rateLimiter создаёт ограничитель частоты запросов (nil — без ограничения)
+func (s *Server) rateLimiter() *middleware.RateLimiter {
+	if s.config.RateLimitRPS <= 0 {
+		return nil
+	}
+	logger.Log.Info("Rate limiting enabled",
+		zap.Float64("rps", s.config.RateLimitRPS),
+		zap.Int("burst", s.config.RateLimitBurst),
+	)
+	return middleware.NewRateLimiter(s.config.RateLimitRPS, s.config.RateLimitBurst)
+}
+
+// postgresStorage возвращает хранилище PostgreSQL, если сервер работает с ним
+func (s *Server) postgresStorage() (*repository.PostgresStorage, bool) {
+	storage := s.storage
+	if notify, ok := storage.(*repository.NotifyStorage); ok {
+		storage = notify.Storage
+	}
+	if quota, ok := storage.(*repository.QuotaStorage); ok {
+		storage = quota.Storage
+	}
+	postgresStorage, ok := storage.(*repository.PostgresStorage)
+	return postgresStorage, ok
+}
+
 // setupHTTPServer настраивает HTTP сервер
 func (s *Server) setupHTTPServer() {
 	s.httpServer = &http.Server{
@@ -138,6 +423,15 @@ func (s *Server) Run() error {
 		go s.fileService.StartPeriodicSave(ctx)
 	}
 
+	// Настраиваем TLS, если указан сертификат сервера
+	if s.config.TLSCertFile != "" {
+		tlsConfig, err := crypto.NewServerTLSConfig(s.config.TLSCertFile, s.config.TLSKeyFile, s.config.TLSClientCAFile)
+		if err != nil {
+			return fmt.Errorf("configure TLS: %w", err)
+		}
+		s.httpServer.TLSConfig = tlsConfig
+	}
+
 	// Канал для получения сигналов ОС
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -149,9 +443,11 @@ func (s *Server) Run() error {
 			zap.Int("store_interval", s.config.StoreInterval),
 			zap.String("file_storage_path", s.config.FileStoragePath),
 			zap.Bool("restore", s.config.Restore),
+			zap.Bool("tls", s.httpServer.TLSConfig != nil),
+			zap.Bool("mtls", s.config.TLSClientCAFile != ""),
 		)
 
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := s.listenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Log.Fatal("Server failed to start",
 				zap.Error(err),
 				zap.String("address", s.config.RunAddr),
@@ -166,6 +462,15 @@ func (s *Server) Run() error {
 	return s.Shutdown(ctx)
 }
 
+// listenAndServe запускает HTTP или HTTPS сервер в зависимости от конфигурации.
+// Сертификаты уже загружены в TLSConfig, поэтому пути к файлам не передаются.
+func (s *Server) listenAndServe() error {
+	if s.httpServer.TLSConfig != nil {
+		return s.httpServer.ListenAndServeTLS("", "")
+	}
+	return s.httpServer.ListenAndServe()
+}
+
 // Shutdown выполняет graceful shutdown сервера
 func (s *Server) Shutdown(ctx context.Context) error {
 	// Завершаем периодическое сохранение
@@ -178,6 +483,9 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		logger.Log.Info("Metrics saved successfully on shutdown")
 	}
 
+	// Закрываем потоки обновлений: иначе Shutdown ждал бы отключения подписчиков
+	s.stream.Close()
+
 	// Graceful shutdown HTTP сервера
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer shutdownCancel()
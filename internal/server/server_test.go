@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/api"
+	"github.com/Mihklz/metrixcollector/internal/config"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	"github.com/Mihklz/metrixcollector/internal/repository"
+)
+
+func init() {
+	logger.Log = zap.NewNop()
+}
+
+// TestRoutesAreDocumented проверяет, что спецификация api/openapi.json
+// описывает каждый маршрут сервера и не описывает лишних
+func TestRoutesAreDocumented(t *testing.T) {
+	s, err := NewServer(&config.ServerConfig{SeriesPolicy: "reject"}, repository.NewMemStorage(), nil, nil)
+	require.NoError(t, err)
+
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(api.OpenAPI, &spec))
+	assert.True(t, strings.HasPrefix(spec.OpenAPI, "3."))
+
+	routes := make(map[string]struct{})
+	err = chi.Walk(s.router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		operation := strings.ToLower(method) + " " + route
+		routes[operation] = struct{}{}
+		_, documented := spec.Paths[route][strings.ToLower(method)]
+		assert.True(t, documented, "route %s is missing in api/openapi.json", operation)
+		return nil
+	})
+	require.NoError(t, err)
+
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			_, exists := routes[method+" "+path]
+			assert.True(t, exists, "api/openapi.json documents unknown route %s %s", method, path)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/repository"
+)
+
+// CardinalityPolicy определяет, что делать с новыми рядами сверх лимита.
+type CardinalityPolicy string
+
+const (
+	// CardinalityReject — отклонять пакет с ошибкой SeriesLimitError
+	CardinalityReject CardinalityPolicy = "reject"
+	// CardinalitySample — принимать только долю новых рядов, остальные отбрасывать
+	CardinalitySample CardinalityPolicy = "sample"
+)
+
+// ParseCardinalityPolicy разбирает название политики.
+func ParseCardinalityPolicy(value string) (CardinalityPolicy, error) {
+	switch policy := CardinalityPolicy(value); policy {
+	case CardinalityReject, CardinalitySample:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown series limit policy %q", value)
+	}
+}
+
+// CardinalityLimits — лимиты числа рядов (пар имя + тип). Общий лимит
+// действует на весь сервер, лимиты префиксов — в пространстве имён арендатора.
+type CardinalityLimits struct {
+	MaxSeries    int            // всего рядов у всех арендаторов (0 — без ограничения)
+	PrefixLimits map[string]int // рядов арендатора с именем, начинающимся с префикса
+	Policy       CardinalityPolicy
+	SampleRate   float64 // доля новых рядов, принимаемых сверх лимита в режиме sample
+}
+
+// Enabled сообщает, что задан хотя бы один лимит.
+func (l CardinalityLimits) Enabled() bool {
+	return l.MaxSeries > 0 || len(l.PrefixLimits) > 0
+}
+
+// SeriesLimitError — пакет создал бы ряды сверх лимита.
+type SeriesLimitError struct {
+	Prefix string   // префикс, лимит которого превышен (пусто — общий лимит)
+	Limit  int      // значение лимита
+	Series []string // метрики, для которых не нашлось места
+}
+
+// Error возвращает текст ошибки с перечнем отклонённых метрик.
+func (e *SeriesLimitError) Error() string {
+	scope := "series limit"
+	if e.Prefix != "" {
+		scope = fmt.Sprintf("series limit for prefix %q", e.Prefix)
+	}
+	return fmt.Sprintf("%s of %d reached, new series rejected: %s", scope, e.Limit, strings.Join(e.Series, ", "))
+}
+
+// ErrSeriesSampled — новый ряд сверх лимита не попал в выборку политики
+// sample и не сохранён.
+var ErrSeriesSampled = errors.New("new series dropped by sampling past the series limit")
+
+// IsSeriesLimitError проверяет, является ли ошибка превышением лимита рядов.
+func IsSeriesLimitError(err error) bool {
+	var limitErr *SeriesLimitError
+	return errors.As(err, &limitErr)
+}
+
+// SeriesStats — сколько новых рядов создал клиент или префикс с запуска сервера.
+type SeriesStats struct {
+	Name     string `json:"name"`
+	Created  int    `json:"created"`
+	Rejected int    `json:"rejected"`
+}
+
+// SeriesTop — клиенты и префиксы, создавшие больше всего рядов.
+type SeriesTop struct {
+	Clients  []SeriesStats `json:"clients"`
+	Prefixes []SeriesStats `json:"prefixes"`
+}
+
+// maxTrackedNames — сколько клиентов и префиксов учитывается по отдельности,
+// остальные попадают в строку otherSeries
+const (
+	maxTrackedNames = 10000
+	otherSeries     = "(other)"
+)
+
+// cardinalityRecountInterval — как часто число рядов можно пересчитать
+// по хранилищу перед отказом: ряды могли удалить в обход ограничителя
+const cardinalityRecountInterval = time.Minute
+
+// allTenants — ключ числа рядов всего сервера в CardinalityLimiter.counts
+// (имя арендатора не может быть таким, см. tenant.Validate)
+const allTenants = "*"
+
+// seriesCounts — число рядов: всего сервера (total) или арендатора
+// по префиксам с лимитами (perPrefix)
+type seriesCounts struct {
+	total     int
+	perPrefix map[string]int
+	countedAt time.Time
+}
+
+// CardinalityLimiter проверяет лимиты рядов и ведёт статистику создания рядов.
+//
+// Ряды считаются по хранилищу один раз, дальше число ведётся в памяти
+// по созданным рядам; при каждой записи хранилище только проверяет,
+// какие ряды уже есть. Проверка и запись не атомарны: при одновременных
+// пакетах лимит может быть превышен на размер этих пакетов.
+type CardinalityLimiter struct {
+	limits   CardinalityLimits
+	prefixes []string // префиксы с лимитами, от длинных к коротким
+	now      func() time.Time
+
+	mu       sync.Mutex
+	clients  map[string]*SeriesStats
+	byPrefix map[string]*SeriesStats
+	counts   map[string]*seriesCounts // по арендаторам и allTenants
+}
+
+// NewCardinalityLimiter создаёт ограничитель. Если лимиты не заданы, возвращает nil.
+func NewCardinalityLimiter(limits CardinalityLimits) *CardinalityLimiter {
+	if !limits.Enabled() {
+		return nil
+	}
+	if limits.Policy == "" {
+		limits.Policy = CardinalityReject
+	}
+
+	prefixes := make([]string, 0, len(limits.PrefixLimits))
+	for prefix := range limits.PrefixLimits {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	return &CardinalityLimiter{
+		limits:   limits,
+		prefixes: prefixes,
+		now:      time.Now,
+		clients:  make(map[string]*SeriesStats),
+		byPrefix: make(map[string]*SeriesStats),
+		counts:   make(map[string]*seriesCounts),
+	}
+}
+
+// admission — результат проверки пакета
+type admission struct {
+	accepted []models.Metrics
+	created  []string // имена новых рядов среди accepted
+	rejected []int    // индексы метрик, отклонённых в режиме reject
+	sampled  []int    // индексы метрик, отброшенных выборкой в режиме sample
+	limitErr *SeriesLimitError
+}
+
+// admit отбирает метрики пакета, которые можно записать в storage арендатора.
+// В режиме reject пакет с рядами сверх лимита отклоняется целиком,
+// а при partial отклоняются только эти ряды (см. admission.rejected).
+func (l *CardinalityLimiter) admit(storage repository.Storage, tenant, client string, metrics []models.Metrics, partial bool) (admission, error) {
+	if l == nil {
+		return admission{accepted: metrics}, nil
+	}
+
+	keys := make([]repository.SeriesKey, 0, len(metrics))
+	for _, metric := range metrics {
+		keys = append(keys, repository.SeriesKey{Type: metric.MType, Name: metric.ID})
+	}
+	existing, err := repository.ExistingSeries(storage, keys)
+	if err != nil {
+		return admission{}, fmt.Errorf("check existing series: %w", err)
+	}
+
+	total, perPrefix, err := l.seriesCounts(storage, tenant, false)
+	if err != nil {
+		return admission{}, err
+	}
+	result := l.choose(metrics, existing, total, perPrefix)
+
+	// Перед отказом уточняем число рядов, но не чаще cardinalityRecountInterval
+	if len(result.dropped) > 0 {
+		if total, perPrefix, err = l.seriesCounts(storage, tenant, true); err != nil {
+			return admission{}, err
+		}
+		result = l.choose(metrics, existing, total, perPrefix)
+	}
+
+	if len(result.dropped) > 0 {
+		l.record(client, result.dropped, func(s *SeriesStats) { s.Rejected++ })
+		if l.limits.Policy == CardinalityReject {
+			result.limitErr.Series = result.dropped
+			if !partial {
+				return admission{}, result.limitErr
+			}
+		} else {
+			result.limitErr = nil
+		}
+	}
+	return result.admission, nil
+}
+
+// selection — решение по пакету при заданном числе рядов
+type selection struct {
+	admission
+	dropped []string // новые ряды, не поместившиеся в лимит
+}
+
+// choose решает, какие метрики пакета принять, если у сервера уже total
+// рядов, а у арендатора по префиксам — perPrefix
+func (l *CardinalityLimiter) choose(metrics []models.Metrics, existing map[repository.SeriesKey]bool, total int, perPrefix map[string]int) selection {
+	result := selection{admission: admission{accepted: make([]models.Metrics, 0, len(metrics))}}
+	created := make(map[string]int, len(l.prefixes))
+	seen := make(map[repository.SeriesKey]struct{})
+
+	for i, metric := range metrics {
+		key := repository.SeriesKey{Type: metric.MType, Name: metric.ID}
+		_, repeated := seen[key]
+		if existing[key] || repeated {
+			result.accepted = append(result.accepted, metric)
+			continue
+		}
+
+		prefix := l.limitPrefix(metric.ID)
+		exceeded := l.exceeded(total, prefix, perPrefix[prefix]+created[prefix])
+		if exceeded != nil && !(l.limits.Policy == CardinalitySample && l.sampled(key.Type+"/"+key.Name)) {
+			result.dropped = append(result.dropped, metric.ID)
+			if l.limits.Policy == CardinalityReject {
+				result.rejected = append(result.rejected, i)
+			} else {
+				result.sampled = append(result.sampled, i)
+			}
+			if result.limitErr == nil {
+				result.limitErr = exceeded
+			}
+			continue
+		}
+
+		seen[key] = struct{}{}
+		total++
+		created[prefix]++
+		result.accepted = append(result.accepted, metric)
+		result.created = append(result.created, metric.ID)
+	}
+	return result
+}
+
+// seriesCounts возвращает число рядов всех арендаторов и число рядов
+// арендатора по префиксам с лимитами. Ряды считаются по хранилищу при первом
+// обращении и, если recount, — когда с прошлого подсчёта прошло не меньше
+// cardinalityRecountInterval.
+func (l *CardinalityLimiter) seriesCounts(storage repository.Storage, tenant string, recount bool) (int, map[string]int, error) {
+	var total int
+	if l.limits.MaxSeries > 0 {
+		all, err := l.cachedCounts(allTenants, recount, func() (*seriesCounts, error) {
+			total, err := repository.TotalSeriesCount(storage)
+			if err != nil {
+				return nil, fmt.Errorf("count series: %w", err)
+			}
+			return &seriesCounts{total: total}, nil
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+		total = all.total
+	}
+
+	var perPrefix map[string]int
+	if len(l.prefixes) > 0 {
+		// Для лимитов префиксов нужны имена всех рядов арендатора
+		own, err := l.cachedCounts(tenant, recount, func() (*seriesCounts, error) {
+			counts := &seriesCounts{perPrefix: make(map[string]int, len(l.prefixes))}
+			for name := range storage.GetAllGauges() {
+				counts.perPrefix[l.limitPrefix(name)]++
+			}
+			for name := range storage.GetAllCounters() {
+				counts.perPrefix[l.limitPrefix(name)]++
+			}
+			return counts, nil
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+		perPrefix = own.perPrefix
+	}
+	return total, perPrefix, nil
+}
+
+// cachedCounts возвращает копию подсчёта по ключу, при необходимости
+// пересчитывая его функцией count
+func (l *CardinalityLimiter) cachedCounts(key string, recount bool, count func() (*seriesCounts, error)) (seriesCounts, error) {
+	l.mu.Lock()
+	counts, ok := l.counts[key]
+	if ok && (!recount || l.now().Sub(counts.countedAt) < cardinalityRecountInterval) {
+		result := seriesCounts{total: counts.total, perPrefix: maps.Clone(counts.perPrefix)}
+		l.mu.Unlock()
+		return result, nil
+	}
+	l.mu.Unlock()
+
+	counts, err := count()
+	if err != nil {
+		return seriesCounts{}, err
+	}
+	counts.countedAt = l.now()
+
+	l.mu.Lock()
+	// Не даём карте расти бесконечно: сверх лимита арендаторы пересчитываются
+	if _, ok := l.counts[key]; ok || len(l.counts) < maxTrackedNames {
+		l.counts[key] = counts
+	}
+	l.mu.Unlock()
+	return seriesCounts{total: counts.total, perPrefix: maps.Clone(counts.perPrefix)}, nil
+}
+
+// exceeded проверяет, превышает ли ещё один ряд общий лимит или лимит префикса
+func (l *CardinalityLimiter) exceeded(total int, prefix string, prefixCount int) *SeriesLimitError {
+	if l.limits.MaxSeries > 0 && total >= l.limits.MaxSeries {
+		return &SeriesLimitError{Limit: l.limits.MaxSeries}
+	}
+	if limit, ok := l.limits.PrefixLimits[prefix]; ok && prefix != "" && prefixCount >= limit {
+		return &SeriesLimitError{Prefix: prefix, Limit: limit}
+	}
+	return nil
+}
+
+// sampled детерминированно выбирает долю рядов: один и тот же ряд
+// либо всегда принимается, либо всегда отбрасывается
+func (l *CardinalityLimiter) sampled(key string) bool {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return float64(h.Sum32()%10000) < l.limits.SampleRate*10000
+}
+
+// limitPrefix возвращает самый длинный префикс с лимитом, с которого начинается имя
+func (l *CardinalityLimiter) limitPrefix(name string) string {
+	for _, prefix := range l.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// statsPrefix возвращает префикс имени для статистики: префикс с лимитом
+// или часть имени до первого разделителя
+func (l *CardinalityLimiter) statsPrefix(name string) string {
+	if prefix := l.limitPrefix(name); prefix != "" {
+		return prefix
+	}
+	if i := strings.IndexAny(name, "._:/"); i > 0 {
+		return name[:i+1]
+	}
+	return name
+}
+
+// recordCreated учитывает ряды, созданные клиентом у арендатора
+func (l *CardinalityLimiter) recordCreated(tenant, client string, created []string) {
+	if l == nil || len(created) == 0 {
+		return
+	}
+	l.record(client, created, func(s *SeriesStats) { s.Created++ })
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if counts, ok := l.counts[allTenants]; ok {
+		counts.total += len(created)
+	}
+	if counts, ok := l.counts[tenant]; ok {
+		for _, name := range created {
+			counts.perPrefix[l.limitPrefix(name)]++
+		}
+	}
+}
+
+// record применяет update к статистике клиента и префиксов рядов
+func (l *CardinalityLimiter) record(client string, series []string, update func(*SeriesStats)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, name := range series {
+		update(trackedStats(l.clients, client))
+		update(trackedStats(l.byPrefix, l.statsPrefix(name)))
+	}
+}
+
+// trackedStats возвращает статистику по имени, не давая карте расти бесконечно
+func trackedStats(stats map[string]*SeriesStats, name string) *SeriesStats {
+	if s, ok := stats[name]; ok {
+		return s
+	}
+	if len(stats) >= maxTrackedNames {
+		name = otherSeries
+		if s, ok := stats[name]; ok {
+			return s
+		}
+	}
+	s := &SeriesStats{Name: name}
+	stats[name] = s
+	return s
+}
+
+// Top возвращает n клиентов и префиксов, создавших больше всего рядов.
+func (l *CardinalityLimiter) Top(n int) SeriesTop {
+	if l == nil {
+		return SeriesTop{Clients: []SeriesStats{}, Prefixes: []SeriesStats{}}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return SeriesTop{
+		Clients:  topStats(l.clients, n),
+		Prefixes: topStats(l.byPrefix, n),
+	}
+}
+
+// topStats сортирует статистику по числу созданных, затем отклонённых рядов
+func topStats(stats map[string]*SeriesStats, n int) []SeriesStats {
+	result := make([]SeriesStats, 0, len(stats))
+	for _, s := range stats {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Created != result[j].Created {
+			return result[i].Created > result[j].Created
+		}
+		if result[i].Rejected != result[j].Rejected {
+			return result[i].Rejected > result[j].Rejected
+		}
+		return result[i].Name < result[j].Name
+	})
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// ParsePrefixLimits разбирает лимиты префиксов вида "http_=1000".
+func ParsePrefixLimits(values []string) (map[string]int, error) {
+	limits := make(map[string]int, len(values))
+	for _, value := range values {
+		prefix, limit, ok := strings.Cut(value, "=")
+		prefix = strings.TrimSpace(prefix)
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if !ok || prefix == "" || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid series prefix limit %q, expected prefix=limit", value)
+		}
+		limits[prefix] = n
+	}
+	return limits, nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/repository"
+)
+
+func init() {
+	logger.Log = zap.NewNop()
+}
+
+func gauges(names ...string) []models.Metrics {
+	metrics := make([]models.Metrics, 0, len(names))
+	for _, name := range names {
+		v := 1.0
+		metrics = append(metrics, models.Metrics{ID: name, MType: models.Gauge, Value: &v})
+	}
+	return metrics
+}
+
+func TestCardinalityLimiter_Reject(t *testing.T) {
+	storage := repository.NewMemStorage()
+	svc := NewMetricsService(storage)
+	svc.SetCardinalityLimiter(NewCardinalityLimiter(CardinalityLimits{
+		MaxSeries:    4,
+		PrefixLimits: map[string]int{"req_": 2},
+	}))
+	agent := svc.ForClient("agent-1")
+
+	require.NoError(t, agent.UpdateBatch(gauges("Alloc", "req_1", "req_2")))
+
+	// Лимит префикса: пакет отклоняется целиком с перечнем новых рядов
+	err := agent.UpdateBatch(gauges("Alloc", "req_3"))
+	var limitErr *SeriesLimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, "req_", limitErr.Prefix)
+	assert.Equal(t, []string{"req_3"}, limitErr.Series)
+	_, exists := storage.GetGauge("req_3")
+	assert.False(t, exists)
+
+	// Существующие ряды обновляются и сверх лимита
+	require.NoError(t, agent.UpdateBatch(gauges("req_1", "HeapAlloc")))
+
+	// Общий лимит
+	err = svc.ForClient("agent-2").UpdateBatch(gauges("Frees"))
+	require.ErrorAs(t, err, &limitErr)
+	assert.Empty(t, limitErr.Prefix)
+	assert.Equal(t, 4, limitErr.Limit)
+
+	top := svc.CardinalityLimiter().Top(10)
+	assert.Equal(t, []SeriesStats{
+		{Name: "agent-1", Created: 4, Rejected: 1},
+		{Name: "agent-2", Rejected: 1},
+	}, top.Clients)
+	assert.Equal(t, SeriesStats{Name: "req_", Created: 2, Rejected: 1}, top.Prefixes[0])
+}
+
+func TestCardinalityLimiter_Sample(t *testing.T) {
+	storage := repository.NewMemStorage()
+	svc := NewMetricsService(storage)
+	svc.SetCardinalityLimiter(NewCardinalityLimiter(CardinalityLimits{
+		MaxSeries:  1,
+		Policy:     CardinalitySample,
+		SampleRate: 0.1,
+	}))
+
+	names := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		names = append(names, fmt.Sprintf("request_%d", i))
+	}
+	require.NoError(t, svc.UpdateBatch(gauges(names...)))
+
+	// Принимается примерно десятая часть рядов сверх лимита
+	stored := len(storage.GetAllGauges())
+	assert.InDelta(t, 100, stored, 40)
+
+	// Выбор детерминирован: повтор пакета не добавляет рядов
+	require.NoError(t, svc.UpdateBatch(gauges(names...)))
+	assert.Equal(t, stored, len(storage.GetAllGauges()))
+}
+
+// scanCountingStorage считает полные чтения хранилища
+type scanCountingStorage struct {
+	*repository.MemStorage
+	scans int
+}
+
+func (s *scanCountingStorage) GetAllGauges() map[string]repository.Gauge {
+	s.scans++
+	return s.MemStorage.GetAllGauges()
+}
+
+func (s *scanCountingStorage) GetAllCounters() map[string]repository.Counter {
+	s.scans++
+	return s.MemStorage.GetAllCounters()
+}
+
+func TestCardinalityLimiter_CountsSeriesOnce(t *testing.T) {
+	storage := &scanCountingStorage{MemStorage: repository.NewMemStorage()}
+	svc := NewMetricsService(storage)
+	svc.SetCardinalityLimiter(NewCardinalityLimiter(CardinalityLimits{
+		MaxSeries:    100,
+		PrefixLimits: map[string]int{"req_": 50},
+	}))
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, svc.UpdateBatch(gauges(fmt.Sprintf("req_%d", i), "Alloc")))
+		require.NoError(t, svc.UpdateSingle(gauges(fmt.Sprintf("single_%d", i))[0]))
+	}
+	_, err := svc.UpdateBatchPartial(gauges("req_x", "Alloc"))
+	require.NoError(t, err)
+
+	// Ряды посчитаны по хранилищу один раз, дальше счёт ведёт ограничитель
+	assert.Equal(t, 2, storage.scans)
+	assert.Len(t, storage.GetAllGauges(), 22)
+}
+
+func TestCardinalityLimiter_RecountsBeforeRejecting(t *testing.T) {
+	storage := repository.NewMemStorage()
+	svc := NewMetricsService(storage)
+	limiter := NewCardinalityLimiter(CardinalityLimits{MaxSeries: 1})
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	svc.SetCardinalityLimiter(limiter)
+
+	require.NoError(t, svc.UpdateBatch(gauges("Alloc")))
+	assert.True(t, IsSeriesLimitError(svc.UpdateBatch(gauges("HeapAlloc"))))
+
+	// Ряд удалён мимо сервиса: до пересчёта место не освобождается
+	_, err := storage.Delete(models.Gauge, "Alloc")
+	require.NoError(t, err)
+	assert.True(t, IsSeriesLimitError(svc.UpdateBatch(gauges("HeapAlloc"))))
+
+	now = now.Add(cardinalityRecountInterval)
+	require.NoError(t, svc.UpdateBatch(gauges("HeapAlloc")))
+}
+
+func TestCardinalityLimiter_CountsAllTenants(t *testing.T) {
+	storage := repository.WithSeriesQuota(repository.NewMemStorage(), 10)
+	svc := NewMetricsService(storage)
+	svc.SetCardinalityLimiter(NewCardinalityLimiter(CardinalityLimits{MaxSeries: 5}))
+
+	// Смена арендатора не обходит общий лимит сервера
+	var err error
+	for i := 0; i < 10 && err == nil; i++ {
+		err = svc.ForTenant(fmt.Sprintf("team-%d", i)).UpdateBatch(gauges("Alloc"))
+	}
+	assert.True(t, IsSeriesLimitError(err))
+
+	total, err := repository.TotalSeriesCount(storage)
+	require.NoError(t, err)
+	assert.Equal(t, 5, total)
+
+	// Существующие ряды по-прежнему обновляются
+	require.NoError(t, svc.ForTenant("team-0").UpdateBatch(gauges("Alloc")))
+}
+
+func TestParsePrefixLimits(t *testing.T) {
+	limits, err := ParsePrefixLimits([]string{"http_=1000", " db. = 5"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"http_": 1000, "db.": 5}, limits)
+
+	for _, value := range []string{"http_", "=5", "http_=many", "http_=-1"} {
+		_, err := ParsePrefixLimits([]string{value})
+		assert.Error(t, err, value)
+	}
+}
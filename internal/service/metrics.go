@@ -8,12 +8,17 @@ import (
 	"github.com/Mihklz/metrixcollector/internal/logger"
 	models "github.com/Mihklz/metrixcollector/internal/model"
 	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
 )
 
 // MetricsService отвечает за бизнес-логику работы с метриками.
 type MetricsService struct {
 	storage repository.Storage
 	logger  *zap.Logger
+	limiter *CardinalityLimiter // лимиты рядов (nil — без ограничений)
+	tenant  string              // арендатор, с метриками которого работает сервис
+	client  string              // клиент, от имени которого идёт запись
+	policy  ValidationPolicy
 }
 
 // NewMetricsService создает новый сервис метрик.
@@ -21,46 +26,63 @@ func NewMetricsService(storage repository.Storage) *MetricsService {
 	return &MetricsService{
 		storage: storage,
 		logger:  logger.Log,
+		tenant:  tenant.Default,
+		policy:  DefaultValidationPolicy(),
 	}
 }
 
-// ValidationError представляет ошибку валидации.
-type ValidationError struct {
-	Message string
+// SetValidationPolicy задаёт правила проверки метрик.
+func (s *MetricsService) SetValidationPolicy(policy ValidationPolicy) {
+	s.policy = policy
 }
 
-// Error возвращает текст ошибки валидации.
-func (e *ValidationError) Error() string {
-	return e.Message
+// SetCardinalityLimiter включает лимиты числа рядов.
+func (s *MetricsService) SetCardinalityLimiter(limiter *CardinalityLimiter) {
+	s.limiter = limiter
 }
 
-// IsValidationError проверяет, является ли ошибка ошибкой валидации.
-func IsValidationError(err error) bool {
-	_, ok := err.(*ValidationError)
-	return ok
+// CardinalityLimiter возвращает ограничитель числа рядов (nil — лимиты выключены).
+func (s *MetricsService) CardinalityLimiter() *CardinalityLimiter {
+	return s.limiter
+}
+
+// ForTenant возвращает сервис, работающий с метриками арендатора.
+func (s *MetricsService) ForTenant(name string) *MetricsService {
+	if name == tenant.Default {
+		return s
+	}
+	view := *s
+	view.storage = s.storage.ForTenant(name)
+	view.tenant = name
+	view.logger = s.logger.With(zap.String("tenant", name))
+	return &view
+}
+
+// ForClient возвращает сервис, учитывающий созданные ряды на имя клиента.
+func (s *MetricsService) ForClient(name string) *MetricsService {
+	view := *s
+	view.client = name
+	return &view
 }
 
 // validateMetric проверяет корректность метрики
 func (s *MetricsService) validateMetric(metric models.Metrics) error {
-	switch metric.MType {
-	case models.Counter:
-		if metric.Delta == nil {
-			return &ValidationError{Message: fmt.Sprintf("Counter metric '%s' missing delta", metric.ID)}
-		}
-	case models.Gauge:
-		if metric.Value == nil {
-			return &ValidationError{Message: fmt.Sprintf("Gauge metric '%s' missing value", metric.ID)}
-		}
-	default:
-		return &ValidationError{Message: fmt.Sprintf("Unknown metric type '%s' for metric '%s'", metric.MType, metric.ID)}
-	}
-	return nil
+	return s.policy.Validate(metric)
 }
 
 // UpdateBatch обновляет множество метрик с валидацией.
 func (s *MetricsService) UpdateBatch(metrics []models.Metrics) error {
+	_, err := s.UpdateBatchReturning(metrics)
+	return err
+}
+
+// UpdateBatchReturning обновляет множество метрик с валидацией и возвращает
+// сохранённые метрики со значениями после записи (для counter — накопленную
+// сумму). Новые ряды, отброшенные выборкой (политика sample), не сохраняются
+// и в результат не попадают.
+func (s *MetricsService) UpdateBatchReturning(metrics []models.Metrics) ([]models.Metrics, error) {
 	if len(metrics) == 0 {
-		return &ValidationError{Message: "Batch cannot be empty"}
+		return nil, &ValidationError{Code: CodeEmptyBatch, Message: "Batch cannot be empty"}
 	}
 
 	// Валидируем все метрики перед обновлением
@@ -70,53 +92,73 @@ func (s *MetricsService) UpdateBatch(metrics []models.Metrics) error {
 				zap.String("metric_id", metric.ID),
 				zap.String("metric_type", metric.MType),
 				zap.Error(err))
-			return err
+			return nil, err
 		}
 	}
 
-	// Используем batch операцию, если хранилище поддерживает её
-	if batchStorage, ok := s.storage.(repository.BatchStorage); ok {
-		if err := batchStorage.UpdateBatch(metrics); err != nil {
-			s.logger.Error("Failed to update metrics batch", zap.Error(err))
-			return fmt.Errorf("failed to update metrics batch: %w", err)
-		}
-		s.logger.Info("Batch metrics updated successfully", zap.Int("count", len(metrics)))
-		return nil
+	admitted, err := s.limiter.admit(s.storage, s.tenant, s.client, metrics, false)
+	if err != nil {
+		s.logger.Warn("Series limit reached", zap.String("client", s.client), zap.Error(err))
+		return nil, err
+	}
+	if len(admitted.sampled) > 0 {
+		s.logger.Warn("New series dropped by sampling",
+			zap.String("client", s.client),
+			zap.Int("dropped", len(admitted.sampled)),
+		)
 	}
 
-	// Fallback на обычные операции для обратной совместимости
-	for _, metric := range metrics {
-		var value string
+	committed, err := s.write(admitted.accepted)
+	if err != nil {
+		return nil, err
+	}
+	s.limiter.recordCreated(s.tenant, s.client, admitted.created)
 
-		switch metric.MType {
-		case models.Counter:
-			value = fmt.Sprintf("%d", *metric.Delta)
-		case models.Gauge:
-			value = fmt.Sprintf("%g", *metric.Value)
-		}
+	s.logger.Info("Batch metrics updated successfully", zap.Int("count", len(admitted.accepted)))
+	return committed, nil
+}
 
-		if err := s.storage.Update(metric.MType, metric.ID, value); err != nil {
-			s.logger.Error("Failed to update metric",
-				zap.Error(err),
-				zap.String("type", metric.MType),
-				zap.String("id", metric.ID),
-			)
-			return fmt.Errorf("failed to update metric %s: %w", metric.ID, err)
-		}
+// write записывает метрики в хранилище и возвращает их значения после записи
+func (s *MetricsService) write(metrics []models.Metrics) ([]models.Metrics, error) {
+	if len(metrics) == 0 {
+		return nil, nil
 	}
 
-	s.logger.Info("Batch metrics updated successfully", zap.Int("count", len(metrics)))
-	return nil
+	committed, err := repository.UpdateBatchReturning(s.storage, metrics)
+	if err != nil {
+		s.logger.Error("Failed to update metrics batch", zap.Error(err))
+		return nil, fmt.Errorf("failed to update metrics batch: %w", err)
+	}
+	return committed, nil
 }
 
 // UpdateSingle обновляет одну метрику с валидацией.
 func (s *MetricsService) UpdateSingle(metric models.Metrics) error {
+	_, err := s.UpdateSingleReturning(metric)
+	return err
+}
+
+// UpdateSingleReturning обновляет одну метрику с валидацией и возвращает её
+// значение после записи (для counter — накопленную сумму). Новый ряд,
+// отброшенный выборкой (политика sample), не сохраняется: возвращается
+// ErrSeriesSampled.
+func (s *MetricsService) UpdateSingleReturning(metric models.Metrics) (models.Metrics, error) {
 	if err := s.validateMetric(metric); err != nil {
 		s.logger.Error("Metric validation failed",
 			zap.String("metric_id", metric.ID),
 			zap.String("metric_type", metric.MType),
 			zap.Error(err))
-		return err
+		return models.Metrics{}, err
+	}
+
+	admitted, err := s.limiter.admit(s.storage, s.tenant, s.client, []models.Metrics{metric}, false)
+	if err != nil {
+		s.logger.Warn("Series limit reached", zap.String("client", s.client), zap.Error(err))
+		return models.Metrics{}, err
+	}
+	if len(admitted.sampled) > 0 {
+		s.logger.Warn("New series dropped by sampling", zap.String("id", metric.ID))
+		return models.Metrics{}, fmt.Errorf("%w: %s", ErrSeriesSampled, metric.ID)
 	}
 
 	var value string
@@ -127,17 +169,19 @@ func (s *MetricsService) UpdateSingle(metric models.Metrics) error {
 		value = fmt.Sprintf("%g", *metric.Value)
 	}
 
-	if err := s.storage.Update(metric.MType, metric.ID, value); err != nil {
+	committed, err := repository.UpdateReturning(s.storage, metric.MType, metric.ID, value)
+	if err != nil {
 		s.logger.Error("Failed to update metric",
 			zap.Error(err),
 			zap.String("type", metric.MType),
 			zap.String("id", metric.ID),
 		)
-		return fmt.Errorf("failed to update metric %s: %w", metric.ID, err)
+		return models.Metrics{}, fmt.Errorf("failed to update metric %s: %w", metric.ID, err)
 	}
+	s.limiter.recordCreated(s.tenant, s.client, admitted.created)
 
 	s.logger.Info("Metric updated successfully",
 		zap.String("type", metric.MType),
 		zap.String("id", metric.ID))
-	return nil
+	return committed, nil
 }
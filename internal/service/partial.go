@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"sort"
+
+	"go.uber.org/zap"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/repository"
+)
+
+// Коды ошибок метрик пакета, не связанные с валидацией
+const (
+	CodeSeriesLimit   = "series_limit"
+	CodeSeriesQuota   = "series_quota"
+	CodeSeriesSampled = "series_sampled"
+	CodeStorageError  = "storage_error"
+)
+
+// UpdateBatchPartial сохраняет корректные метрики пакета и возвращает ошибки
+// остальных по их индексам. Ошибка возвращается, только если пакет пуст.
+// Метрики, не сохранённые из-за сбоя хранилища, помечаются как retriable:
+// их можно отправить повторно, не дублируя уже сохранённые.
+func (s *MetricsService) UpdateBatchPartial(metrics []models.Metrics) (*models.BatchResult, error) {
+	if len(metrics) == 0 {
+		return nil, &ValidationError{Code: CodeEmptyBatch, Message: "Batch cannot be empty"}
+	}
+
+	result := &models.BatchResult{}
+
+	// Отбрасываем метрики, не прошедшие валидацию, запоминая исходные индексы
+	valid := make([]models.Metrics, 0, len(metrics))
+	indexes := make([]int, 0, len(metrics))
+	for i, metric := range metrics {
+		if err := s.validateMetric(metric); err != nil {
+			var validationErr *ValidationError
+			errors.As(err, &validationErr)
+			result.Errors = append(result.Errors, models.BatchItemError{
+				Index:   i,
+				ID:      metric.ID,
+				Code:    validationErr.Code,
+				Message: validationErr.Message,
+			})
+			continue
+		}
+		valid = append(valid, metric)
+		indexes = append(indexes, i)
+	}
+
+	admitted, err := s.limiter.admit(s.storage, s.tenant, s.client, valid, true)
+	if err == nil {
+		for _, i := range admitted.rejected {
+			result.Errors = append(result.Errors, models.BatchItemError{
+				Index:   indexes[i],
+				ID:      valid[i].ID,
+				Code:    CodeSeriesLimit,
+				Message: admitted.limitErr.Error(),
+			})
+		}
+		// Выборка детерминирована: повтор отброшенного ряда снова будет отброшен
+		for _, i := range admitted.sampled {
+			result.Errors = append(result.Errors, models.BatchItemError{
+				Index:   indexes[i],
+				ID:      valid[i].ID,
+				Code:    CodeSeriesSampled,
+				Message: ErrSeriesSampled.Error(),
+			})
+		}
+		_, err = s.write(admitted.accepted)
+	}
+
+	if err != nil {
+		// Хранилище пишет пакет целиком, поэтому не сохранилась ни одна метрика
+		code, retriable := CodeStorageError, true
+		if errors.Is(err, repository.ErrSeriesQuotaExceeded) {
+			code, retriable = CodeSeriesQuota, false
+		}
+		rejected := make(map[int]struct{}, len(admitted.rejected)+len(admitted.sampled))
+		for _, i := range append(admitted.rejected, admitted.sampled...) {
+			rejected[i] = struct{}{}
+		}
+		for i, metric := range valid {
+			if _, ok := rejected[i]; ok {
+				continue
+			}
+			result.Errors = append(result.Errors, models.BatchItemError{
+				Index:     indexes[i],
+				ID:        metric.ID,
+				Code:      code,
+				Message:   err.Error(),
+				Retriable: retriable,
+			})
+		}
+	} else {
+		result.Accepted = len(admitted.accepted)
+		s.limiter.recordCreated(s.tenant, s.client, admitted.created)
+	}
+
+	sort.Slice(result.Errors, func(i, j int) bool { return result.Errors[i].Index < result.Errors[j].Index })
+
+	s.logger.Info("Partial batch processed",
+		zap.Int("count", len(metrics)),
+		zap.Int("accepted", result.Accepted),
+		zap.Int("failed", len(result.Errors)),
+	)
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+	"github.com/Mihklz/metrixcollector/internal/repository"
+)
+
+func TestMetricsService_UpdateBatchPartial(t *testing.T) {
+	storage := repository.NewMemStorage()
+	svc := NewMetricsService(storage)
+	svc.SetCardinalityLimiter(NewCardinalityLimiter(CardinalityLimits{
+		PrefixLimits: map[string]int{"req_": 1},
+	}))
+
+	batch := gauges("Alloc", "bad name", "req_1", "req_2")
+	batch = append(batch, models.Metrics{ID: "PollCount", MType: models.Counter})
+
+	result, err := svc.UpdateBatchPartial(batch)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Accepted)
+	require.Len(t, result.Errors, 3)
+
+	assert.Equal(t, 1, result.Errors[0].Index)
+	assert.Equal(t, CodeInvalidName, result.Errors[0].Code)
+	assert.Equal(t, 3, result.Errors[1].Index)
+	assert.Equal(t, CodeSeriesLimit, result.Errors[1].Code)
+	assert.Equal(t, 4, result.Errors[2].Index)
+	assert.Equal(t, CodeMissingValue, result.Errors[2].Code)
+	for _, itemErr := range result.Errors {
+		assert.False(t, itemErr.Retriable)
+	}
+
+	_, ok := storage.GetGauge("Alloc")
+	assert.True(t, ok)
+	_, ok = storage.GetGauge("req_1")
+	assert.True(t, ok)
+	_, ok = storage.GetGauge("req_2")
+	assert.False(t, ok)
+
+	_, err = svc.UpdateBatchPartial(nil)
+	assert.True(t, IsValidationError(err))
+}
+
+func TestMetricsService_UpdateBatchPartialSampled(t *testing.T) {
+	storage := repository.NewMemStorage()
+	svc := NewMetricsService(storage)
+	svc.SetCardinalityLimiter(NewCardinalityLimiter(CardinalityLimits{
+		MaxSeries: 1,
+		Policy:    CardinalitySample,
+	}))
+
+	// Выборка с долей 0 отбрасывает все новые ряды сверх лимита
+	result, err := svc.UpdateBatchPartial(gauges("Alloc", "req_1", "req_2"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Accepted)
+	require.Len(t, result.Errors, 2)
+	for i, itemErr := range result.Errors {
+		assert.Equal(t, i+1, itemErr.Index)
+		assert.Equal(t, CodeSeriesSampled, itemErr.Code)
+		assert.False(t, itemErr.Retriable)
+	}
+
+	_, ok := storage.GetGauge("req_1")
+	assert.False(t, ok)
+}
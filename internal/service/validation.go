@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+// Коды ошибок валидации
+const (
+	CodeEmptyBatch       = "empty_batch"
+	CodeUnsupportedType  = "unsupported_type"
+	CodeMissingValue     = "missing_value"
+	CodeInvalidValue     = "invalid_value"
+	CodeInvalidName      = "invalid_name"
+	CodeNameTooLong      = "name_too_long"
+	CodeReservedPrefix   = "reserved_prefix"
+	CodeNonFiniteValue   = "non_finite_value"
+	CodeDeltaOutOfBounds = "delta_out_of_bounds"
+)
+
+// ValidationError представляет ошибку валидации.
+type ValidationError struct {
+	Code    string `json:"code"`             // машиночитаемый код ошибки
+	Message string `json:"message"`          // описание для человека
+	Metric  string `json:"metric,omitempty"` // имя метрики, если ошибка относится к ней
+	Field   string `json:"field,omitempty"`  // поле метрики: id, type, value или delta
+}
+
+// Error возвращает текст ошибки валидации.
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// IsValidationError проверяет, является ли ошибка ошибкой валидации.
+func IsValidationError(err error) bool {
+	var validationErr *ValidationError
+	return errors.As(err, &validationErr)
+}
+
+// DefaultNamePattern — допустимые имена метрик по умолчанию
+var DefaultNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.:-]*$`)
+
+// ValidationPolicy — правила проверки метрик, общие для всех способов записи.
+type ValidationPolicy struct {
+	NamePattern      *regexp.Regexp // допустимые имена (nil — любые непустые)
+	MaxNameLength    int            // максимальная длина имени в байтах (0 — без ограничения)
+	ReservedPrefixes []string       // префиксы имён, запрещённые для клиентов
+	AllowNonFinite   bool           // принимать NaN и ±Inf в gauge
+	MaxCounterDelta  int64          // максимальный модуль приращения counter (0 — без ограничения)
+	RejectNegative   bool           // отклонять отрицательные приращения counter
+}
+
+// DefaultValidationPolicy возвращает политику по умолчанию: имена по
+// DefaultNamePattern не длиннее 255 байт, без NaN и ±Inf.
+func DefaultValidationPolicy() ValidationPolicy {
+	return ValidationPolicy{
+		NamePattern:   DefaultNamePattern,
+		MaxNameLength: 255,
+	}
+}
+
+// Validate проверяет метрику по политике.
+func (p ValidationPolicy) Validate(metric models.Metrics) error {
+	if err := p.validateName(metric.ID); err != nil {
+		return err
+	}
+
+	switch metric.MType {
+	case models.Counter:
+		if metric.Delta == nil {
+			return &ValidationError{Code: CodeMissingValue, Metric: metric.ID, Field: "delta",
+				Message: fmt.Sprintf("Counter metric '%s' missing delta", metric.ID)}
+		}
+		delta := *metric.Delta
+		if p.RejectNegative && delta < 0 {
+			return &ValidationError{Code: CodeDeltaOutOfBounds, Metric: metric.ID, Field: "delta",
+				Message: fmt.Sprintf("Counter metric '%s' has negative delta %d", metric.ID, delta)}
+		}
+		if p.MaxCounterDelta > 0 && (delta > p.MaxCounterDelta || delta < -p.MaxCounterDelta) {
+			return &ValidationError{Code: CodeDeltaOutOfBounds, Metric: metric.ID, Field: "delta",
+				Message: fmt.Sprintf("Counter metric '%s' delta %d exceeds the limit of %d", metric.ID, delta, p.MaxCounterDelta)}
+		}
+	case models.Gauge:
+		if metric.Value == nil {
+			return &ValidationError{Code: CodeMissingValue, Metric: metric.ID, Field: "value",
+				Message: fmt.Sprintf("Gauge metric '%s' missing value", metric.ID)}
+		}
+		if !p.AllowNonFinite && (math.IsNaN(*metric.Value) || math.IsInf(*metric.Value, 0)) {
+			return &ValidationError{Code: CodeNonFiniteValue, Metric: metric.ID, Field: "value",
+				Message: fmt.Sprintf("Gauge metric '%s' value must be a finite number", metric.ID)}
+		}
+	default:
+		return &ValidationError{Code: CodeUnsupportedType, Metric: metric.ID, Field: "type",
+			Message: fmt.Sprintf("Unknown metric type '%s' for metric '%s'", metric.MType, metric.ID)}
+	}
+	return nil
+}
+
+// validateName проверяет имя метрики
+func (p ValidationPolicy) validateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return &ValidationError{Code: CodeInvalidName, Field: "id", Message: "Metric name is required"}
+	}
+	if p.MaxNameLength > 0 && len(name) > p.MaxNameLength {
+		return &ValidationError{Code: CodeNameTooLong, Metric: name[:p.MaxNameLength], Field: "id",
+			Message: fmt.Sprintf("Metric name is longer than %d bytes", p.MaxNameLength)}
+	}
+	if p.NamePattern != nil && !p.NamePattern.MatchString(name) {
+		return &ValidationError{Code: CodeInvalidName, Metric: name, Field: "id",
+			Message: fmt.Sprintf("Metric name '%s' does not match %s", name, p.NamePattern)}
+	}
+	for _, prefix := range p.ReservedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return &ValidationError{Code: CodeReservedPrefix, Metric: name, Field: "id",
+				Message: fmt.Sprintf("Metric name '%s' uses reserved prefix '%s'", name, prefix)}
+		}
+	}
+	return nil
+}
+
+// ParseMetric собирает метрику из строкового значения URL API.
+func ParseMetric(metricType, name, value string) (models.Metrics, error) {
+	metric := models.Metrics{ID: name, MType: metricType}
+	switch metricType {
+	case models.Gauge:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return metric, &ValidationError{Code: CodeInvalidValue, Metric: name, Field: "value",
+				Message: fmt.Sprintf("invalid gauge value: %s", value)}
+		}
+		metric.Value = &v
+	case models.Counter:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return metric, &ValidationError{Code: CodeInvalidValue, Metric: name, Field: "delta",
+				Message: fmt.Sprintf("invalid counter value: %s", value)}
+		}
+		metric.Delta = &v
+	default:
+		return metric, &ValidationError{Code: CodeUnsupportedType, Metric: name, Field: "type",
+			Message: fmt.Sprintf("unsupported metric type: %s", metricType)}
+	}
+	return metric, nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+func TestValidationPolicy_Validate(t *testing.T) {
+	gauge := func(name string, v float64) models.Metrics {
+		return models.Metrics{ID: name, MType: models.Gauge, Value: &v}
+	}
+	counter := func(name string, d int64) models.Metrics {
+		return models.Metrics{ID: name, MType: models.Counter, Delta: &d}
+	}
+
+	policy := DefaultValidationPolicy()
+	policy.ReservedPrefixes = []string{"__"}
+	policy.MaxCounterDelta = 1000
+	policy.RejectNegative = true
+
+	tests := []struct {
+		name   string
+		metric models.Metrics
+		code   string
+		field  string
+	}{
+		{name: "valid gauge", metric: gauge("Alloc", 1)},
+		{name: "valid counter", metric: counter("http.requests:total", 5)},
+		{name: "empty name", metric: gauge("", 1), code: CodeInvalidName, field: "id"},
+		{name: "whitespace name", metric: gauge("   ", 1), code: CodeInvalidName, field: "id"},
+		{name: "name with spaces", metric: gauge("my metric", 1), code: CodeInvalidName, field: "id"},
+		{name: "long name", metric: gauge(strings.Repeat("a", 256), 1), code: CodeNameTooLong, field: "id"},
+		{name: "reserved prefix", metric: gauge("__internal", 1), code: CodeReservedPrefix, field: "id"},
+		{name: "NaN", metric: gauge("Alloc", math.NaN()), code: CodeNonFiniteValue, field: "value"},
+		{name: "Inf", metric: gauge("Alloc", math.Inf(-1)), code: CodeNonFiniteValue, field: "value"},
+		{name: "missing value", metric: models.Metrics{ID: "Alloc", MType: models.Gauge}, code: CodeMissingValue, field: "value"},
+		{name: "delta too large", metric: counter("PollCount", 1001), code: CodeDeltaOutOfBounds, field: "delta"},
+		{name: "negative delta", metric: counter("PollCount", -1), code: CodeDeltaOutOfBounds, field: "delta"},
+		{name: "unknown type", metric: models.Metrics{ID: "Alloc", MType: "histogram"}, code: CodeUnsupportedType, field: "type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.metric)
+			if tt.code == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.code, validationErr.Code)
+			assert.Equal(t, tt.field, validationErr.Field)
+		})
+	}
+}
+
+func TestValidationPolicy_Custom(t *testing.T) {
+	policy := ValidationPolicy{
+		NamePattern:    regexp.MustCompile(`^app_[a-z]+$`),
+		AllowNonFinite: true,
+	}
+	v := math.Inf(1)
+	assert.NoError(t, policy.Validate(models.Metrics{ID: "app_latency", MType: models.Gauge, Value: &v}))
+	assert.Error(t, policy.Validate(models.Metrics{ID: "Alloc", MType: models.Gauge, Value: &v}))
+}
+
+func TestParseMetric(t *testing.T) {
+	metric, err := ParseMetric(models.Counter, "PollCount", "5")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *metric.Delta)
+
+	_, err = ParseMetric(models.Gauge, "Alloc", "abc")
+	assert.True(t, IsValidationError(err))
+	_, err = ParseMetric("histogram", "Alloc", "1")
+	assert.True(t, IsValidationError(err))
+}
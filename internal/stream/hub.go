@@ -0,0 +1,254 @@
+// Package stream рассылает подписчикам обновления метрик по мере их записи
+// в хранилище (GET /api/v1/stream по Server-Sent Events или WebSocket).
+package stream
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+// Ошибки подписки
+var (
+	// ErrClosed — сервер останавливается.
+	ErrClosed = errors.New("stream hub is closed")
+	// ErrTooManySubscribers — достигнут лимит одновременных подписчиков.
+	ErrTooManySubscribers = errors.New("too many stream subscribers")
+	// ErrSlowConsumer — подписчик отстал больше чем на размер буфера и отключён.
+	ErrSlowConsumer = errors.New("slow consumer")
+)
+
+// Update — метрика после записи в хранилище.
+type Update struct {
+	Seq    uint64 // номер обновления, возрастает в пределах работы сервера
+	Tenant string
+	Metric models.Metrics // значение после записи (для counter — сумма)
+	Time   time.Time
+}
+
+// Filter — отбор обновлений для подписчика. Пустые поля не ограничивают отбор,
+// кроме Tenant: подписчик видит только метрики своего арендатора.
+type Filter struct {
+	Tenant string
+	Type   string // gauge или counter
+	Name   string // точное имя
+	Prefix string // префикс имени
+}
+
+// Match проверяет, подходит ли обновление под фильтр.
+func (f Filter) Match(u Update) bool {
+	return u.Tenant == f.Tenant &&
+		(f.Type == "" || u.Metric.MType == f.Type) &&
+		(f.Name == "" || u.Metric.ID == f.Name) &&
+		strings.HasPrefix(u.Metric.ID, f.Prefix)
+}
+
+// Hub рассылает обновления подписчикам. Рассылка не блокирует запись
+// метрик: обновления складываются в буфер подписчика, а если буфер полон,
+// отбрасываются с подсчётом. Подписчик, потерявший больше обновлений,
+// чем вмещает буфер, отключается с ErrSlowConsumer.
+type Hub struct {
+	bufferSize     int
+	maxSubscribers int
+	now            func() time.Time
+	seq            atomic.Uint64
+	active         atomic.Int64 // число подписчиков для быстрой проверки в Active
+
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub создаёт хаб с буфером bufferSize обновлений на подписчика и
+// ограничением maxSubscribers одновременных подписчиков (0 — без ограничения).
+func NewHub(bufferSize, maxSubscribers int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	return &Hub{
+		bufferSize:     bufferSize,
+		maxSubscribers: maxSubscribers,
+		now:            time.Now,
+		subs:           make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe подписывает на обновления, подходящие под filter.
+// Подписку нужно закрыть вызовом Close.
+func (h *Hub) Subscribe(filter Filter) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrClosed
+	}
+	if h.maxSubscribers > 0 && len(h.subs) >= h.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+
+	sub := &Subscription{
+		hub:     h,
+		filter:  filter,
+		updates: make(chan Update, h.bufferSize),
+		done:    make(chan struct{}),
+	}
+	h.subs[sub] = struct{}{}
+	h.active.Add(1)
+	return sub, nil
+}
+
+// Len возвращает число подписчиков.
+func (h *Hub) Len() int {
+	return int(h.active.Load())
+}
+
+// Active сообщает, что у хаба есть подписчики (реализует repository.UpdateListener).
+func (h *Hub) Active() bool {
+	return h.active.Load() > 0
+}
+
+// MetricsUpdated рассылает записанные метрики подписчикам
+// (реализует repository.UpdateListener).
+func (h *Hub) MetricsUpdated(tenantName string, metrics []models.Metrics) {
+	now := h.now()
+	var slow []*Subscription
+
+	h.mu.RLock()
+	for _, metric := range metrics {
+		u := Update{Seq: h.seq.Add(1), Tenant: tenantName, Metric: metric, Time: now}
+		for sub := range h.subs {
+			if sub.filter.Match(u) && !sub.offer(u) {
+				slow = append(slow, sub)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, sub := range slow {
+		h.remove(sub, ErrSlowConsumer)
+	}
+}
+
+// Close отключает всех подписчиков с ErrClosed. Новые подписки не принимаются.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	subs := make([]*Subscription, 0, len(h.subs))
+	for sub := range h.subs {
+		subs = append(subs, sub)
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		h.remove(sub, ErrClosed)
+	}
+}
+
+// remove отписывает подписчика и сообщает ему причину отключения
+func (h *Hub) remove(sub *Subscription, reason error) {
+	h.mu.Lock()
+	_, ok := h.subs[sub]
+	delete(h.subs, sub)
+	h.mu.Unlock()
+
+	if ok {
+		h.active.Add(-1)
+		sub.disconnect(reason)
+	}
+}
+
+// Subscription — подписка на обновления метрик.
+type Subscription struct {
+	hub     *Hub
+	filter  Filter
+	updates chan Update
+	done    chan struct{}
+
+	mu      sync.Mutex
+	dropped int   // отброшено обновлений с последнего вызова Dropped
+	err     error // причина отключения
+}
+
+// Updates возвращает канал обновлений. Канал не закрывается:
+// об отключении сообщает Done.
+func (s *Subscription) Updates() <-chan Update {
+	return s.updates
+}
+
+// Done закрывается, когда хаб отключил подписчика; причину возвращает Err.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err возвращает причину отключения: ErrSlowConsumer, ErrClosed или nil,
+// если подписка закрыта вызовом Close.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Dropped возвращает число обновлений, отброшенных из-за полного буфера
+// с прошлого вызова, и обнуляет счётчик.
+func (s *Subscription) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := s.dropped
+	s.dropped = 0
+	return dropped
+}
+
+// Close отписывает подписчика.
+func (s *Subscription) Close() {
+	s.hub.remove(s, nil)
+}
+
+// offer кладёт обновление в буфер без ожидания. Возвращает false,
+// если подписчик отстал больше чем на размер буфера.
+func (s *Subscription) offer(u Update) bool {
+	select {
+	case s.updates <- u:
+		return true
+	default:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped++
+	return s.dropped <= cap(s.updates)
+}
+
+// disconnect завершает подписку с указанной причиной
+func (s *Subscription) disconnect(reason error) {
+	s.mu.Lock()
+	s.err = reason
+	s.mu.Unlock()
+	close(s.done)
+}
+
+// События потока
+const (
+	EventMetric     = "metric"     // обновление метрики
+	EventDropped    = "dropped"    // подписчик не успевал читать, часть обновлений отброшена
+	EventDisconnect = "disconnect" // сервер отключает подписчика
+)
+
+// Message — сообщение потока, отправляемое клиенту в JSON.
+type Message struct {
+	Event   string          `json:"event"`
+	Seq     uint64          `json:"seq,omitempty"`
+	Time    time.Time       `json:"time"`
+	Metric  *models.Metrics `json:"metric,omitempty"`
+	Dropped int             `json:"dropped,omitempty"`
+	Reason  string          `json:"reason,omitempty"`
+}
+
+// NewMetricMessage создаёт сообщение об обновлении метрики.
+func NewMetricMessage(u Update) Message {
+	metric := u.Metric
+	return Message{Event: EventMetric, Seq: u.Seq, Time: u.Time, Metric: &metric}
+}
@@ -0,0 +1,90 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+func gauge(name string, value float64) models.Metrics {
+	return models.Metrics{ID: name, MType: models.Gauge, Value: &value}
+}
+
+func TestFilter_Match(t *testing.T) {
+	u := Update{Tenant: "team-a", Metric: gauge("http.latency", 1)}
+
+	assert.True(t, Filter{Tenant: "team-a"}.Match(u))
+	assert.True(t, Filter{Tenant: "team-a", Type: models.Gauge, Prefix: "http."}.Match(u))
+	assert.True(t, Filter{Tenant: "team-a", Name: "http.latency"}.Match(u))
+	assert.False(t, Filter{}.Match(u), "другой арендатор")
+	assert.False(t, Filter{Tenant: "team-a", Type: models.Counter}.Match(u))
+	assert.False(t, Filter{Tenant: "team-a", Name: "http"}.Match(u))
+	assert.False(t, Filter{Tenant: "team-a", Prefix: "db."}.Match(u))
+}
+
+func TestHub_DeliversMatchingUpdates(t *testing.T) {
+	hub := NewHub(4, 0)
+	assert.False(t, hub.Active())
+
+	sub, err := hub.Subscribe(Filter{Prefix: "Heap"})
+	require.NoError(t, err)
+	assert.True(t, hub.Active())
+
+	hub.MetricsUpdated("", []models.Metrics{gauge("Alloc", 1), gauge("HeapAlloc", 2)})
+	hub.MetricsUpdated("team-a", []models.Metrics{gauge("HeapInuse", 3)})
+
+	u := <-sub.Updates()
+	assert.Equal(t, "HeapAlloc", u.Metric.ID)
+	assert.Equal(t, uint64(2), u.Seq)
+	assert.Empty(t, sub.Updates())
+
+	sub.Close()
+	assert.False(t, hub.Active())
+	assert.NoError(t, sub.Err())
+}
+
+func TestHub_SlowConsumer(t *testing.T) {
+	hub := NewHub(2, 0)
+	sub, err := hub.Subscribe(Filter{})
+	require.NoError(t, err)
+
+	// Буфер на 2 обновления: ещё 2 отбрасываются с подсчётом
+	for i := range 4 {
+		hub.MetricsUpdated("", []models.Metrics{gauge("Alloc", float64(i))})
+	}
+	assert.Equal(t, 2, sub.Dropped())
+	assert.Equal(t, 0, sub.Dropped())
+	select {
+	case <-sub.Done():
+		t.Fatal("subscriber disconnected too early")
+	default:
+	}
+
+	// Отставание больше буфера отключает подписчика
+	for i := range 3 {
+		hub.MetricsUpdated("", []models.Metrics{gauge("Alloc", float64(i))})
+	}
+	<-sub.Done()
+	assert.ErrorIs(t, sub.Err(), ErrSlowConsumer)
+	assert.Equal(t, 0, hub.Len())
+}
+
+func TestHub_Limits(t *testing.T) {
+	hub := NewHub(1, 1)
+	sub, err := hub.Subscribe(Filter{})
+	require.NoError(t, err)
+
+	_, err = hub.Subscribe(Filter{})
+	assert.ErrorIs(t, err, ErrTooManySubscribers)
+
+	hub.Close()
+	<-sub.Done()
+	assert.ErrorIs(t, sub.Err(), ErrClosed)
+	sub.Close()
+
+	_, err = hub.Subscribe(Filter{})
+	assert.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,262 @@
+package stream
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Минимальная серверная реализация WebSocket (RFC 6455) на стандартной
+// библиотеке: сервер отправляет текстовые сообщения, а от клиента принимает
+// только управляющие кадры (ping, close). Данные клиента игнорируются.
+
+// websocketGUID — константа протокола для вычисления Sec-WebSocket-Accept
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Коды кадров
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// Коды закрытия соединения
+const (
+	CloseNormal      = 1000
+	CloseGoingAway   = 1001
+	CloseProtocolErr = 1002
+	CloseTooBig      = 1009
+	CloseTryAgain    = 1013
+)
+
+// maxClientPayload — максимальный размер кадра клиента
+const maxClientPayload = 4096
+
+// IsWebSocketRequest проверяет, что клиент запрашивает переход на WebSocket.
+func IsWebSocketRequest(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") &&
+		headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// headerContains проверяет наличие токена в заголовке со списком через запятую
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AcceptKey вычисляет Sec-WebSocket-Accept для ключа клиента.
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// WebSocketConn — соединение WebSocket на стороне сервера.
+type WebSocketConn struct {
+	conn         net.Conn
+	rw           *bufio.ReadWriter
+	writeTimeout time.Duration
+
+	writeMu sync.Mutex
+	closed  chan struct{} // закрывается, когда клиент закрыл соединение
+}
+
+// Upgrade проверяет запрос на переход и переключает соединение на WebSocket.
+// При ошибке ответ клиенту уже отправлен.
+func Upgrade(w http.ResponseWriter, r *http.Request, writeTimeout time.Duration) (*WebSocketConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !IsWebSocketRequest(r) || key == "" {
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("invalid websocket key")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket is not supported", http.StatusInternalServerError)
+		return nil, fmt.Errorf("hijack connection: %w", err)
+	}
+	// Сбрасываем таймауты, выставленные сервером для обычных запросов
+	_ = conn.SetDeadline(time.Time{})
+
+	handshake := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	if _, err := rw.WriteString(handshake); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ws := &WebSocketConn{
+		conn:         conn,
+		rw:           rw,
+		writeTimeout: writeTimeout,
+		closed:       make(chan struct{}),
+	}
+	go ws.readLoop()
+	return ws, nil
+}
+
+// Closed закрывается, когда клиент закрыл соединение или оно оборвалось.
+func (c *WebSocketConn) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// WriteText отправляет текстовое сообщение.
+func (c *WebSocketConn) WriteText(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// Close отправляет кадр закрытия с кодом и причиной и закрывает соединение.
+func (c *WebSocketConn) Close(code int, reason string) error {
+	// Причина закрытия вместе с кодом должна помещаться в управляющий кадр
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	_ = c.writeFrame(opClose, payload)
+	return c.conn.Close()
+}
+
+// Ping отправляет кадр ping для проверки соединения.
+func (c *WebSocketConn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// writeFrame отправляет кадр без маски (кадры сервера не маскируются)
+func (c *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode // FIN
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	if c.writeTimeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(payload); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+// readLoop читает кадры клиента: отвечает на ping, завершает работу
+// по кадру close или обрыву соединения
+func (c *WebSocketConn) readLoop() {
+	defer close(c.closed)
+
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			if errors.Is(err, errFrameTooBig) {
+				_ = c.Close(CloseTooBig, "frame too big")
+			} else if errors.Is(err, errProtocol) {
+				_ = c.Close(CloseProtocolErr, err.Error())
+			}
+			return
+		}
+		switch opcode {
+		case opPing:
+			_ = c.writeFrame(opPong, payload)
+		case opClose:
+			// Отвечаем тем же кодом, как требует протокол
+			_ = c.writeFrame(opClose, payload)
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// Ошибки разбора кадров клиента
+var (
+	errFrameTooBig = errors.New("websocket frame too big")
+	errProtocol    = errors.New("websocket protocol error")
+)
+
+// readFrame читает кадр клиента и снимает маску
+func (c *WebSocketConn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.rw, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		// Кадры клиента обязаны быть замаскированы
+		return 0, nil, fmt.Errorf("%w: unmasked client frame", errProtocol)
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxClientPayload {
+		return 0, nil, errFrameTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// Пример из RFC 6455, раздел 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+// dialWebSocket выполняет рукопожатие с тестовым сервером
+func dialWebSocket(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\n"+
+		"Connection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	return conn, reader
+}
+
+// readServerFrame читает кадр сервера (без маски, короткий)
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	_, err := io.ReadFull(r, head[:])
+	require.NoError(t, err)
+	require.Zero(t, head[1]&0x80, "server frames must not be masked")
+	length := int(head[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		_, err = io.ReadFull(r, ext[:])
+		require.NoError(t, err)
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	require.NoError(t, err)
+	return head[0] & 0x0F, payload
+}
+
+// writeClientFrame отправляет замаскированный кадр клиента
+func writeClientFrame(t *testing.T, conn net.Conn, opcode byte, payload []byte) {
+	t.Helper()
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func TestWebSocket_Exchange(t *testing.T) {
+	closed := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := Upgrade(w, r, time.Second)
+		if err != nil {
+			return
+		}
+		_ = ws.WriteText([]byte(strings.Repeat("x", 200)))
+		<-ws.Closed()
+		close(closed)
+	}))
+	defer srv.Close()
+
+	conn, reader := dialWebSocket(t, srv)
+
+	opcode, payload := readServerFrame(t, reader)
+	assert.Equal(t, byte(opText), opcode)
+	assert.Len(t, payload, 200)
+
+	// На ping сервер отвечает pong с теми же данными
+	writeClientFrame(t, conn, opPing, []byte("hi"))
+	opcode, payload = readServerFrame(t, reader)
+	assert.Equal(t, byte(opPong), opcode)
+	assert.Equal(t, "hi", string(payload))
+
+	// На close сервер отвечает close и закрывает соединение
+	writeClientFrame(t, conn, opClose, []byte{0x03, 0xE8})
+	opcode, _ = readServerFrame(t, reader)
+	assert.Equal(t, byte(opClose), opcode)
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("server did not notice client close")
+	}
+}
+
+func TestUpgrade_RejectsPlainRequest(t *testing.T) {
+	rec := httptest.NewRecorder()
+	_, err := Upgrade(rec, httptest.NewRequest(http.MethodGet, "/", nil), time.Second)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
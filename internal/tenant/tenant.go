@@ -0,0 +1,40 @@
+// Package tenant описывает арендаторов сервера: команды, у которых
+// собственное пространство имён метрик.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// Header — заголовок, в котором клиент без привязанного к токену арендатора
+// указывает своё пространство имён.
+const Header = "X-Tenant-ID"
+
+// Default — арендатор по умолчанию: метрики клиентов, не указавших арендатора.
+const Default = ""
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// Validate проверяет имя арендатора: латинские буквы, цифры, '_', '.', '-',
+// не длиннее 64 символов.
+func Validate(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid tenant %q", name)
+	}
+	return nil
+}
+
+type tenantKey struct{}
+
+// WithTenant сохраняет арендатора в контексте запроса.
+func WithTenant(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, name)
+}
+
+// FromContext возвращает арендатора запроса или Default.
+func FromContext(ctx context.Context) string {
+	name, _ := ctx.Value(tenantKey{}).(string)
+	return name
+}
@@ -0,0 +1,2 @@
+-- Откат создания таблицы токенов API
+DROP TABLE IF EXISTS api_tokens;
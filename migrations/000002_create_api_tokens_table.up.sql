@@ -0,0 +1,11 @@
+-- Токены доступа к API
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    -- SHA-256 токена в hex, сам токен не хранится
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    -- Роли через запятую: ingest, read, admin
+    roles VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP
+);
@@ -0,0 +1,6 @@
+-- Откат арендаторов: метрики арендаторов удаляются
+ALTER TABLE api_tokens DROP COLUMN IF EXISTS tenant;
+DELETE FROM metrics WHERE tenant <> '';
+DROP INDEX IF EXISTS idx_metrics_tenant_name_type;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_metrics_name_type ON metrics(name, type);
+ALTER TABLE metrics DROP COLUMN IF EXISTS tenant;
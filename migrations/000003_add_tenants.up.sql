@@ -0,0 +1,11 @@
+-- Арендаторы: у каждого своё пространство имён метрик.
+-- Пустая строка — арендатор по умолчанию, к нему относятся существующие метрики.
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS tenant VARCHAR(64) NOT NULL DEFAULT '';
+
+-- Имя метрики уникально в пределах арендатора.
+-- Индекс начинается с tenant и обслуживает все запросы арендатора.
+DROP INDEX IF EXISTS idx_metrics_name_type;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_metrics_tenant_name_type ON metrics(tenant, name, type);
+
+-- Арендатор, к которому привязан токен (NULL — арендатор из заголовка X-Tenant-ID)
+ALTER TABLE api_tokens ADD COLUMN IF NOT EXISTS tenant VARCHAR(64);
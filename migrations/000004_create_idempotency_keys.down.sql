@@ -0,0 +1,2 @@
+-- Откат создания таблицы ключей идемпотентности
+DROP TABLE IF EXISTS idempotency_keys;
@@ -0,0 +1,17 @@
+-- Результаты запросов с заголовком Idempotency-Key: повтор запроса
+-- в пределах окна дедупликации получает сохранённый ответ
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    tenant VARCHAR(64) NOT NULL DEFAULT '',
+    key VARCHAR(255) NOT NULL,
+    -- SHA-256 тела запроса в hex
+    request_hash CHAR(64) NOT NULL,
+    status INTEGER NOT NULL,
+    -- Сохранённые заголовки ответа в JSON
+    header TEXT NOT NULL,
+    body BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant, key)
+);
+
+-- Для удаления ключей с истёкшим окном
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
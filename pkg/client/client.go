@@ -0,0 +1,266 @@
+// Package client — типизированный Go-клиент API сервера метрик
+// (контракт описан в api/openapi.json).
+//
+// Клиент сжимает тела запросов gzip и, если задан ключ, подписывает запросы
+// HMAC-SHA256 так же, как агент: подписывается время, nonce и тело запроса,
+// поэтому подписанные запросы проходят и защиту от повтора. Подписанные
+// сервером ответы проверяются тем же ключом.
+//
+//	c, err := client.New("http://localhost:8080", client.WithKey("secret"))
+//	if err != nil {
+//		return err
+//	}
+//	_, err = c.UpdateBatch(ctx, []client.Metric{
+//		client.NewGauge("Alloc", 1024),
+//		client.NewCounter("Requests", 1),
+//	}, client.BatchOptions{})
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/tenant"
+)
+
+// defaultTimeout — таймаут запроса по умолчанию
+const defaultTimeout = 10 * time.Second
+
+// Client — клиент API сервера метрик. Безопасен для использования
+// из нескольких горутин.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	key        string // ключ HMAC (пусто — без подписи)
+	keyID      string // идентификатор ключа в связке ключей сервера
+	token      string // токен API (пусто — без аутентификации)
+	tenant     string // арендатор (пусто — по умолчанию)
+	agentID    string // идентификатор клиента для ограничения частоты и аудита
+	compress   bool
+}
+
+// Option настраивает клиент.
+type Option func(*Client)
+
+// WithKey задаёт ключ HMAC для подписи запросов и проверки ответов.
+func WithKey(key string) Option {
+	return func(c *Client) { c.key = key }
+}
+
+// WithKeyID задаёт идентификатор ключа в связке ключей сервера (заголовок HashKeyID).
+func WithKeyID(keyID string) Option {
+	return func(c *Client) { c.keyID = keyID }
+}
+
+// WithToken задаёт токен API (заголовок Authorization: Bearer).
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithTenant задаёт арендатора (заголовок X-Tenant-ID).
+func WithTenant(name string) Option {
+	return func(c *Client) { c.tenant = name }
+}
+
+// WithAgentID задаёт идентификатор клиента (заголовок X-Agent-ID).
+func WithAgentID(id string) Option {
+	return func(c *Client) { c.agentID = id }
+}
+
+// WithHTTPClient задаёт HTTP-клиент (например, с настройками TLS).
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithoutCompression отключает сжатие тел запросов.
+func WithoutCompression() Option {
+	return func(c *Client) { c.compress = false }
+}
+
+// New создаёт клиент сервера с адресом baseURL. Адрес без схемы
+// дополняется http://, как адреса серверов агента.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid server address %q", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		compress:   true,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.tenant != "" {
+		if err := tenant.Validate(c.tenant); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// request — запрос к серверу
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   any // тело в JSON (nil — без тела)
+}
+
+// response — ответ сервера с кодом 2xx
+type response struct {
+	header http.Header
+	body   []byte
+}
+
+// do выполняет запрос и возвращает ответ или *Error для кодов 4xx и 5xx
+func (c *Client) do(ctx context.Context, req request) (*response, error) {
+	httpReq, err := c.newRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, parseError(resp.StatusCode, body)
+	}
+	if err := c.verify(resp.Header, body); err != nil {
+		return nil, err
+	}
+	return &response{header: resp.Header, body: body}, nil
+}
+
+// newRequest собирает HTTP-запрос: JSON-тело, сжатие, заголовки и подпись
+func (c *Client) newRequest(ctx context.Context, req request) (*http.Request, error) {
+	var jsonData []byte
+	if req.body != nil {
+		var err error
+		if jsonData, err = json.Marshal(req.body); err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
+	}
+
+	target := c.baseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	payload := jsonData
+	compressed := c.compress && len(jsonData) > 0
+	if compressed {
+		var err error
+		if payload, err = compress(jsonData); err != nil {
+			return nil, fmt.Errorf("compress request: %w", err)
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if len(jsonData) > 0 {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if compressed {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+	if err := c.sign(httpReq, jsonData); err != nil {
+		return nil, err
+	}
+	return httpReq, nil
+}
+
+// doJSON выполняет запрос и декодирует JSON-ответ в out
+func (c *Client) doJSON(ctx context.Context, req request, out any) error {
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(resp.body, out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// sign добавляет заголовки аутентификации и подпись тела
+func (c *Client) sign(req *http.Request, body []byte) error {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.tenant != "" {
+		req.Header.Set(tenant.Header, c.tenant)
+	}
+	if c.agentID != "" {
+		req.Header.Set(crypto.AgentIDHeader, c.agentID)
+	}
+	if c.key == "" {
+		return nil
+	}
+
+	// Время и nonce входят в подпись и защищают от повтора запроса
+	nonce, err := crypto.NewNonce()
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(crypto.TimestampHeader, timestamp)
+	req.Header.Set(crypto.NonceHeader, nonce)
+	req.Header.Set("HashSHA256", crypto.CalculateHMAC(crypto.SignedPayload(timestamp, nonce, body), c.key))
+	if c.keyID != "" {
+		req.Header.Set(crypto.KeyIDHeader, c.keyID)
+	}
+	return nil
+}
+
+// verify проверяет подпись ответа, если сервер подписал его ключом клиента
+func (c *Client) verify(header http.Header, body []byte) error {
+	hash := header.Get("HashSHA256")
+	if c.key == "" || hash == "" || header.Get(crypto.KeyIDHeader) != c.keyID {
+		return nil
+	}
+	if !crypto.ValidateHMAC(body, c.key, hash) {
+		return ErrResponseSignature
+	}
+	return nil
+}
+
+// compress сжимает данные gzip
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,222 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/handler"
+	"github.com/Mihklz/metrixcollector/internal/idempotency"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	"github.com/Mihklz/metrixcollector/internal/middleware"
+	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/service"
+	"github.com/Mihklz/metrixcollector/internal/stream"
+)
+
+func init() {
+	logger.Log = zap.NewNop()
+}
+
+// newTestServer поднимает сервер с обработчиками и middleware подписи,
+// сжатия и защиты от повтора, как в internal/server
+func newTestServer(t *testing.T, key string) *httptest.Server {
+	t.Helper()
+
+	hub := stream.NewHub(16, 0)
+	t.Cleanup(hub.Close)
+	storage := repository.WithUpdateListener(repository.NewMemStorage(), hub)
+	svc := service.NewMetricsService(storage)
+	keyring := crypto.NewStaticKeyring(key)
+
+	r := chi.NewRouter()
+	r.Use(middleware.WithJSONErrors("/api/"))
+	r.Use(middleware.WithGzipLimit(1 << 20))
+	r.Use(middleware.WithHashValidation(middleware.HashValidationOptions{Keyring: keyring, Strict: key != ""}))
+	r.Use(middleware.WithReplayProtection(time.Minute, middleware.NewNonceCache(2*time.Minute, 1000)))
+
+	r.Post("/update/", handler.NewJSONUpdateHandler(svc, keyring, nil))
+	r.With(middleware.WithIdempotency(idempotency.NewMemoryStore(time.Minute, 100))).
+		Post("/updates/", handler.NewBatchUpdateHandler(svc, keyring, nil))
+	r.Post("/value/", handler.NewJSONValueHandler(storage, keyring))
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Get("/metrics", handler.NewAPIListMetricsHandler(storage, keyring))
+		r.Get("/metrics/{type}/{name}", handler.NewAPIGetMetricHandler(storage, keyring))
+		r.Put("/metrics/{type}/{name}", handler.NewAPIUpdateMetricHandler(svc, keyring, nil))
+		r.Delete("/metrics/{type}/{name}", handler.NewAPIDeleteMetricHandler(storage))
+		r.Get("/stream", handler.NewAPIStreamHandler(hub))
+	})
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient_SignedRoundTrip(t *testing.T) {
+	srv := newTestServer(t, "secret")
+	c, err := New(srv.URL, WithKey("secret"))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	stored, err := c.Update(ctx, NewCounter("Requests", 2))
+	require.NoError(t, err)
+	require.NotNil(t, stored.Delta)
+	assert.Equal(t, int64(2), *stored.Delta)
+
+	result, err := c.UpdateBatch(ctx, []Metric{
+		NewGauge("Alloc", 1.5),
+		NewCounter("Requests", 3),
+	}, BatchOptions{IdempotencyKey: "batch-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Accepted)
+	assert.False(t, result.Replayed)
+
+	// Повтор пакета с тем же ключом не применяется второй раз
+	result, err = c.UpdateBatch(ctx, []Metric{
+		NewGauge("Alloc", 1.5),
+		NewCounter("Requests", 3),
+	}, BatchOptions{IdempotencyKey: "batch-1"})
+	require.NoError(t, err)
+	assert.True(t, result.Replayed)
+
+	metric, err := c.Get(ctx, Counter, "Requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *metric.Delta)
+
+	metric, err = c.Value(ctx, Gauge, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *metric.Value)
+
+	metric, err = c.Set(ctx, NewGauge("Alloc", 7))
+	require.NoError(t, err)
+	assert.Equal(t, float64(7), *metric.Value)
+}
+
+func TestClient_UnsignedRequestRejected(t *testing.T) {
+	srv := newTestServer(t, "secret")
+	c, err := New(srv.URL)
+	require.NoError(t, err)
+
+	_, err = c.Update(context.Background(), NewGauge("Alloc", 1))
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.False(t, IsRetriable(err))
+}
+
+func TestClient_ListAllFollowsCursor(t *testing.T) {
+	srv := newTestServer(t, "")
+	c, err := New(srv.URL, WithoutCompression())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b", "c", "other"} {
+		_, err := c.Set(ctx, NewGauge(name, 1))
+		require.NoError(t, err)
+	}
+
+	page, err := c.List(ctx, ListOptions{Type: Gauge, Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, page.Metrics, 2)
+	assert.NotEmpty(t, page.NextCursor)
+
+	metrics, err := c.ListAll(ctx, ListOptions{Type: Gauge, Limit: 1})
+	require.NoError(t, err)
+	var names []string
+	for _, m := range metrics {
+		names = append(names, m.ID)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "other"}, names)
+}
+
+func TestClient_APIErrors(t *testing.T) {
+	srv := newTestServer(t, "")
+	c, err := New(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = c.Get(ctx, Gauge, "missing")
+	assert.True(t, IsNotFound(err))
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "metric_not_found", apiErr.Code)
+
+	_, err = c.Set(ctx, NewGauge("Alloc", 1))
+	require.NoError(t, err)
+	require.NoError(t, c.Delete(ctx, Gauge, "Alloc"))
+	assert.True(t, IsNotFound(c.Delete(ctx, Gauge, "Alloc")))
+
+	_, err = c.List(ctx, ListOptions{Regex: "("})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+}
+
+func TestClient_ResponseSignatureMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("HashSHA256", crypto.CalculateHMAC([]byte(`{}`), "other"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithKey("secret"))
+	require.NoError(t, err)
+	_, err = c.Get(context.Background(), Gauge, "Alloc")
+	assert.ErrorIs(t, err, ErrResponseSignature)
+}
+
+func TestNew_AddsScheme(t *testing.T) {
+	c, err := New("localhost:8080/")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080", c.baseURL)
+
+	_, err = New("http://")
+	assert.Error(t, err)
+}
+
+func TestClient_Stream(t *testing.T) {
+	srv := newTestServer(t, "secret")
+	c, err := New(srv.URL, WithKey("secret"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan StreamMessage, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Stream(ctx, StreamOptions{Type: Counter}, func(msg StreamMessage) error {
+			select {
+			case received <- msg:
+			default:
+			}
+			return nil
+		})
+	}()
+
+	// Обновления отправляются, пока подписка не установлена
+	var msg StreamMessage
+	require.Eventually(t, func() bool {
+		_, err := c.Set(context.Background(), NewCounter("Requests", 1))
+		require.NoError(t, err)
+		select {
+		case msg = <-received:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 20*time.Millisecond)
+	assert.Equal(t, EventMetric, msg.Event)
+	assert.Equal(t, "Requests", msg.Metric.ID)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrResponseSignature — подпись HashSHA256 ответа не совпала с ключом клиента.
+var ErrResponseSignature = errors.New("response signature mismatch")
+
+// Error — ответ сервера с кодом ошибки.
+type Error struct {
+	StatusCode int            // HTTP-статус
+	Code       string         // машиночитаемый код (пусто, если сервер ответил текстом)
+	Message    string         // описание ошибки
+	Details    map[string]any // подробности из ответа /api/v1
+}
+
+// Error возвращает текст ошибки.
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("server returned %d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound сообщает, что сервер ответил 404.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsRetriable сообщает, что запрос стоит повторить позже:
+// сервер перегружен (429) или временно не смог обработать запрос (5xx).
+func IsRetriable(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// parseError разбирает тело ответа с ошибкой: формат /api/v1,
+// ошибку валидации прежних эндпоинтов или текст
+func parseError(status int, body []byte) *Error {
+	apiErr := &Error{StatusCode: status}
+
+	var envelope struct {
+		Error *struct {
+			Code    string         `json:"code"`
+			Message string         `json:"message"`
+			Details map[string]any `json:"details"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error != nil {
+		apiErr.Code = envelope.Error.Code
+		apiErr.Message = envelope.Error.Message
+		apiErr.Details = envelope.Error.Details
+		return apiErr
+	}
+
+	var validation struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Metric  string `json:"metric"`
+		Field   string `json:"field"`
+	}
+	if json.Unmarshal(body, &validation) == nil && validation.Code != "" {
+		apiErr.Code = validation.Code
+		apiErr.Message = validation.Message
+		if validation.Metric != "" || validation.Field != "" {
+			apiErr.Details = map[string]any{"metric": validation.Metric, "field": validation.Field}
+		}
+		return apiErr
+	}
+
+	apiErr.Message = strings.TrimSpace(string(body))
+	if apiErr.Message == "" {
+		apiErr.Message = strings.ToLower(http.StatusText(status))
+	}
+	return apiErr
+}
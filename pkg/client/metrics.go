@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Mihklz/metrixcollector/internal/idempotency"
+	models "github.com/Mihklz/metrixcollector/internal/model"
+)
+
+// Ping проверяет доступность сервера и его базы данных (GET /ping).
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/ping"})
+	return err
+}
+
+// Update сохраняет метрику (POST /update/) и возвращает её в ответе сервера.
+func (c *Client) Update(ctx context.Context, metric Metric) (Metric, error) {
+	var stored Metric
+	err := c.doJSON(ctx, request{method: http.MethodPost, path: "/update/", body: metric}, &stored)
+	return stored, err
+}
+
+// UpdateBatch сохраняет пакет метрик (POST /updates/).
+// Без режима Partial пакет сохраняется целиком или отклоняется с ошибкой.
+func (c *Client) UpdateBatch(ctx context.Context, metrics []Metric, opts BatchOptions) (*BatchResult, error) {
+	header := http.Header{}
+	if opts.Partial {
+		header.Set(models.BatchModeHeader, models.BatchModePartial)
+	}
+	if opts.IdempotencyKey != "" {
+		header.Set(idempotency.Header, opts.IdempotencyKey)
+	}
+
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/updates/", header: header, body: metrics})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{Replayed: resp.header.Get(idempotency.ReplayedHeader) == "true"}
+	if len(resp.body) == 0 {
+		// Без режима Partial сервер отвечает пустым телом: пакет принят целиком
+		result.Accepted = len(metrics)
+		return result, nil
+	}
+	if err := json.Unmarshal(resp.body, result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return result, nil
+}
+
+// Value возвращает метрику через прежний JSON API (POST /value/).
+func (c *Client) Value(ctx context.Context, metricType, name string) (Metric, error) {
+	var metric Metric
+	err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   "/value/",
+		body:   Metric{ID: name, Type: metricType},
+	}, &metric)
+	return metric, err
+}
+
+// List возвращает страницу списка метрик (GET /api/v1/metrics).
+func (c *Client) List(ctx context.Context, opts ListOptions) (*MetricList, error) {
+	query := url.Values{}
+	setParam(query, "type", opts.Type)
+	setParam(query, "prefix", opts.Prefix)
+	setParam(query, "regex", opts.Regex)
+	setParam(query, "cursor", opts.Cursor)
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	var list MetricList
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: "/api/v1/metrics", query: query}, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ListAll возвращает все метрики, подходящие под фильтры, проходя по страницам.
+func (c *Client) ListAll(ctx context.Context, opts ListOptions) ([]Metric, error) {
+	var metrics []Metric
+	for {
+		page, err := c.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, page.Metrics...)
+		if page.NextCursor == "" {
+			return metrics, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// Get возвращает метрику (GET /api/v1/metrics/{type}/{name}).
+func (c *Client) Get(ctx context.Context, metricType, name string) (Metric, error) {
+	var metric Metric
+	err := c.doJSON(ctx, request{method: http.MethodGet, path: metricPath(metricType, name)}, &metric)
+	return metric, err
+}
+
+// Set обновляет метрику (PUT /api/v1/metrics/{type}/{name}) и возвращает
+// её значение после обновления: для counter — накопленную сумму.
+func (c *Client) Set(ctx context.Context, metric Metric) (Metric, error) {
+	var stored Metric
+	err := c.doJSON(ctx, request{method: http.MethodPut, path: metricPath(metric.Type, metric.ID), body: metric}, &stored)
+	return stored, err
+}
+
+// Delete удаляет метрику (DELETE /api/v1/metrics/{type}/{name}).
+func (c *Client) Delete(ctx context.Context, metricType, name string) error {
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: metricPath(metricType, name)})
+	return err
+}
+
+// SeriesTop возвращает клиентов и префиксы, создавшие больше всего рядов
+// (GET /series/top). При limit <= 0 используется значение сервера.
+func (c *Client) SeriesTop(ctx context.Context, limit int) (*SeriesTop, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var top SeriesTop
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: "/series/top", query: query}, &top); err != nil {
+		return nil, err
+	}
+	return &top, nil
+}
+
+// metricPath возвращает путь метрики в API v1
+func metricPath(metricType, name string) string {
+	return "/api/v1/metrics/" + url.PathEscape(metricType) + "/" + url.PathEscape(name)
+}
+
+// setParam добавляет непустой параметр запроса
+func setParam(query url.Values, name, value string) {
+	if value != "" {
+		query.Set(name, value)
+	}
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// События потока обновлений
+const (
+	EventMetric     = "metric"     // обновление метрики
+	EventDropped    = "dropped"    // клиент не успевал читать, часть обновлений пропущена
+	EventDisconnect = "disconnect" // сервер отключает клиента
+)
+
+// ErrStreamClosed — сервер завершил поток (например, при остановке).
+var ErrStreamClosed = errors.New("stream closed by server")
+
+// StreamOptions — фильтры потока обновлений.
+type StreamOptions struct {
+	Type   string // gauge, counter или пусто — все типы
+	Name   string // точное имя метрики
+	Prefix string // префикс имени
+}
+
+// StreamMessage — сообщение потока обновлений.
+type StreamMessage struct {
+	Event   string    `json:"event"`
+	Seq     uint64    `json:"seq,omitempty"`
+	Time    time.Time `json:"time"`
+	Metric  *Metric   `json:"metric,omitempty"` // значение после записи; у counter — сумма
+	Dropped int       `json:"dropped,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// Stream подписывается на обновления метрик (GET /api/v1/stream, Server-Sent
+// Events) и вызывает fn для каждого сообщения. Возвращает ошибку fn,
+// ErrStreamClosed при завершении потока сервером или ошибку с причиной
+// отключения; при отмене ctx возвращает ctx.Err().
+func (c *Client) Stream(ctx context.Context, opts StreamOptions, fn func(StreamMessage) error) error {
+	query := url.Values{}
+	setParam(query, "type", opts.Type)
+	setParam(query, "name", opts.Name)
+	setParam(query, "prefix", opts.Prefix)
+
+	req, err := c.newRequest(ctx, request{method: http.MethodGet, path: "/api/v1/stream", query: query})
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// Таймаут клиента ограничивает весь ответ, поэтому для потока он снимается
+	streamClient := *c.httpClient
+	streamClient.Timeout = 0
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(resp.Body)
+		return parseError(resp.StatusCode, body)
+	}
+
+	err = readEvents(resp.Body, func(data string) error {
+		var msg StreamMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return fmt.Errorf("decode stream message: %w", err)
+		}
+		if msg.Event == EventDisconnect {
+			return fmt.Errorf("disconnected by server: %s", msg.Reason)
+		}
+		return fn(msg)
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// readEvents разбирает поток Server-Sent Events и передаёт данные событий в fn
+func readEvents(r io.Reader, fn func(data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// Пустая строка завершает событие
+			if len(data) > 0 {
+				if err := fn(strings.Join(data, "\n")); err != nil {
+					return err
+				}
+				data = data[:0]
+			}
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		// Остальные поля (event, id) и комментарии (": ping") не нужны:
+		// тип события передаётся и в самих данных
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return ErrStreamClosed
+}
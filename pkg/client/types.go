@@ -0,0 +1,80 @@
+package client
+
+// Типы метрик
+const (
+	Gauge   = "gauge"
+	Counter = "counter"
+)
+
+// Metric — метрика в формате JSON API сервера.
+// У gauge заполнено Value, у counter — Delta.
+type Metric struct {
+	ID    string   `json:"id"`
+	Type  string   `json:"type"`
+	Delta *int64   `json:"delta,omitempty"`
+	Value *float64 `json:"value,omitempty"`
+}
+
+// NewGauge создаёт gauge-метрику со значением value.
+func NewGauge(name string, value float64) Metric {
+	return Metric{ID: name, Type: Gauge, Value: &value}
+}
+
+// NewCounter создаёт counter-метрику с приращением delta.
+func NewCounter(name string, delta int64) Metric {
+	return Metric{ID: name, Type: Counter, Delta: &delta}
+}
+
+// MetricList — страница списка метрик.
+type MetricList struct {
+	Metrics    []Metric `json:"metrics"`
+	NextCursor string   `json:"next_cursor,omitempty"` // пусто — страница последняя
+}
+
+// ListOptions — фильтры и страница списка метрик.
+type ListOptions struct {
+	Type   string // gauge, counter или пусто — все типы
+	Prefix string // префикс имени
+	Regex  string // регулярное выражение для имени
+	Limit  int    // размер страницы (0 — по умолчанию сервера)
+	Cursor string // NextCursor предыдущей страницы
+}
+
+// BatchOptions — параметры отправки пакета метрик.
+type BatchOptions struct {
+	// Partial включает режим частичного успеха: сервер сохраняет корректные
+	// метрики и возвращает ошибки остальных в BatchResult.Errors.
+	Partial bool
+	// IdempotencyKey — ключ идемпотентности: повтор пакета с тем же ключом
+	// получает сохранённый ответ и не применяется второй раз.
+	IdempotencyKey string
+}
+
+// BatchResult — результат отправки пакета.
+type BatchResult struct {
+	Accepted int              `json:"accepted"`
+	Errors   []BatchItemError `json:"errors,omitempty"`
+	Replayed bool             `json:"-"` // ответ взят сервером из хранилища ключей идемпотентности
+}
+
+// BatchItemError — ошибка метрики пакета с её индексом.
+type BatchItemError struct {
+	Index     int    `json:"index"`
+	ID        string `json:"id"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retriable bool   `json:"retriable"`
+}
+
+// SeriesStats — число созданных и отклонённых рядов клиента или префикса.
+type SeriesStats struct {
+	Name     string `json:"name"`
+	Created  int    `json:"created"`
+	Rejected int    `json:"rejected"`
+}
+
+// SeriesTop — клиенты и префиксы, создавшие больше всего рядов.
+type SeriesTop struct {
+	Clients  []SeriesStats `json:"clients"`
+	Prefixes []SeriesStats `json:"prefixes"`
+}
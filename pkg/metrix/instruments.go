@@ -0,0 +1,208 @@
+package metrix
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Mihklz/metrixcollector/pkg/client"
+)
+
+// DefaultBuckets — границы корзин гистограммы по умолчанию (секунды,
+// подходят для длительности HTTP-запросов).
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// instrument — метрика реестра, которая отдаёт накопленные изменения при сбросе
+type instrument interface {
+	collect() []client.Metric
+	// restore возвращает приращения counter-метрик, которые не удалось отправить
+	restore(metric client.Metric)
+}
+
+// Counter — монотонный счётчик. На сервер уходит приращение с прошлого
+// сброса, и сервер суммирует его с сохранённым значением.
+type Counter struct {
+	name  string
+	delta atomic.Int64
+}
+
+// Inc увеличивает счётчик на 1.
+func (c *Counter) Inc() {
+	c.delta.Add(1)
+}
+
+// Add увеличивает счётчик на delta. Отрицательные приращения игнорируются.
+func (c *Counter) Add(delta int64) {
+	if delta > 0 {
+		c.delta.Add(delta)
+	}
+}
+
+func (c *Counter) collect() []client.Metric {
+	if delta := c.delta.Swap(0); delta != 0 {
+		return []client.Metric{client.NewCounter(c.name, delta)}
+	}
+	return nil
+}
+
+func (c *Counter) restore(metric client.Metric) {
+	if metric.Delta != nil {
+		c.delta.Add(*metric.Delta)
+	}
+}
+
+// Gauge — текущее значение. На сервер уходит последнее значение,
+// если оно менялось с прошлого сброса.
+type Gauge struct {
+	name  string
+	bits  atomic.Uint64
+	dirty atomic.Bool
+}
+
+// Set устанавливает значение. NaN и ±Inf игнорируются: сервер их не принимает.
+func (g *Gauge) Set(value float64) {
+	if !finite(value) {
+		return
+	}
+	g.bits.Store(math.Float64bits(value))
+	g.dirty.Store(true)
+}
+
+// Add прибавляет delta к значению (отрицательное delta уменьшает его).
+// Приращение, после которого значение перестаёт быть конечным, игнорируется.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		value := math.Float64frombits(old) + delta
+		if !finite(value) {
+			return
+		}
+		if g.bits.CompareAndSwap(old, math.Float64bits(value)) {
+			g.dirty.Store(true)
+			return
+		}
+	}
+}
+
+// Value возвращает текущее значение.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+func (g *Gauge) collect() []client.Metric {
+	if g.dirty.Swap(false) {
+		return []client.Metric{client.NewGauge(g.name, g.Value())}
+	}
+	return nil
+}
+
+func (g *Gauge) restore(client.Metric) {
+	g.dirty.Store(true)
+}
+
+// Histogram — распределение наблюдений по корзинам. Сервер хранит только
+// gauge и counter, поэтому гистограмма name отправляется набором метрик:
+//   - name.count (counter) — число наблюдений;
+//   - name.sum (gauge) — сумма наблюдений за всё время;
+//   - name.le.<граница> (counter) — число наблюдений не больше границы.
+type Histogram struct {
+	name   string
+	bounds []float64
+	names  []string // имена метрик корзин
+
+	mu     sync.Mutex
+	counts []int64 // приращения корзин с прошлого сброса (не накопительные)
+	count  int64
+	sum    float64
+	dirty  bool
+}
+
+// newHistogram создаёт гистограмму с отсортированными границами корзин
+func newHistogram(name string, buckets []float64) *Histogram {
+	bounds := slices.Clone(buckets)
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+
+	names := make([]string, len(bounds))
+	for i, bound := range bounds {
+		names[i] = name + ".le." + strconv.FormatFloat(bound, 'f', -1, 64)
+	}
+	return &Histogram{
+		name:   name,
+		bounds: bounds,
+		names:  names,
+		counts: make([]int64, len(bounds)),
+	}
+}
+
+// Observe добавляет наблюдение. NaN и ±Inf игнорируются.
+func (h *Histogram) Observe(value float64) {
+	if !finite(value) {
+		return
+	}
+	i, _ := slices.BinarySearch(h.bounds, value)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += value
+	h.dirty = true
+}
+
+func (h *Histogram) collect() []client.Metric {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.dirty {
+		return nil
+	}
+	h.dirty = false
+
+	metrics := make([]client.Metric, 0, len(h.bounds)+2)
+	if h.count != 0 {
+		metrics = append(metrics, client.NewCounter(h.name+".count", h.count))
+	}
+	metrics = append(metrics, client.NewGauge(h.name+".sum", h.sum))
+
+	// Корзины накопительные: наблюдение попадает во все корзины с границей не меньше него
+	var cumulative int64
+	for i, delta := range h.counts {
+		cumulative += delta
+		if cumulative != 0 {
+			metrics = append(metrics, client.NewCounter(h.names[i], cumulative))
+		}
+	}
+	h.count = 0
+	clear(h.counts)
+	return metrics
+}
+
+func (h *Histogram) restore(metric client.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dirty = true
+	if metric.Delta == nil {
+		return
+	}
+	if metric.ID == h.name+".count" {
+		h.count += *metric.Delta
+		return
+	}
+	// Приращение корзины накопительное, поэтому возвращаем его в исходную
+	// корзину и вычитаем из следующей, чтобы не учесть дважды
+	if i := slices.Index(h.names, metric.ID); i >= 0 {
+		h.counts[i] += *metric.Delta
+		if i+1 < len(h.counts) {
+			h.counts[i+1] -= *metric.Delta
+		}
+	}
+}
+
+// finite проверяет, что значение не NaN и не ±Inf
+func finite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
@@ -0,0 +1,314 @@
+// Package metrix — SDK для отправки метрик из Go-приложений на сервер
+// без запуска агента.
+//
+// Реестр выдаёт счётчики, gauge-метрики и гистограммы, накапливает их
+// изменения и периодически отправляет пакетом на /updates/ через pkg/client:
+// тела сжимаются gzip и подписываются HMAC-SHA256 (заголовок HashSHA256)
+// так же, как у агента. Close отправляет накопленное перед завершением.
+//
+//	reg, err := metrix.New(metrix.Config{Address: "localhost:8080", Key: "secret"})
+//	if err != nil {
+//		return err
+//	}
+//	defer reg.Close(context.Background())
+//
+//	requests := reg.Counter("http.requests")
+//	latency := reg.Histogram("http.latency", metrix.DefaultBuckets)
+//	requests.Inc()
+//	latency.Observe(0.042)
+package metrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/pkg/client"
+)
+
+// Значения Config по умолчанию
+const (
+	DefaultFlushInterval = 10 * time.Second
+	DefaultMaxBatchSize  = 1000
+	DefaultMaxPending    = 100
+)
+
+// Config — настройки реестра.
+type Config struct {
+	Address string // адрес сервера (без схемы — http://)
+	Key     string // ключ HMAC для подписи (пусто — без подписи)
+	KeyID   string // идентификатор ключа в связке ключей сервера
+	Token   string // токен API с ролью ingest
+	Tenant  string // арендатор (пусто — по умолчанию)
+	AgentID string // идентификатор приложения для ограничения частоты и аудита
+
+	FlushInterval time.Duration // период отправки (0 — DefaultFlushInterval)
+	MaxBatchSize  int           // метрик в одном запросе (0 — DefaultMaxBatchSize)
+	MaxPending    int           // неотправленных пакетов в очереди (0 — DefaultMaxPending)
+
+	HTTPClient *http.Client // HTTP-клиент (nil — клиент по умолчанию)
+
+	// OnError получает ошибки фоновой отправки (nil — ошибки игнорируются).
+	OnError func(error)
+}
+
+// batch — пакет метрик с ключом идемпотентности. При повторе после сбоя
+// пакет отправляется с тем же ключом и не применяется сервером дважды.
+type batch struct {
+	key     string
+	metrics []client.Metric
+}
+
+// Registry — реестр метрик приложения. Методы безопасны для использования
+// из нескольких горутин.
+type Registry struct {
+	client        *client.Client
+	maxBatchSize  int
+	maxPending    int
+	flushInterval time.Duration
+	onError       func(error)
+
+	mu          sync.Mutex
+	instruments map[string]instrument
+
+	flushMu sync.Mutex // сбросы выполняются по одному
+	pending []batch    // пакеты, не отправленные из-за временных ошибок
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New создаёт реестр и запускает фоновую отправку метрик.
+func New(cfg Config) (*Registry, error) {
+	opts := []client.Option{
+		client.WithKey(cfg.Key),
+		client.WithKeyID(cfg.KeyID),
+		client.WithToken(cfg.Token),
+		client.WithTenant(cfg.Tenant),
+		client.WithAgentID(cfg.AgentID),
+	}
+	if cfg.HTTPClient != nil {
+		opts = append(opts, client.WithHTTPClient(cfg.HTTPClient))
+	}
+	c, err := client.New(cfg.Address, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Registry{
+		client:        c,
+		maxBatchSize:  cfg.MaxBatchSize,
+		maxPending:    cfg.MaxPending,
+		flushInterval: cfg.FlushInterval,
+		onError:       cfg.OnError,
+		instruments:   make(map[string]instrument),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if r.maxBatchSize <= 0 {
+		r.maxBatchSize = DefaultMaxBatchSize
+	}
+	if r.maxPending <= 0 {
+		r.maxPending = DefaultMaxPending
+	}
+	if r.flushInterval <= 0 {
+		r.flushInterval = DefaultFlushInterval
+	}
+
+	go r.run()
+	return r, nil
+}
+
+// Counter возвращает счётчик с именем name, создавая его при первом обращении.
+// Паникует, если имя уже занято метрикой другого вида.
+func (r *Registry) Counter(name string) *Counter {
+	return register(r, name, func() *Counter { return &Counter{name: name} })
+}
+
+// Gauge возвращает gauge-метрику с именем name, создавая её при первом обращении.
+// Паникует, если имя уже занято метрикой другого вида.
+func (r *Registry) Gauge(name string) *Gauge {
+	return register(r, name, func() *Gauge { return &Gauge{name: name} })
+}
+
+// Histogram возвращает гистограмму с именем name и границами корзин buckets,
+// создавая её при первом обращении (у существующей гистограммы границы
+// не меняются). Паникует, если имя уже занято метрикой другого вида.
+func (r *Registry) Histogram(name string, buckets []float64) *Histogram {
+	return register(r, name, func() *Histogram { return newHistogram(name, buckets) })
+}
+
+// register возвращает метрику реестра с именем name или создаёт её
+func register[T instrument](r *Registry, name string, create func() T) T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.instruments[name]; ok {
+		typed, ok := existing.(T)
+		if !ok {
+			panic(fmt.Sprintf("metrix: metric %q is already registered as %T", name, existing))
+		}
+		return typed
+	}
+	created := create()
+	r.instruments[name] = created
+	return created
+}
+
+// Flush отправляет накопленные изменения: сначала пакеты, не отправленные
+// ранее, затем новые. Пакеты с временной ошибкой остаются в очереди
+// до следующего сброса, отвергнутые сервером отбрасываются.
+func (r *Registry) Flush(ctx context.Context) error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.enqueue(r.collect())
+
+	var errs []error
+	for len(r.pending) > 0 {
+		b := r.pending[0]
+		result, err := r.client.UpdateBatch(ctx, b.metrics, client.BatchOptions{Partial: true, IdempotencyKey: b.key})
+		if err != nil {
+			if client.IsRetriable(err) || ctx.Err() != nil || !isAPIError(err) {
+				// Сервер недоступен: пакет остаётся в очереди с тем же ключом
+				errs = append(errs, fmt.Errorf("send metrics: %w", err))
+				break
+			}
+			errs = append(errs, fmt.Errorf("metrics rejected: %w", err))
+			r.pending = r.pending[1:]
+			continue
+		}
+		r.pending = r.pending[1:]
+		errs = append(errs, r.handleItemErrors(b, result)...)
+	}
+	return errors.Join(errs...)
+}
+
+// handleItemErrors возвращает в реестр метрики с временными ошибками,
+// чтобы отправить их при следующем сбросе, и сообщает об остальных
+func (r *Registry) handleItemErrors(b batch, result *client.BatchResult) []error {
+	var errs []error
+	for _, item := range result.Errors {
+		if item.Index < 0 || item.Index >= len(b.metrics) {
+			continue
+		}
+		if item.Retriable {
+			r.restore(b.metrics[item.Index])
+			continue
+		}
+		errs = append(errs, fmt.Errorf("metric %q rejected: %s (%s)", item.ID, item.Message, item.Code))
+	}
+	return errs
+}
+
+// Close останавливает фоновую отправку и отправляет накопленные изменения.
+// ctx ограничивает время финальной отправки.
+func (r *Registry) Close(ctx context.Context) error {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+	})
+	return r.Flush(ctx)
+}
+
+// run периодически отправляет метрики до вызова Close
+func (r *Registry) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), r.flushInterval)
+			err := r.Flush(ctx)
+			cancel()
+			if err != nil && r.onError != nil {
+				r.onError(err)
+			}
+		}
+	}
+}
+
+// collect забирает изменения всех метрик реестра в порядке имён
+func (r *Registry) collect() []client.Metric {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.instruments))
+	for name := range r.instruments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	instruments := make([]instrument, len(names))
+	for i, name := range names {
+		instruments[i] = r.instruments[name]
+	}
+	r.mu.Unlock()
+
+	var metrics []client.Metric
+	for _, inst := range instruments {
+		metrics = append(metrics, inst.collect()...)
+	}
+	return metrics
+}
+
+// restore возвращает неотправленную метрику в её источник
+func (r *Registry) restore(metric client.Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, inst := range r.instruments {
+		if owns(inst, metric.ID) {
+			inst.restore(metric)
+			return
+		}
+	}
+}
+
+// owns проверяет, что метрика с именем id порождена inst
+func owns(inst instrument, id string) bool {
+	switch v := inst.(type) {
+	case *Counter:
+		return v.name == id
+	case *Gauge:
+		return v.name == id
+	case *Histogram:
+		return id == v.name+".count" || id == v.name+".sum" || slices.Contains(v.names, id)
+	}
+	return false
+}
+
+// enqueue разбивает метрики на пакеты и добавляет их в очередь. При
+// переполнении очереди самые старые пакеты отбрасываются.
+func (r *Registry) enqueue(metrics []client.Metric) {
+	for len(metrics) > 0 {
+		n := min(len(metrics), r.maxBatchSize)
+		key, err := crypto.NewNonce()
+		if err != nil {
+			// Без ключа пакет всё равно отправляется, но повтор может учесть его дважды
+			key = ""
+		}
+		r.pending = append(r.pending, batch{key: key, metrics: metrics[:n:n]})
+		metrics = metrics[n:]
+	}
+	if dropped := len(r.pending) - r.maxPending; dropped > 0 {
+		r.pending = r.pending[dropped:]
+		if r.onError != nil {
+			r.onError(fmt.Errorf("metrix: pending queue is full, dropped %d batches", dropped))
+		}
+	}
+}
+
+// isAPIError проверяет, что ошибку вернул сервер, а не транспорт
+func isAPIError(err error) bool {
+	var apiErr *client.Error
+	return errors.As(err, &apiErr)
+}
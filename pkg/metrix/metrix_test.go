@@ -0,0 +1,173 @@
+package metrix
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/Mihklz/metrixcollector/internal/crypto"
+	"github.com/Mihklz/metrixcollector/internal/handler"
+	"github.com/Mihklz/metrixcollector/internal/idempotency"
+	"github.com/Mihklz/metrixcollector/internal/logger"
+	"github.com/Mihklz/metrixcollector/internal/middleware"
+	"github.com/Mihklz/metrixcollector/internal/repository"
+	"github.com/Mihklz/metrixcollector/internal/service"
+	"github.com/Mihklz/metrixcollector/pkg/client"
+)
+
+func init() {
+	logger.Log = zap.NewNop()
+}
+
+// newTestServer поднимает /updates/ с проверкой подписи и дедупликацией.
+// Пока unavailable > 0, сервер отвечает 503 и уменьшает счётчик.
+func newTestServer(t *testing.T, key string, unavailable *atomic.Int32) (*httptest.Server, *repository.MemStorage) {
+	t.Helper()
+
+	storage := repository.NewMemStorage()
+	keyring := crypto.NewStaticKeyring(key)
+	updates := middleware.WithIdempotency(idempotency.NewMemoryStore(time.Minute, 100))(
+		handler.NewBatchUpdateHandler(service.NewMetricsService(storage), keyring, nil))
+
+	h := middleware.WithGzipLimit(1 << 20)(
+		middleware.WithHashValidation(middleware.HashValidationOptions{Keyring: keyring, Strict: true})(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if unavailable != nil && unavailable.Add(-1) >= 0 {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				updates.ServeHTTP(w, r)
+			})))
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv, storage
+}
+
+func newTestRegistry(t *testing.T, address string) *Registry {
+	t.Helper()
+	reg, err := New(Config{Address: address, Key: "secret", FlushInterval: time.Hour})
+	require.NoError(t, err)
+	return reg
+}
+
+func TestRegistry_FlushSendsChanges(t *testing.T) {
+	srv, storage := newTestServer(t, "secret", nil)
+	reg := newTestRegistry(t, srv.URL)
+	ctx := context.Background()
+
+	requests := reg.Counter("requests")
+	requests.Add(3)
+	requests.Inc()
+	reg.Gauge("queue").Set(7)
+	latency := reg.Histogram("latency", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	require.NoError(t, reg.Flush(ctx))
+
+	delta, _ := storage.GetCounter("requests")
+	assert.Equal(t, int64(4), int64(delta))
+	value, _ := storage.GetGauge("queue")
+	assert.Equal(t, float64(7), float64(value))
+	count, _ := storage.GetCounter("latency.count")
+	assert.Equal(t, int64(3), int64(count))
+	sum, _ := storage.GetGauge("latency.sum")
+	assert.InDelta(t, 5.55, float64(sum), 1e-9)
+	le01, _ := storage.GetCounter("latency.le.0.1")
+	le1, _ := storage.GetCounter("latency.le.1")
+	assert.Equal(t, int64(1), int64(le01))
+	assert.Equal(t, int64(2), int64(le1))
+
+	// Без изменений повторный сброс ничего не добавляет
+	requests.Inc()
+	require.NoError(t, reg.Close(ctx))
+	delta, _ = storage.GetCounter("requests")
+	assert.Equal(t, int64(5), int64(delta))
+	count, _ = storage.GetCounter("latency.count")
+	assert.Equal(t, int64(3), int64(count))
+}
+
+func TestRegistry_RetriesPendingBatch(t *testing.T) {
+	var unavailable atomic.Int32
+	unavailable.Store(1)
+	srv, storage := newTestServer(t, "secret", &unavailable)
+	reg := newTestRegistry(t, srv.URL)
+	ctx := context.Background()
+
+	reg.Counter("requests").Add(2)
+	err := reg.Flush(ctx)
+	require.Error(t, err)
+	assert.True(t, client.IsRetriable(err))
+
+	reg.Counter("requests").Add(1)
+	require.NoError(t, reg.Close(ctx))
+
+	delta, _ := storage.GetCounter("requests")
+	assert.Equal(t, int64(3), int64(delta))
+}
+
+func TestRegistry_RejectedMetricIsReported(t *testing.T) {
+	srv, storage := newTestServer(t, "secret", nil)
+	reg := newTestRegistry(t, srv.URL)
+
+	reg.Gauge("bad name").Set(1)
+	reg.Gauge("good").Set(2)
+	err := reg.Close(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad name")
+
+	value, _ := storage.GetGauge("good")
+	assert.Equal(t, float64(2), float64(value))
+}
+
+func TestRegistry_WrongKeyIsNotRetried(t *testing.T) {
+	srv, _ := newTestServer(t, "secret", nil)
+	reg, err := New(Config{Address: srv.URL, Key: "other", FlushInterval: time.Hour})
+	require.NoError(t, err)
+
+	reg.Counter("requests").Inc()
+	require.Error(t, reg.Flush(context.Background()))
+	assert.Empty(t, reg.pending)
+	require.NoError(t, reg.Close(context.Background()))
+}
+
+func TestRegistry_BackgroundFlush(t *testing.T) {
+	srv, storage := newTestServer(t, "secret", nil)
+	reg, err := New(Config{Address: srv.URL, Key: "secret", FlushInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer reg.Close(context.Background())
+
+	reg.Counter("requests").Inc()
+	assert.Eventually(t, func() bool {
+		delta, ok := storage.GetCounter("requests")
+		return ok && delta == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRegistry_SameNameReturnsSameHandle(t *testing.T) {
+	reg := newTestRegistry(t, "localhost:1")
+	assert.Same(t, reg.Counter("requests"), reg.Counter("requests"))
+	assert.Panics(t, func() { reg.Gauge("requests") })
+}
+
+func TestHistogram_RestoreKeepsBuckets(t *testing.T) {
+	h := newHistogram("latency", []float64{1, 0.1, 1})
+	assert.Equal(t, []string{"latency.le.0.1", "latency.le.1"}, h.names)
+
+	h.Observe(0.05)
+	h.Observe(0.5)
+	metrics := h.collect()
+	for _, m := range metrics {
+		h.restore(m)
+	}
+	assert.Equal(t, metrics, h.collect())
+}